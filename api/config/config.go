@@ -2,39 +2,52 @@ package config
 
 import (
 	"fmt"
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
+	"os"
 	"time"
 )
 
 type Config struct {
-	AppName               string          `mapstructure:"app_name"`
-	API_Title             string          `mapstructure:"api_title"`
-	API_Description       string          `mapstructure:"api_description"`
-	API_Version           string          `mapstructure:"api_version"`
-	MetricsEnabled        bool            `mapstructure:"metrics_enabled"`
-	DatadogAddr           string          `mapstructure:"datadog_addr"`
-	LogLevel              string          `mapstructure:"log_level"`
-	Env                   string          `mapstructure:"env"`
-	Port                  int             `mapstructure:"port"`
-	Host                  string          `mapstructure:"host"`
-	RPCTimeout            time.Duration   `mapstructure:"rpc_timeout"`
-	TrustedProxies        []string        `mapstructure:"trusted_proxies"`
-	RateLimit             RateLimitConfig `mapstructure:"rate_limit"`
-	StatusRouteEnabled    bool            `mapstructure:"status_route_enabled"`
-	HealthRouteEnabled    bool            `mapstructure:"health_route_enabled"`
-	SelfJWTEnabled        bool            `mapstructure:"self_jwt_enabled"`
-	EnableSecurityHeaders bool            `mapstructure:"enable_security_headers"`
-	EnableCloudflare      bool            `mapstructure:"enable_cloudflare"`
-	EnableCORS            bool            `mapstructure:"enable_cors"`
-	EnableRBAC            bool            `mapstructure:"enable_rbac"`
-	EnableOpenapiSwagger  bool            `mapstructure:"enable_openapi_swagger"`
-	TrustedOrigins        []string        `mapstructure:"trusted_origins"`
+	AppName               string            `mapstructure:"app_name"`
+	API_Title             string            `mapstructure:"api_title"`
+	API_Description       string            `mapstructure:"api_description"`
+	API_Version           string            `mapstructure:"api_version"`
+	MetricsEnabled        bool              `mapstructure:"metrics_enabled"`
+	DatadogAddr           string            `mapstructure:"datadog_addr"`
+	LogLevel              string            `mapstructure:"log_level"`
+	Env                   string            `mapstructure:"env"`
+	Port                  int               `mapstructure:"port"`
+	Host                  string            `mapstructure:"host"`
+	RPCTimeout            time.Duration     `mapstructure:"rpc_timeout"`
+	TrustedProxies        []string          `mapstructure:"trusted_proxies"`
+	RateLimit             RateLimitConfig   `mapstructure:"rate_limit"`
+	Compression           CompressionConfig `mapstructure:"compression"`
+	BodyLimits            BodyLimitsConfig  `mapstructure:"body_limits"`
+	StatusRouteEnabled    bool              `mapstructure:"status_route_enabled"`
+	HealthRouteEnabled    bool              `mapstructure:"health_route_enabled"`
+	SelfJWTEnabled        bool              `mapstructure:"self_jwt_enabled"`
+	EnableSecurityHeaders bool              `mapstructure:"enable_security_headers"`
+	EnableCloudflare      bool              `mapstructure:"enable_cloudflare"`
+	EnableCORS            bool              `mapstructure:"enable_cors"`
+	EnableRBAC            bool              `mapstructure:"enable_rbac"`
+	EnableOpenapiSwagger  bool              `mapstructure:"enable_openapi_swagger"`
+	TrustedOrigins        []string          `mapstructure:"trusted_origins"`
+	UnknownParams         string            `mapstructure:"unknown_params"`    // reject, drop or passthrough (default: drop)
+	ResponseEnvelope      bool              `mapstructure:"response_envelope"` // Wrap responses as {data, request_id, meta}
+	ContractMode          string            `mapstructure:"contract_mode"`     // enforce, warn or off (default: warn)
+	MockMode              bool              `mapstructure:"mock_mode"`         // Serve every route from its mock, without Redis
+	UploadDir             string            `mapstructure:"upload_dir"`        // Temporary files of uploads with storage: temp (default: system temp dir)
+	UploadRetention       time.Duration     `mapstructure:"upload_retention"`  // How long temporary uploads outlive a timed out service call (default: 10m)
+	ErrorDocsURL          string            `mapstructure:"error_docs_url"`    // Base URL of the error code docs, linked from each problem's type
 
 	Redis         RedisConfig         `mapstructure:"redis"`
 	RPCPool       RPCPoolConfig       `mapstructure:"rpc_pool"`
 	JWT           JWTConfig           `mapstructure:"jwt"`
 	OAuth         OAuthConfig         `mapstructure:"oauth"`
 	JWTCloudflare JWTCloudflareConfig `mapstructure:"jwt_cloudflare"`
+	Webhooks      WebhookConfig       `mapstructure:"webhooks"`
+	Shutdown      ShutdownConfig      `mapstructure:"shutdown"`
 }
 
 type RedisConfig struct {
@@ -82,48 +95,121 @@ type RateLimitConfig struct {
 	DefaultBurst int  `mapstructure:"default_burst"`
 }
 
+// CompressionConfig sets how route responses are compressed; routes can opt in or out
+type CompressionConfig struct {
+	Enabled bool `mapstructure:"enabled"`  // Default of the routes' compression setting
+	MinSize int  `mapstructure:"min_size"` // Smaller responses are sent uncompressed (default: 1024 bytes)
+	Level   int  `mapstructure:"level"`    // gzip level, 1 (fastest) to 9 (smallest) (default: 6)
+	Brotli  bool `mapstructure:"brotli"`   // Also offer br, preferred over gzip when the client accepts both
+}
+
+// BodyLimitsConfig bounds the JSON request bodies routes accept; routes can override each limit
+type BodyLimitsConfig struct {
+	MaxBytes        int64 `mapstructure:"max_bytes"`         // Larger bodies are rejected with 413 (default: 1 MiB)
+	MaxDepth        int   `mapstructure:"max_depth"`         // Nesting of objects and arrays (default: 32)
+	MaxKeys         int   `mapstructure:"max_keys"`          // Object keys in the whole body (default: 1000)
+	MaxStringLength int   `mapstructure:"max_string_length"` // Characters in a key or string value (default: 65536)
+}
+
+// ShutdownConfig sets how the server drains on SIGTERM or SIGINT
+type ShutdownConfig struct {
+	Delay       time.Duration `mapstructure:"delay"`        // Readiness fails this long before the listener closes (default: 5s, negative disables)
+	GracePeriod time.Duration `mapstructure:"grace_period"` // Time in-flight requests and RPC calls get to finish (default: 30s)
+}
+
+// WebhookConfig controls the outbound webhook delivery worker.
+type WebhookConfig struct {
+	Enabled          bool            `mapstructure:"enabled"`
+	Stream           string          `mapstructure:"stream"`             // Stream the payment events are read from
+	Group            string          `mapstructure:"group"`              // Consumer group used by the workers
+	Consumer         string          `mapstructure:"consumer"`           // Consumer name prefix (default: hostname), best kept stable across restarts
+	ClaimIdle        time.Duration   `mapstructure:"claim_idle"`         // Pending deliveries idle this long are taken over from stopped consumers
+	DeadLetterStream string          `mapstructure:"dead_letter_stream"` // Stream failed deliveries are moved to
+	AttemptsStream   string          `mapstructure:"attempts_stream"`    // Stream every delivery attempt is recorded in
+	AttemptsMaxLen   int64           `mapstructure:"attempts_max_len"`   // Approximate cap on the attempts stream length
+	RetriesKey       string          `mapstructure:"retries_key"`        // Sorted set of failed deliveries by the time their next attempt is due
+	ReplayedKey      string          `mapstructure:"replayed_key"`       // Key prefix recording which dead letters were replayed
+	Workers          int             `mapstructure:"workers"`
+	MaxAttempts      int             `mapstructure:"max_attempts"`
+	InitialBackoff   time.Duration   `mapstructure:"initial_backoff"`
+	MaxBackoff       time.Duration   `mapstructure:"max_backoff"`
+	Timeout          time.Duration   `mapstructure:"timeout"`
+	SecretsKey       string          `mapstructure:"secrets_key"`   // Redis hash of merchant_id -> signing secret
+	EndpointsKey     string          `mapstructure:"endpoints_key"` // Redis hash of merchant_id -> webhook URL
+	Secrets          []WebhookSecret `mapstructure:"secrets"`       // Static merchant secrets, checked before Redis
+	SignatureHeader  string          `mapstructure:"signature_header"`
+	AdminRole        string          `mapstructure:"admin_role"`
+}
+
+// WebhookSecret is a static merchant signing secret. Secrets are listed rather than keyed by merchant
+// ID because viper lowercases map keys, and merchant IDs are case sensitive.
+type WebhookSecret struct {
+	MerchantID string `mapstructure:"merchant_id"`
+	Secret     string `mapstructure:"secret"`
+}
+
+// StrictDecoding makes viper report config keys that don't match any struct field
+func StrictDecoding(dc *mapstructure.DecoderConfig) {
+	dc.ErrorUnused = true
+}
+
 type AllowedUser struct {
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
 	Role     string `mapstructure:"role"`
 }
 
+// LoadAPIConfig loads api.yaml and credentials.yaml from ./config
 func LoadAPIConfig() (*Config, error) {
-	viper.AddConfigPath("./config")
-	viper.SetConfigType("yaml")
+	return LoadAPIConfigFrom("./config")
+}
+
+// LoadAPIConfigFrom loads the API config from the given directory.
+// Keys that don't match a setting are errors rather than being silently ignored.
+func LoadAPIConfigFrom(dir string) (*Config, error) {
+	// A fresh viper instance per load, so reloads never see stale keys
+	v := viper.New()
+	v.AddConfigPath(dir)
+	v.SetConfigType("yaml")
 
 	// Set environment variable prefix to "GOAPI" for consistency
-	viper.SetEnvPrefix("GOAPI")
-	viper.AutomaticEnv()
+	v.SetEnvPrefix("GOAPI")
+	v.AutomaticEnv()
 
 	// Load main API config
-	viper.SetConfigName("api")
-	if err := viper.ReadInConfig(); err != nil {
+	v.SetConfigName("api")
+	if err := v.ReadInConfig(); err != nil {
 		return nil, fmt.Errorf("error reading api.yaml: %w", err)
 	}
 
 	// Initialize config struct with loaded values
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config, StrictDecoding); err != nil {
 		return nil, fmt.Errorf("error unmarshalling api config: %w", err)
 	}
 
 	// Load credentials if available and overlay on top of the API config
-	viper.SetConfigName("credentials")
-	if err := viper.MergeInConfig(); err == nil {
-		if err := viper.Unmarshal(&config); err != nil {
+	v.SetConfigName("credentials")
+	if err := v.MergeInConfig(); err == nil {
+		if err := v.Unmarshal(&config, StrictDecoding); err != nil {
 			return nil, fmt.Errorf("error unmarshalling credentials config: %w", err)
 		}
 	}
 
 	// Map environment variables to struct fields, giving them precedence
-	bindEnvironmentVariables()
+	bindEnvironmentVariables(v)
 	// Reload into config to override with environment variables
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.Unmarshal(&config, StrictDecoding); err != nil {
 		return nil, fmt.Errorf("error unmarshalling final config: %w", err)
 	}
 
-	// Apply defaults if not set in the YAML file
+	ApplyDefaults(&config)
+
+	return &config, nil
+}
+
+// ApplyDefaults fills in the settings left empty in the YAML file
+func ApplyDefaults(config *Config) {
 	if config.Host == "" {
 		config.Host = "127.0.0.1"
 	}
@@ -160,39 +246,147 @@ func LoadAPIConfig() (*Config, error) {
 	if config.RateLimit.DefaultBurst == 0 {
 		config.RateLimit.DefaultBurst = 10
 	}
+	if config.Compression.MinSize == 0 {
+		config.Compression.MinSize = 1024
+	}
+	if config.Compression.Level == 0 {
+		config.Compression.Level = 6
+	}
+	if config.BodyLimits.MaxBytes == 0 {
+		config.BodyLimits.MaxBytes = 1 << 20
+	}
+	if config.BodyLimits.MaxDepth == 0 {
+		config.BodyLimits.MaxDepth = 32
+	}
+	if config.BodyLimits.MaxKeys == 0 {
+		config.BodyLimits.MaxKeys = 1000
+	}
+	if config.BodyLimits.MaxStringLength == 0 {
+		config.BodyLimits.MaxStringLength = 65536
+	}
+	if config.Shutdown.Delay == 0 {
+		// Load balancers must see the failed readiness before connections are refused
+		config.Shutdown.Delay = 5 * time.Second
+	}
+	if config.Shutdown.GracePeriod == 0 {
+		config.Shutdown.GracePeriod = 30 * time.Second
+	}
 	if config.JWTCloudflare.CacheDuration == 0 {
 		config.JWTCloudflare.CacheDuration = time.Hour
 	}
+	if config.UnknownParams == "" {
+		config.UnknownParams = "drop"
+	}
+	if config.ContractMode == "" {
+		config.ContractMode = "warn"
+	}
+	if config.UploadRetention == 0 {
+		config.UploadRetention = 10 * time.Minute
+	}
+	applyWebhookDefaults(&config.Webhooks)
+}
 
-	return &config, nil
+// applyWebhookDefaults fills in the webhook worker settings left empty in the YAML file
+func applyWebhookDefaults(wh *WebhookConfig) {
+	if wh.Stream == "" {
+		wh.Stream = "webhook.events"
+	}
+	if wh.Group == "" {
+		wh.Group = "api-webhooks"
+	}
+	if wh.Consumer == "" {
+		if hostname, err := os.Hostname(); err == nil {
+			wh.Consumer = hostname
+		} else {
+			wh.Consumer = "api"
+		}
+	}
+	if wh.ClaimIdle == 0 {
+		wh.ClaimIdle = time.Minute
+	}
+	if wh.DeadLetterStream == "" {
+		wh.DeadLetterStream = "webhook.dead_letter"
+	}
+	if wh.AttemptsStream == "" {
+		wh.AttemptsStream = "webhook.attempts"
+	}
+	if wh.AttemptsMaxLen == 0 {
+		wh.AttemptsMaxLen = 100000
+	}
+	if wh.RetriesKey == "" {
+		wh.RetriesKey = "webhook.retries"
+	}
+	if wh.ReplayedKey == "" {
+		wh.ReplayedKey = "webhook.replayed"
+	}
+	if wh.Workers == 0 {
+		wh.Workers = 4
+	}
+	if wh.MaxAttempts == 0 {
+		wh.MaxAttempts = 8
+	}
+	if wh.InitialBackoff == 0 {
+		wh.InitialBackoff = time.Second
+	}
+	if wh.MaxBackoff == 0 {
+		wh.MaxBackoff = 10 * time.Minute
+	}
+	if wh.Timeout == 0 {
+		wh.Timeout = 10 * time.Second
+	}
+	if wh.SecretsKey == "" {
+		wh.SecretsKey = "webhook.secrets"
+	}
+	if wh.EndpointsKey == "" {
+		wh.EndpointsKey = "webhook.endpoints"
+	}
+	if wh.SignatureHeader == "" {
+		wh.SignatureHeader = "X-CaasPay-Signature"
+	}
+	if wh.AdminRole == "" {
+		wh.AdminRole = "admin"
+	}
 }
 
-func bindEnvironmentVariables() {
+func bindEnvironmentVariables(v *viper.Viper) {
 	// Map specific environment variables to config fields
-	viper.BindEnv("metrics_enabled", "GOAPI_METRICS_ENABLED")
-	viper.BindEnv("datadog_addr", "GOAPI_DATADOG_ADDR")
-	viper.BindEnv("log_level", "GOAPI_LOG_LEVEL")
-	viper.BindEnv("env", "GOAPI_ENV")
-	viper.BindEnv("port", "GOAPI_PORT")
-	viper.BindEnv("host", "GOAPI_HOST")
-	viper.BindEnv("rpc_timeout", "GOAPI_RPC_TIMEOUT")
-	viper.BindEnv("trusted_proxies", "GOAPI_TRUSTED_PROXIES")
-	viper.BindEnv("status_route_enabled", "GOAPI_STATUS_ROUTE_ENABLED")
-	viper.BindEnv("health_route_enabled", "GOAPI_HEALTH_ROUTE_ENABLED")
-	viper.BindEnv("self_jwt_enabled", "GOAPI_SELF_JWT_ENABLED")
-	viper.BindEnv("enable_security_headers", "GOAPI_ENABLE_SECURITY_HEADERS")
-	viper.BindEnv("enable_cloudflare", "GOAPI_ENABLE_CLOUDFLARE")
-	viper.BindEnv("enable_cors", "GOAPI_ENABLE_CORS")
-	viper.BindEnv("enable_rbac", "GOAPI_ENABLE_RBAC")
-	viper.BindEnv("enable_openapi_swagger", "GOAPI_ENABLE_OPENAPI_SWAGGER")
-	viper.BindEnv("redis.is_cluster", "GOAPI_REDIS_IS_CLUSTER")
-	viper.BindEnv("redis.prefix", "GOAPI_REDIS_PREFIX")
-	viper.BindEnv("redis.address", "GOAPI_REDIS_ADDRESS")
-	viper.BindEnv("redis.initial_clients", "GOAPI_REDIS_INITIAL_CLIENTS")
-	viper.BindEnv("redis.max_clients", "GOAPI_REDIS_MAX_CLIENTS")
-	viper.BindEnv("redis.max_requests_per_client", "GOAPI_REDIS_MAX_REQUESTS_PER_CLIENT")
-	viper.BindEnv("jwt.token_expiry", "GOAPI_JWT_TOKEN_EXPIRY")
-	viper.BindEnv("jwt.jwt_secret", "GOAPI_JWT_SECRET")
-	viper.BindEnv("jwt_cloudflare.public_key_url", "GOAPI_JWT_CLOUDFLARE_PUBLIC_KEY_URL")
-	viper.BindEnv("jwt_cloudflare.issuer", "GOAPI_JWT_CLOUDFLARE_ISSUER")
+	v.BindEnv("metrics_enabled", "GOAPI_METRICS_ENABLED")
+	v.BindEnv("datadog_addr", "GOAPI_DATADOG_ADDR")
+	v.BindEnv("log_level", "GOAPI_LOG_LEVEL")
+	v.BindEnv("env", "GOAPI_ENV")
+	v.BindEnv("port", "GOAPI_PORT")
+	v.BindEnv("host", "GOAPI_HOST")
+	v.BindEnv("rpc_timeout", "GOAPI_RPC_TIMEOUT")
+	v.BindEnv("trusted_proxies", "GOAPI_TRUSTED_PROXIES")
+	v.BindEnv("status_route_enabled", "GOAPI_STATUS_ROUTE_ENABLED")
+	v.BindEnv("health_route_enabled", "GOAPI_HEALTH_ROUTE_ENABLED")
+	v.BindEnv("self_jwt_enabled", "GOAPI_SELF_JWT_ENABLED")
+	v.BindEnv("enable_security_headers", "GOAPI_ENABLE_SECURITY_HEADERS")
+	v.BindEnv("enable_cloudflare", "GOAPI_ENABLE_CLOUDFLARE")
+	v.BindEnv("enable_cors", "GOAPI_ENABLE_CORS")
+	v.BindEnv("enable_rbac", "GOAPI_ENABLE_RBAC")
+	v.BindEnv("enable_openapi_swagger", "GOAPI_ENABLE_OPENAPI_SWAGGER")
+	v.BindEnv("unknown_params", "GOAPI_UNKNOWN_PARAMS")
+	v.BindEnv("response_envelope", "GOAPI_RESPONSE_ENVELOPE")
+	v.BindEnv("contract_mode", "GOAPI_CONTRACT_MODE")
+	v.BindEnv("mock_mode", "GOAPI_MOCK_MODE")
+	v.BindEnv("upload_dir", "GOAPI_UPLOAD_DIR")
+	v.BindEnv("error_docs_url", "GOAPI_ERROR_DOCS_URL")
+	v.BindEnv("compression.enabled", "GOAPI_COMPRESSION_ENABLED")
+	v.BindEnv("body_limits.max_bytes", "GOAPI_BODY_LIMITS_MAX_BYTES")
+	v.BindEnv("redis.is_cluster", "GOAPI_REDIS_IS_CLUSTER")
+	v.BindEnv("redis.prefix", "GOAPI_REDIS_PREFIX")
+	v.BindEnv("redis.address", "GOAPI_REDIS_ADDRESS")
+	v.BindEnv("rpc_pool.initial_clients", "GOAPI_RPC_POOL_INITIAL_CLIENTS", "GOAPI_REDIS_INITIAL_CLIENTS")
+	v.BindEnv("rpc_pool.max_clients", "GOAPI_RPC_POOL_MAX_CLIENTS", "GOAPI_REDIS_MAX_CLIENTS")
+	v.BindEnv("rpc_pool.max_requests_per_client", "GOAPI_RPC_POOL_MAX_REQUESTS_PER_CLIENT", "GOAPI_REDIS_MAX_REQUESTS_PER_CLIENT")
+	v.BindEnv("jwt.token_expiry", "GOAPI_JWT_TOKEN_EXPIRY")
+	v.BindEnv("jwt.jwt_secret", "GOAPI_JWT_SECRET")
+	v.BindEnv("jwt_cloudflare.public_key_url", "GOAPI_JWT_CLOUDFLARE_PUBLIC_KEY_URL")
+	v.BindEnv("jwt_cloudflare.issuer", "GOAPI_JWT_CLOUDFLARE_ISSUER")
+	v.BindEnv("shutdown.delay", "GOAPI_SHUTDOWN_DELAY")
+	v.BindEnv("shutdown.grace_period", "GOAPI_SHUTDOWN_GRACE_PERIOD")
+	v.BindEnv("webhooks.enabled", "GOAPI_WEBHOOKS_ENABLED")
+	v.BindEnv("webhooks.workers", "GOAPI_WEBHOOKS_WORKERS")
+	v.BindEnv("webhooks.consumer", "GOAPI_WEBHOOKS_CONSUMER")
 }
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAPIConfigFromIsStrict(t *testing.T) {
+	tests := []struct {
+		name        string
+		api         string
+		credentials string
+		wantErr     string // Part of the error, empty when the config is valid
+	}{
+		{name: "valid", api: "app_name: \"test\"\nport: 9090\n"},
+		{name: "unknown key", api: "app_name: \"test\"\nmock_mod: true\n", wantErr: "mock_mod"},
+		{name: "unknown nested key", api: "app_name: \"test\"\ncompression:\n  levle: 5\n", wantErr: "levle"},
+		{name: "unknown key in credentials", api: "app_name: \"test\"\n", credentials: "jwt:\n  jwt_secert: \"x\"\n", wantErr: "jwt_secert"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "api.yaml"), []byte(tt.api), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.credentials != "" {
+				if err := os.WriteFile(filepath.Join(dir, "credentials.yaml"), []byte(tt.credentials), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cfg, err := LoadAPIConfigFrom(dir)
+			if tt.wantErr == "" {
+				if err != nil || cfg.Port != 9090 {
+					t.Fatalf("got %v, want the config loaded", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got %v, want an error naming %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
 	"caaspay-api-go/internal/auth"
+	"errors"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 	"net/http"
@@ -16,8 +19,14 @@ func JWTLoginHandler(cfg *config.Config) gin.HandlerFunc {
 			Password string `json:"password"`
 		}
 
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.BodyLimits.MaxBytes)
 		if err := c.ShouldBindJSON(&credentials); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Abort(c, http.StatusRequestEntityTooLarge, problem.BodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", cfg.BodyLimits.MaxBytes))
+				return
+			}
+			problem.Abort(c, http.StatusBadRequest, problem.BodyInvalid, "Expected a JSON body with username and password")
 			return
 		}
 
@@ -32,14 +41,14 @@ func JWTLoginHandler(cfg *config.Config) gin.HandlerFunc {
 			}
 		}
 		if matchedUser == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthInvalid, "Invalid credentials")
 			return
 		}
 
 		// Generate JWT
 		token, err := auth.GenerateJWT(cfg, matchedUser.Username, matchedUser.Role, int(cfg.JWT.TokenExpiry.Seconds()))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not generate token"})
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "Could not generate token")
 			return
 		}
 
@@ -55,14 +64,14 @@ func JWTRenewalHandler(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" || len(tokenString) < 7 || tokenString[:7] != "Bearer " {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing or malformed"})
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthMissing, "Authorization header missing or malformed")
 			return
 		}
 		tokenString = tokenString[7:]
 
 		newToken, err := auth.RenewJWTToken(cfg, tokenString, int(cfg.JWT.TokenRenewalWindow.Seconds()))
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			problem.Abort(c, http.StatusBadRequest, problem.AuthInvalid, err.Error())
 			return
 		}
 
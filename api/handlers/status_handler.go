@@ -4,11 +4,37 @@ import (
 	"caaspay-api-go/internal/rpc"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"sync/atomic"
 	"time"
 )
 
+// Readiness is failed when the server starts shutting down, so load balancers stop sending traffic
+type Readiness struct {
+	failed atomic.Bool
+}
+
+// Fail marks the instance as no longer ready
+func (r *Readiness) Fail() {
+	r.failed.Store(true)
+}
+
+// Failed reports whether the instance is shutting down
+func (r *Readiness) Failed() bool {
+	return r != nil && r.failed.Load()
+}
+
 // HealthHandler checks if the RPC client pool is available and returns API health status.
-func HealthHandler(c *gin.Context, rpcClientPool *rpc.RPCClientPool) {
+// It fails once shutdown has started.
+func HealthHandler(c *gin.Context, rpcClientPool *rpc.RPCClientPool, readiness *Readiness) {
+	if readiness.Failed() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	// In mock mode there is no pool and no dependency to check
+	if rpcClientPool == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "healthy", "mock_mode": true})
+		return
+	}
 	client, err := rpcClientPool.GetClient(2 * time.Second) // Check client availability with a timeout
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unhealthy", "reason": "RPC client unavailable"})
@@ -19,7 +45,15 @@ func HealthHandler(c *gin.Context, rpcClientPool *rpc.RPCClientPool) {
 }
 
 // StatusHandler returns the status of the application based on internal checks.
-func StatusHandler(c *gin.Context, rpcClientPool *rpc.RPCClientPool) {
+func StatusHandler(c *gin.Context, rpcClientPool *rpc.RPCClientPool, readiness *Readiness) {
+	if readiness.Failed() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+	if rpcClientPool == nil {
+		c.JSON(http.StatusOK, gin.H{"status": "operational", "mock_mode": true})
+		return
+	}
 	client, err := rpcClientPool.GetClient(2 * time.Second)
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "degraded", "reason": "RPC client issue"})
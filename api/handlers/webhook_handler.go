@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"caaspay-api-go/api/problem"
+	"caaspay-api-go/internal/webhook"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// WebhookFailedHandler lists deliveries that were moved to the dead-letter stream
+func WebhookFailedHandler(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveries, err := dispatcher.ListFailed(c.Request.Context(), countQuery(c))
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "Could not read failed deliveries")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+	}
+}
+
+// WebhookAttemptsHandler lists the most recent delivery attempts
+func WebhookAttemptsHandler(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attempts, err := dispatcher.ListAttempts(c.Request.Context(), countQuery(c))
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "Could not read delivery attempts")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"attempts": attempts})
+	}
+}
+
+// WebhookReplayHandler puts a single failed delivery back on the events stream
+func WebhookReplayHandler(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+
+		messageID, err := dispatcher.Replay(c.Request.Context(), id)
+		if errors.Is(err, webhook.ErrNotFound) {
+			problem.Abort(c, http.StatusNotFound, problem.NotFound, "Delivery not found")
+			return
+		}
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "Could not replay delivery, retrying will not deliver it twice")
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"replayed": id, "message_id": messageID})
+	}
+}
+
+// WebhookReplayAllHandler puts up to `count` failed deliveries back on the events stream, oldest first
+func WebhookReplayAllHandler(dispatcher *webhook.Dispatcher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		replayed, err := dispatcher.ReplayAll(c.Request.Context(), countQuery(c))
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, fmt.Sprintf("Could not replay deliveries, %d were replayed before the failure and retrying will not deliver them twice", len(replayed)))
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"replayed": replayed})
+	}
+}
+
+// countQuery reads the `count` query parameter, defaulting to 50 and capped at 1000
+func countQuery(c *gin.Context) int64 {
+	count, err := strconv.ParseInt(c.DefaultQuery("count", "50"), 10, 64)
+	if err != nil || count <= 0 {
+		return 50
+	}
+	if count > 1000 {
+		return 1000
+	}
+	return count
+}
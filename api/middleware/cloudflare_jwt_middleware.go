@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
 	"crypto/rsa"
 	"encoding/json"
 	"errors"
@@ -39,8 +40,7 @@ func CloudflareJWTMiddleware(cfg *config.Config) gin.HandlerFunc {
 		tokenString := c.GetHeader("CF-Access-JWT-Assertion")
 
 		if tokenString == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Cloudflare JWT missing"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthMissing, "Cloudflare JWT missing")
 			return
 		}
 
@@ -59,11 +59,22 @@ func CloudflareJWTMiddleware(cfg *config.Config) gin.HandlerFunc {
 		})
 
 		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Cloudflare JWT"})
-			c.Abort()
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				problem.Abort(c, http.StatusUnauthorized, problem.AuthExpired, "Cloudflare JWT has expired")
+				return
+			}
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthInvalid, "Invalid Cloudflare JWT")
 			return
 		}
 
+		// Store the identity claims in context
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			c.Set("claims", map[string]interface{}(claims))
+			if email, ok := claims["email"].(string); ok {
+				c.Set("email", email)
+			}
+		}
+
 		// If the token is valid, continue processing
 		c.Next()
 	}
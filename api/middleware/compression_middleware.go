@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressibleTypes are the media types worth compressing, other responses are sent as is
+var compressibleTypes = []string{
+	"text/", "application/json", "application/problem+json", "application/xml",
+	"application/javascript", "application/msgpack", "application/x-msgpack",
+}
+
+// CompressionMiddleware compresses responses of at least minSize bytes with gzip, or brotli when
+// enabled and preferred by the client, as negotiated with Accept-Encoding. The response is buffered
+// so its size is known before it is sent.
+func CompressionMiddleware(minSize, level int, brotliEnabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), brotliEnabled)
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		buffered := &bufferedWriter{ResponseWriter: c.Writer}
+		c.Writer = buffered
+		// Also restored when a handler panics, so the recovery's response isn't lost in the buffer
+		defer func() { c.Writer = buffered.ResponseWriter }()
+		c.Next()
+		c.Writer = buffered.ResponseWriter
+		c.Writer.WriteHeader(buffered.Status())
+
+		body := buffered.body.Bytes()
+		header := c.Writer.Header()
+		if len(body) == 0 {
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		if len(body) < minSize || header.Get("Content-Encoding") != "" || !compressible(header.Get("Content-Type")) {
+			c.Writer.Write(body)
+			return
+		}
+
+		var compressed bytes.Buffer
+		var encoder io.WriteCloser
+		if encoding == "br" {
+			encoder = brotli.NewWriter(&compressed)
+		} else {
+			encoder, _ = gzip.NewWriterLevel(&compressed, level)
+		}
+		encoder.Write(body)
+		encoder.Close()
+
+		header.Set("Content-Encoding", encoding)
+		header.Del("Content-Length")
+		c.Writer.Write(compressed.Bytes())
+	}
+}
+
+// bufferedWriter holds the response back until the handlers are done. To the handlers it behaves
+// like gin's writer: the status is fixed by the first write and Written and Size report the buffer.
+type bufferedWriter struct {
+	gin.ResponseWriter
+	body    bytes.Buffer
+	status  int
+	written bool
+}
+
+func (w *bufferedWriter) WriteHeader(code int) {
+	if code > 0 && !w.written {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow fixes the status; the header is sent with the buffered response
+func (w *bufferedWriter) WriteHeaderNow() {
+	w.written = true
+}
+
+func (w *bufferedWriter) Write(data []byte) (int, error) {
+	w.written = true
+	return w.body.Write(data)
+}
+
+func (w *bufferedWriter) WriteString(s string) (int, error) {
+	w.written = true
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *bufferedWriter) Written() bool {
+	return w.written
+}
+
+// Size is the number of bytes buffered, or -1 before the header is written, like gin's writer
+func (w *bufferedWriter) Size() int {
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+// Flush is deferred until the buffered response is sent
+func (w *bufferedWriter) Flush() {}
+
+// negotiateEncoding picks the coding with the highest Accept-Encoding quality among gzip and, when
+// enabled, br; brotli wins ties. It returns "" when the client accepts neither.
+func negotiateEncoding(accept string, brotliEnabled bool) string {
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(coding))] = quality
+	}
+	qualityOf := func(coding string) float64 {
+		if quality, ok := qualities[coding]; ok {
+			return quality
+		}
+		return qualities["*"]
+	}
+
+	best, bestQuality := "", 0.0
+	if brotliEnabled && qualityOf("br") > bestQuality {
+		best, bestQuality = "br", qualityOf("br")
+	}
+	if qualityOf("gzip") > bestQuality {
+		best = "gzip"
+	}
+	return best
+}
+
+// compressible reports whether a response of the given content type is worth compressing
+func compressible(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	for _, prefix := range compressibleTypes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		brotli bool
+		want   string
+	}{
+		{accept: "", brotli: true, want: ""},
+		{accept: "gzip", brotli: true, want: "gzip"},
+		{accept: "gzip, br", brotli: true, want: "br"},
+		{accept: "gzip, br", brotli: false, want: "gzip"},
+		{accept: "br;q=0.5, gzip;q=0.8", brotli: true, want: "gzip"},
+		{accept: "GZIP;q=0.2", brotli: true, want: "gzip"},
+		{accept: "gzip;q=0", brotli: true, want: ""},
+		{accept: "*", brotli: true, want: "br"},
+		{accept: "*;q=0.5, br;q=0", brotli: true, want: "gzip"},
+		{accept: "identity", brotli: true, want: ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.accept, tt.brotli); got != tt.want {
+			t.Errorf("negotiateEncoding(%q, %v) = %q, want %q", tt.accept, tt.brotli, got, tt.want)
+		}
+	}
+}
+
+// decode returns the body decoded with the given content coding
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var reader io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			t.Fatalf("invalid gzip body: %v", err)
+		}
+		reader = gzipReader
+	case "br":
+		reader = brotli.NewReader(reader)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("invalid %s body: %v", encoding, err)
+	}
+	return string(decoded)
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"status":"paid"}`, 100)
+	tests := []struct {
+		name         string
+		method       string
+		accept       string
+		contentType  string
+		body         string
+		wantEncoding string
+	}{
+		{name: "gzip", accept: "gzip", contentType: "application/json", body: large, wantEncoding: "gzip"},
+		{name: "brotli preferred", accept: "gzip, br", contentType: "application/json", body: large, wantEncoding: "br"},
+		{name: "no accepted coding", accept: "identity", contentType: "application/json", body: large},
+		{name: "below min size", accept: "gzip", contentType: "application/json", body: `{"status":"paid"}`},
+		{name: "not compressible", accept: "gzip", contentType: "image/png", body: large},
+		{name: "problem json", accept: "gzip", contentType: "application/problem+json", body: large, wantEncoding: "gzip"},
+		{name: "head", method: http.MethodHead, accept: "gzip", contentType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			engine := gin.New()
+			engine.Use(CompressionMiddleware(256, gzip.DefaultCompression, true))
+			engine.Handle(method, "/payments", func(c *gin.Context) {
+				c.Data(http.StatusOK, tt.contentType, []byte(tt.body))
+			})
+			req := httptest.NewRequest(method, "/payments", nil)
+			req.Header.Set("Accept-Encoding", tt.accept)
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200", recorder.Code)
+			}
+			if got := recorder.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Errorf("Content-Encoding %q, want %q", got, tt.wantEncoding)
+			}
+			if got := recorder.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+				t.Errorf("Vary %q, want Accept-Encoding", got)
+			}
+			if got := decode(t, tt.wantEncoding, recorder.Body.Bytes()); got != tt.body {
+				t.Errorf("decoded body %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+func TestBufferedWriter(t *testing.T) {
+	body := strings.Repeat("a", 512)
+	engine := gin.New()
+	engine.Use(CompressionMiddleware(256, gzip.DefaultCompression, false))
+	engine.GET("/payments", func(c *gin.Context) {
+		if c.Writer.Written() || c.Writer.Size() != -1 {
+			t.Errorf("before writing: Written %v, Size %d, want false and -1", c.Writer.Written(), c.Writer.Size())
+		}
+		c.Status(http.StatusCreated)
+		if c.Writer.Status() != http.StatusCreated || c.Writer.Written() {
+			t.Errorf("after the status: Status %d, Written %v, want 201 and false", c.Writer.Status(), c.Writer.Written())
+		}
+		c.Data(http.StatusCreated, "text/plain", []byte(body))
+		c.Writer.WriteHeader(http.StatusAccepted)
+		if !c.Writer.Written() || c.Writer.Size() != len(body) || c.Writer.Status() != http.StatusCreated {
+			t.Errorf("after writing: Written %v, Size %d, Status %d, want true, %d and 201", c.Writer.Written(), c.Writer.Size(), c.Writer.Status(), len(body))
+		}
+	})
+	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusCreated || decode(t, "gzip", recorder.Body.Bytes()) != body {
+		t.Errorf("got %d, want 201 and the compressed body", recorder.Code)
+	}
+}
+
+func TestBufferedWriterStatusOnly(t *testing.T) {
+	engine := gin.New()
+	engine.Use(CompressionMiddleware(256, gzip.DefaultCompression, false))
+	engine.GET("/payments", func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusNotModified)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusNotModified || recorder.Body.Len() != 0 || recorder.Header().Get("Content-Encoding") != "" {
+		t.Errorf("got %d %q with Content-Encoding %q, want an empty 304", recorder.Code, recorder.Body, recorder.Header().Get("Content-Encoding"))
+	}
+}
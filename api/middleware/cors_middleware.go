@@ -23,8 +23,9 @@ func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
 		// Set CORS headers if the origin is allowed
 		if allowed {
 			c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+			c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+			c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 			c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		}
 
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"caaspay-api-go/internal/logging"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// DeprecationMiddleware announces a deprecated or retiring route with the Deprecation (RFC 9745),
+// Sunset (RFC 8594) and Link headers, and counts its usage. The metric is tagged by route and version
+// only; the client is in the log line, as a tag it would create a series per user.
+func DeprecationMiddleware(logger *logging.Logger, route, version string, deprecated bool, sunset time.Time, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deprecated {
+			c.Header("Deprecation", "true")
+		}
+		if !sunset.IsZero() {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if successor != "" {
+			c.Header("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		}
+
+		c.Next()
+
+		// Identify the client after authentication has run
+		client := c.ClientIP()
+		if claims, ok := c.Get("claims"); ok {
+			if claimMap, ok := claims.(map[string]interface{}); ok {
+				if userID, ok := claimMap["user_id"]; ok && userID != "" {
+					client = fmt.Sprint(userID)
+				}
+			}
+		}
+		logger.ForRequest(c).LogWithStats("info", "Deprecated route used", map[string]string{
+			"metric_name": "deprecated_route_usage",
+			"route":       route,
+			"version":     version,
+		}, map[string]interface{}{"client": client, "status_code": c.Writer.Status()})
+	}
+}
@@ -40,8 +40,9 @@ func SecurityHeadersMiddleware(allowedOrigins []string) gin.HandlerFunc {
 			}
 		}
 
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		// Handle preflight OPTIONS requests
@@ -81,7 +82,7 @@ func CloudflareMiddleware(logger *logging.Logger, cfg *config.Config) gin.Handle
 		}
 
 		// Log request with Cloudflare headers
-		logger.LogWithStats("info", "Incoming request",
+		logger.ForRequest(c).LogWithStats("info", "Incoming request",
 			map[string]string{"path": c.Request.URL.Path, "method": c.Request.Method},
 			map[string]interface{}{"cloudflare_headers": cfHeaders},
 		)
@@ -101,7 +102,7 @@ func CloudflareMiddleware(logger *logging.Logger, cfg *config.Config) gin.Handle
 
 		// Log the status after response
 		status := c.Writer.Status()
-		logger.LogWithStats("info", "Request completed",
+		logger.ForRequest(c).LogWithStats("info", "Request completed",
 			map[string]string{"status": http.StatusText(status), "status_code": fmt.Sprintf("%d", status)},
 			map[string]interface{}{"cloudflare_headers": cfHeaders},
 		)
@@ -2,8 +2,11 @@ package middleware
 
 import (
 	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
 	"caaspay-api-go/internal/auth"
+	"errors"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 	"net/http"
 	"strings"
 )
@@ -15,8 +18,7 @@ func JWTAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		// Validate token presence and format
 		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing or malformed"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthMissing, "Authorization header missing or malformed")
 			return
 		}
 		tokenString = tokenString[7:] // Remove "Bearer " prefix
@@ -24,14 +26,18 @@ func JWTAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		// Parse and validate JWT token
 		claims, err := auth.ParseJWTToken(cfg, tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				problem.Abort(c, http.StatusUnauthorized, problem.AuthExpired, "Token has expired")
+				return
+			}
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthInvalid, "Invalid token")
 			return
 		}
 
 		// Store user information in context
 		c.Set("userID", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("claims", map[string]interface{}{"user_id": claims.UserID, "role": claims.Role})
 
 		c.Next() // Continue to the next handler
 	}
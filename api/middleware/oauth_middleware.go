@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
 	"context"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/oauth2"
@@ -25,8 +26,7 @@ func OAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 		tokenString := c.GetHeader("Authorization")
 
 		if tokenString == "" || !strings.HasPrefix(tokenString, "Bearer ") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing or malformed"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthMissing, "Authorization header missing or malformed")
 			return
 		}
 
@@ -39,8 +39,7 @@ func OAuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 
 		_, err := tokenSource.Token()
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid OAuth token"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.AuthInvalid, "Invalid OAuth token")
 			return
 		}
 
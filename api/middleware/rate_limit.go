@@ -1,31 +1,44 @@
 package middleware
 
 import (
+	"caaspay-api-go/api/problem"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
+	"math"
 	"net/http"
+	"strconv"
 	"sync"
 )
 
-// rateLimiterStore holds the rate limiters for each route path.
+// rateLimiterStore holds the rate limiters for each route, keyed by method and path.
 var rateLimiterStore = sync.Map{}
 
-// getOrCreateRateLimiter creates or retrieves a rate limiter for a given path.
+// getOrCreateRateLimiter creates or retrieves a rate limiter for a given route key.
+// An existing limiter keeps its state but takes the given limit and burst, so a config reload applies new limits.
 func getOrCreateRateLimiter(path string, limit rate.Limit, burst int) *rate.Limiter {
 	if val, exists := rateLimiterStore.Load(path); exists {
-		return val.(*rate.Limiter)
+		limiter := val.(*rate.Limiter)
+		if limiter.Limit() != limit {
+			limiter.SetLimit(limit)
+		}
+		if limiter.Burst() != burst {
+			limiter.SetBurst(burst)
+		}
+		return limiter
 	}
 	limiter := rate.NewLimiter(limit, burst)
 	rateLimiterStore.Store(path, limiter)
 	return limiter
 }
 
-// RateLimitMiddleware returns a Gin middleware that applies rate limiting to each route based on its path.
+// RateLimitMiddleware returns a Gin middleware that applies rate limiting to each route based on its key (e.g. "GET /payments").
 func RateLimitMiddleware(path string, requestsPerSecond int, burst int) gin.HandlerFunc {
 	limiter := getOrCreateRateLimiter(path, rate.Limit(requestsPerSecond), burst)
 	return func(c *gin.Context) {
 		if !limiter.Allow() {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			// Seconds until the next token, at least one
+			c.Header("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(1/float64(limiter.Limit()))))))
+			problem.Abort(c, http.StatusTooManyRequests, problem.RateLimited, "Rate limit exceeded")
 			return
 		}
 		c.Next()
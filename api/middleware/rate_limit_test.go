@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"caaspay-api-go/api/problem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		burst    int
+		requests int
+		allowed  int
+	}{
+		{"within burst", 1, 3, 3, 3},
+		{"over burst", 1, 2, 4, 2},
+		{"high limit", 1000, 1, 2, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := "GET /payments " + tt.name
+			rateLimiterStore.Delete(key) // Limiters outlive a test run
+			engine := gin.New()
+			engine.GET("/payments", RateLimitMiddleware(key, tt.limit, tt.burst), func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			})
+
+			allowed := 0
+			for i := 0; i < tt.requests; i++ {
+				recorder := httptest.NewRecorder()
+				engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/payments", nil))
+				if recorder.Code == http.StatusNoContent {
+					allowed++
+					continue
+				}
+				if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Content-Type") != problem.ContentType ||
+					!strings.Contains(recorder.Body.String(), `"code":"RATE_LIMITED"`) {
+					t.Fatalf("request %d: got %d %s, want a 429 problem", i, recorder.Code, recorder.Body)
+				}
+				if got := recorder.Header().Get("Retry-After"); got != "1" {
+					t.Errorf("request %d: Retry-After %q, want 1", i, got)
+				}
+			}
+			if allowed != tt.allowed {
+				t.Errorf("%d requests allowed, want %d", allowed, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRateLimiterTakesNewLimits(t *testing.T) {
+	rateLimiterStore.Delete("GET /reloaded")
+	limiter := getOrCreateRateLimiter("GET /reloaded", rate.Limit(1), 1)
+	if again := getOrCreateRateLimiter("GET /reloaded", rate.Limit(5), 10); again != limiter {
+		t.Fatal("a new limiter was created for the same route")
+	}
+	if limiter.Limit() != rate.Limit(5) || limiter.Burst() != 10 {
+		t.Errorf("limit %v burst %d, want 5 and 10", limiter.Limit(), limiter.Burst())
+	}
+}
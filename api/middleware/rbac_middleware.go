@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"caaspay-api-go/api/problem"
 	"github.com/gin-gonic/gin"
 	"net/http"
 )
@@ -9,8 +10,7 @@ func RBACMiddleware(allowedRoles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, exists := c.Get("role")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Role not found"})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, problem.ClaimMissing, "Role not found")
 			return
 		}
 
@@ -22,7 +22,6 @@ func RBACMiddleware(allowedRoles ...string) gin.HandlerFunc {
 			}
 		}
 
-		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have permission to access this resource"})
-		c.Abort()
+		problem.Abort(c, http.StatusForbidden, problem.Forbidden, "You do not have permission to access this resource")
 	}
 }
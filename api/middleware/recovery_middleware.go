@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"caaspay-api-go/api/problem"
+	"caaspay-api-go/internal/logging"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RecoveryMiddleware answers a request whose handler panicked with a 500 problem rather than gin's
+// plain text response. The panic and its stack are logged under the error ID sent to the client.
+func RecoveryMiddleware(logger *logging.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// Deliberate abort, the server drops the connection
+				panic(recovered)
+			}
+
+			errorID := uuid.New().String()
+			logger.ForRequest(c).LogWithStats("error", "Request handler panicked", map[string]string{
+				"metric_name": "request_panic",
+				"route":       c.Request.Method + " " + c.FullPath(),
+			}, map[string]interface{}{"error_id": errorID, "panic": fmt.Sprint(recovered), "stack": string(debug.Stack())})
+
+			if c.Writer.Written() {
+				// Too late for a problem response, the status and part of the body are sent
+				c.Abort()
+				return
+			}
+			panicProblem := problem.New(http.StatusInternalServerError, problem.InternalError, "an unexpected error occurred")
+			panicProblem.ErrorID = errorID
+			problem.Write(c, panicProblem)
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength bounds client supplied request IDs, longer ones are replaced
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID, taken from X-Request-ID, else from CF-Ray, else
+// generated. It is stored as request_id in the context, returned in the X-Request-ID header and
+// recorded on the trace span, so logs, error bodies and service calls share it.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			id = c.GetHeader("CF-Ray")
+		}
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set("request_id", id)
+		c.Header("X-Request-ID", id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("request.id", id))
+
+		c.Next()
+	}
+}
+
+// validRequestID accepts IDs of letters, digits and -_.: only, so they are safe to log and forward
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		cfRay     string
+		want      string // Empty when a new ID is expected
+	}{
+		{name: "client ID", requestID: "req-1_a.b:c", cfRay: "8f1c2d3e4f5a6b7c-AMS", want: "req-1_a.b:c"},
+		{name: "cloudflare ray", cfRay: "8f1c2d3e4f5a6b7c-AMS", want: "8f1c2d3e4f5a6b7c-AMS"},
+		{name: "invalid client ID", requestID: "req 1\r\nX-Injected: yes", cfRay: "8f1c2d3e4f5a6b7c-AMS", want: "8f1c2d3e4f5a6b7c-AMS"},
+		{name: "generated"},
+		{name: "invalid characters", requestID: "<script>"},
+		{name: "too long", requestID: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "longest accepted", requestID: strings.Repeat("a", maxRequestIDLength), want: strings.Repeat("a", maxRequestIDLength)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored string
+			engine := gin.New()
+			engine.Use(RequestIDMiddleware())
+			engine.GET("/payments", func(c *gin.Context) {
+				stored = c.GetString("request_id")
+				c.Status(http.StatusNoContent)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.requestID != "" {
+				req.Header["X-Request-Id"] = []string{tt.requestID}
+			}
+			if tt.cfRay != "" {
+				req.Header.Set("CF-Ray", tt.cfRay)
+			}
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			got := recorder.Header().Get("X-Request-ID")
+			if got != stored {
+				t.Errorf("header %q, context %q, want the same ID", got, stored)
+			}
+			if tt.want != "" {
+				if got != tt.want {
+					t.Errorf("got ID %q, want %q", got, tt.want)
+				}
+			} else if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("got ID %q, want a generated UUID", got)
+			}
+		})
+	}
+}
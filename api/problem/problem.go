@@ -0,0 +1,159 @@
+package problem
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code is a stable, machine-readable error code. Clients branch on it, so codes are never renamed.
+type Code string
+
+const (
+	ParamMissing   Code = "PARAM_MISSING"    // A required parameter was not sent
+	ParamInvalid   Code = "PARAM_INVALID"    // A parameter has the wrong type or breaks a constraint
+	ParamUnknown   Code = "PARAM_UNKNOWN"    // A parameter the route doesn't declare was rejected
+	BodyInvalid    Code = "BODY_INVALID"     // The request body can't be parsed
+	BodyTooLarge   Code = "BODY_TOO_LARGE"   // The request body exceeds the route's size limit
+	BodyTooComplex Code = "BODY_TOO_COMPLEX" // The request body exceeds the route's depth, key or string length limits
+	AuthMissing    Code = "AUTH_MISSING"     // No credentials were sent
+	AuthInvalid    Code = "AUTH_INVALID"     // The credentials are malformed, badly signed or unknown
+	AuthExpired    Code = "AUTH_EXPIRED"     // The token has expired
+	ClaimMissing   Code = "CLAIM_MISSING"    // The token lacks a claim the route requires
+	Forbidden      Code = "FORBIDDEN"        // The caller's role may not use the route
+	RateLimited    Code = "RATE_LIMITED"     // Too many requests, retry later
+	NotFound       Code = "NOT_FOUND"        // No such route or resource
+	NotAcceptable  Code = "NOT_ACCEPTABLE"   // The route can't answer in any format the client accepts
+	NotImplemented Code = "NOT_IMPLEMENTED"  // The route has no backend yet, e.g. a missing mock
+
+	ServiceBusy      Code = "SERVICE_BUSY"       // No RPC client became available in time
+	UpstreamError    Code = "UPSTREAM_ERROR"     // The service or upstream failed or can't be reached
+	UpstreamTimeout  Code = "UPSTREAM_TIMEOUT"   // The service or upstream didn't answer in time
+	UpstreamInvalid  Code = "UPSTREAM_INVALID"   // The service response breaks the route's contract
+	UpstreamTooLarge Code = "UPSTREAM_TOO_LARGE" // The upstream response exceeds the route's limit
+	MockError        Code = "MOCK_ERROR"         // Error injected by a route mock
+	InternalError    Code = "INTERNAL_ERROR"     // Unexpected gateway error
+)
+
+// titles are the short, fixed summaries of each code
+var titles = map[Code]string{
+	ParamMissing:     "Missing parameter",
+	ParamInvalid:     "Invalid parameter",
+	ParamUnknown:     "Unknown parameter",
+	BodyInvalid:      "Invalid request body",
+	BodyTooLarge:     "Request body too large",
+	BodyTooComplex:   "Request body too complex",
+	AuthMissing:      "Authentication required",
+	AuthInvalid:      "Invalid credentials",
+	AuthExpired:      "Token expired",
+	ClaimMissing:     "Missing token claim",
+	Forbidden:        "Forbidden",
+	RateLimited:      "Too many requests",
+	NotFound:         "Not found",
+	NotAcceptable:    "Not acceptable",
+	NotImplemented:   "Not implemented",
+	ServiceBusy:      "Service busy",
+	UpstreamError:    "Upstream service error",
+	UpstreamTimeout:  "Upstream service timeout",
+	UpstreamInvalid:  "Invalid upstream response",
+	UpstreamTooLarge: "Upstream response too large",
+	MockError:        "Mock error",
+	InternalError:    "Internal error",
+}
+
+// ContentType is the media type of problem responses (RFC 7807)
+const ContentType = "application/problem+json"
+
+// docsKey is the context key holding the base URL of the error documentation
+const docsKey = "problem_docs_url"
+
+// FieldError details one offending request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object, extended with a stable code, the request ID and
+// per-field errors. It is also an error, so validation code can return it as is.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	ErrorID   string       `json:"error_id,omitempty"` // Correlates the response with the gateway logs
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// New creates a problem with the given status, code and human-readable detail
+func New(status int, code Code, detail string) *Problem {
+	return &Problem{Status: status, Code: code, Detail: detail}
+}
+
+// Field creates a 400 problem about a single request field
+func Field(code Code, field, detail string) *Problem {
+	return &Problem{
+		Status: http.StatusBadRequest,
+		Code:   code,
+		Detail: detail,
+		Errors: []FieldError{{Field: field, Code: code, Message: detail}},
+	}
+}
+
+// Error returns the detail, or the title when there is none
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return titles[p.Code]
+}
+
+// Docs is a middleware recording the base URL of the error documentation. Each problem's type then
+// links to <url>/<code>, e.g. https://docs.example.com/errors/param-missing.
+func Docs(url string) gin.HandlerFunc {
+	url = strings.TrimSuffix(url, "/")
+	return func(c *gin.Context) {
+		if url != "" {
+			c.Set(docsKey, url)
+		}
+		c.Next()
+	}
+}
+
+// Write completes the problem with its type, title, request path and request ID, sends it as
+// application/problem+json and aborts the request
+func Write(c *gin.Context, p *Problem) {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Code == "" {
+		p.Code = InternalError
+	}
+	if p.Title == "" {
+		p.Title = titles[p.Code]
+	}
+	if p.Type == "" {
+		p.Type = "about:blank"
+		if docs := c.GetString(docsKey); docs != "" {
+			p.Type = docs + "/" + strings.ReplaceAll(strings.ToLower(string(p.Code)), "_", "-")
+		}
+	}
+	if p.Instance == "" && c.Request != nil {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = c.GetString("request_id")
+	}
+
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
+
+// Abort sends a problem with the given status, code and detail and aborts the request
+func Abort(c *gin.Context, status int, code Code, detail string) {
+	Write(c, New(status, code, detail))
+}
@@ -0,0 +1,95 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		problem *Problem
+		docs    string
+		want    Problem
+	}{
+		{
+			name:    "defaults",
+			problem: New(http.StatusNotFound, NotFound, "no such payment"),
+			want:    Problem{Type: "about:blank", Title: "Not found", Status: 404, Detail: "no such payment", Instance: "/payments/pay_1", Code: NotFound, RequestID: "req-1"},
+		},
+		{
+			name:    "documentation link",
+			problem: New(http.StatusServiceUnavailable, ServiceBusy, "all clients are busy"),
+			docs:    "https://docs.example.com/errors/",
+			want:    Problem{Type: "https://docs.example.com/errors/service-busy", Title: "Service busy", Status: 503, Detail: "all clients are busy", Instance: "/payments/pay_1", Code: ServiceBusy, RequestID: "req-1"},
+		},
+		{
+			name:    "field error",
+			problem: Field(ParamMissing, "amount", "missing required parameter: amount"),
+			want: Problem{Type: "about:blank", Title: "Missing parameter", Status: 400, Detail: "missing required parameter: amount", Instance: "/payments/pay_1", Code: ParamMissing, RequestID: "req-1",
+				Errors: []FieldError{{Field: "amount", Code: ParamMissing, Message: "missing required parameter: amount"}}},
+		},
+		{
+			name:    "empty problem",
+			problem: &Problem{},
+			want:    Problem{Type: "about:blank", Title: "Internal error", Status: 500, Instance: "/payments/pay_1", Code: InternalError, RequestID: "req-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.Use(Docs(tt.docs))
+			engine.GET("/payments/:id", func(c *gin.Context) {
+				c.Set("request_id", "req-1")
+				Write(c, tt.problem)
+			})
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/payments/pay_1", nil))
+
+			if recorder.Code != tt.want.Status || recorder.Header().Get("Content-Type") != ContentType {
+				t.Errorf("got %d %q, want %d %s", recorder.Code, recorder.Header().Get("Content-Type"), tt.want.Status, ContentType)
+			}
+			var got Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid body %s: %v", recorder.Body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemIsAnError(t *testing.T) {
+	var err error = fmt.Errorf("validating: %w", New(http.StatusBadRequest, ParamInvalid, ""))
+	var p *Problem
+	if !errors.As(err, &p) || p.Code != ParamInvalid {
+		t.Fatalf("errors.As found %v, want the wrapped problem", p)
+	}
+	if p.Error() != "Invalid parameter" {
+		t.Errorf("Error() = %q, want the title when there is no detail", p.Error())
+	}
+}
+
+func TestCodesHaveTitles(t *testing.T) {
+	codes := []Code{
+		ParamMissing, ParamInvalid, ParamUnknown, BodyInvalid, BodyTooLarge, BodyTooComplex, AuthMissing, AuthInvalid,
+		AuthExpired, ClaimMissing, Forbidden, RateLimited, NotFound, NotAcceptable, NotImplemented, ServiceBusy,
+		UpstreamError, UpstreamTimeout, UpstreamInvalid, UpstreamTooLarge, MockError, InternalError,
+	}
+	if len(codes) != len(titles) {
+		t.Errorf("%d codes listed, %d titles", len(codes), len(titles))
+	}
+	for _, code := range codes {
+		if titles[code] == "" {
+			t.Errorf("code %s has no title", code)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package routes
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// ArgMapping builds one entry of the args passed to the service from a request param,
+// an auth claim, a context value or a constant
+type ArgMapping struct {
+	Name     string      `mapstructure:"name"`     // Target arg; dots nest it (e.g. "payer.id")
+	From     string      `mapstructure:"from"`     // param (default), claim, context or const
+	Source   string      `mapstructure:"source"`   // Param name, claim name or context key to read; defaults to Name
+	Value    interface{} `mapstructure:"value"`    // Value injected by from: const
+	Required bool        `mapstructure:"required"` // Reject the request when a claim or context value is missing
+}
+
+// missingArgError is a required claim or context value that isn't set for the request
+type missingArgError struct {
+	mapping ArgMapping
+}
+
+func (e *missingArgError) Error() string {
+	return fmt.Sprintf("missing %s %s for arg %s", e.mapping.From, e.mapping.Source, e.mapping.Name)
+}
+
+// argSources lists the valid values of an arg mapping's `from` field
+var argSources = map[string]bool{
+	"param":   true,
+	"claim":   true,
+	"context": true,
+	"const":   true,
+}
+
+// prepareArgs fills in the defaults of a route's arg mappings and checks them against its params
+func prepareArgs(route *RouteConfig) error {
+	declared := map[string]bool{}
+	for _, param := range route.Params {
+		declared[param.Name] = true
+	}
+
+	for i := range route.Args {
+		mapping := &route.Args[i]
+		if mapping.Name == "" {
+			return fmt.Errorf("arg %d: missing name", i)
+		}
+		if mapping.From == "" {
+			mapping.From = "param"
+		}
+		if !argSources[mapping.From] {
+			return fmt.Errorf("arg %s: unknown source %q", mapping.Name, mapping.From)
+		}
+		if mapping.Source == "" && mapping.From != "const" {
+			mapping.Source = mapping.Name
+		}
+		if mapping.From == "param" && !declared[mapping.Source] {
+			return fmt.Errorf("arg %s: param %s is not declared", mapping.Name, mapping.Source)
+		}
+		if mapping.From == "const" && mapping.Value == nil {
+			return fmt.Errorf("arg %s: const requires a value", mapping.Name)
+		}
+	}
+	return nil
+}
+
+// buildArgs applies the route's arg mappings to the validated params and returns the args for the service.
+//
+// Params not mentioned in a mapping are passed as they are; mapped params move to their new name.
+// Values injected from claims, context or constants are applied last, so a client can never
+// override them by sending a param of the same name.
+func buildArgs(c *gin.Context, routeConfig RouteConfig, params map[string]interface{}) (map[string]interface{}, error) {
+	if len(routeConfig.Args) == 0 {
+		return params, nil
+	}
+
+	args := make(map[string]interface{}, len(params))
+	for name, value := range params {
+		args[name] = value
+	}
+
+	// Renames and nesting of client params
+	for _, mapping := range routeConfig.Args {
+		if mapping.From != "param" {
+			continue
+		}
+		value, exists := params[mapping.Source]
+		if mapping.Name == mapping.Source {
+			continue
+		}
+		delete(args, mapping.Source)
+		if exists {
+			setArg(args, mapping.Name, value)
+		}
+	}
+
+	// Injected values take precedence over anything the client sent
+	for _, mapping := range routeConfig.Args {
+		var value interface{}
+		var exists bool
+		switch mapping.From {
+		case "const":
+			value, exists = mapping.Value, true
+		case "claim":
+			if claims, ok := c.Get("claims"); ok {
+				if claimMap, ok := claims.(map[string]interface{}); ok {
+					value, exists = claimMap[mapping.Source]
+				}
+			}
+		case "context":
+			value, exists = c.Get(mapping.Source)
+		default:
+			continue
+		}
+
+		if !exists || value == nil || value == "" {
+			if mapping.Required {
+				return nil, &missingArgError{mapping: mapping}
+			}
+			// Make sure a client-supplied value can't stand in for the missing one
+			deleteArg(args, mapping.Name)
+			continue
+		}
+		setArg(args, mapping.Name, value)
+	}
+
+	return args, nil
+}
+
+// setArg sets a value at a dotted path, creating nested objects as needed
+func setArg(args map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	current := args
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			current[key] = next
+		}
+		current = next
+	}
+	current[keys[len(keys)-1]] = value
+}
+
+// deleteArg removes the value at a dotted path, if present
+func deleteArg(args map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	current := args
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		current = next
+	}
+	delete(current, keys[len(keys)-1])
+}
@@ -0,0 +1,153 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []ArgMapping
+		params   map[string]interface{}
+		claims   map[string]interface{}
+		context  map[string]interface{}
+		want     map[string]interface{}
+		wantFrom string // Source of the missing value error
+	}{
+		{
+			name:   "no mappings",
+			params: map[string]interface{}{"amount": "10.00"},
+			want:   map[string]interface{}{"amount": "10.00"},
+		},
+		{
+			name:   "rename and nest",
+			args:   []ArgMapping{{Name: "payer.email", From: "param", Source: "email"}, {Name: "amount", From: "param", Source: "amount"}},
+			params: map[string]interface{}{"email": "a@example.com", "amount": "10.00"},
+			want:   map[string]interface{}{"payer": map[string]interface{}{"email": "a@example.com"}, "amount": "10.00"},
+		},
+		{
+			name:   "claim overrides a client param",
+			args:   []ArgMapping{{Name: "merchant_id", From: "claim", Source: "sub"}},
+			params: map[string]interface{}{"merchant_id": "spoofed", "amount": "10.00"},
+			claims: map[string]interface{}{"sub": "MERCHANT-1"},
+			want:   map[string]interface{}{"merchant_id": "MERCHANT-1", "amount": "10.00"},
+		},
+		{
+			name:   "const overrides a nested client param",
+			args:   []ArgMapping{{Name: "payer.channel", From: "const", Value: "api"}, {Name: "payer", From: "param"}},
+			params: map[string]interface{}{"payer": map[string]interface{}{"channel": "spoofed", "email": "a@example.com"}},
+			want:   map[string]interface{}{"payer": map[string]interface{}{"channel": "api", "email": "a@example.com"}},
+		},
+		{
+			name:    "context value",
+			args:    []ArgMapping{{Name: "client_ip", From: "context", Source: "client_ip"}},
+			params:  map[string]interface{}{},
+			context: map[string]interface{}{"client_ip": "203.0.113.7"},
+			want:    map[string]interface{}{"client_ip": "203.0.113.7"},
+		},
+		{
+			name:   "missing optional claim removes the client value",
+			args:   []ArgMapping{{Name: "merchant_id", From: "claim", Source: "sub"}},
+			params: map[string]interface{}{"merchant_id": "spoofed", "amount": "10.00"},
+			want:   map[string]interface{}{"amount": "10.00"},
+		},
+		{
+			name:   "empty optional claim removes the nested client value",
+			args:   []ArgMapping{{Name: "payer.id", From: "claim", Source: "sub"}},
+			params: map[string]interface{}{"payer": map[string]interface{}{"id": "spoofed", "email": "a@example.com"}},
+			claims: map[string]interface{}{"sub": ""},
+			want:   map[string]interface{}{"payer": map[string]interface{}{"email": "a@example.com"}},
+		},
+		{
+			name:     "missing required claim",
+			args:     []ArgMapping{{Name: "merchant_id", From: "claim", Source: "sub", Required: true}},
+			params:   map[string]interface{}{"merchant_id": "spoofed"},
+			wantFrom: "claim",
+		},
+		{
+			name:     "missing required context value",
+			args:     []ArgMapping{{Name: "client_ip", From: "context", Source: "client_ip", Required: true}},
+			params:   map[string]interface{}{},
+			wantFrom: "context",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routeConfig := RouteConfig{Args: tt.args}
+			for name := range tt.params {
+				routeConfig.Params = append(routeConfig.Params, ParamConfig{Name: name})
+			}
+			for _, mapping := range tt.args {
+				if mapping.From == "param" {
+					routeConfig.Params = append(routeConfig.Params, ParamConfig{Name: mapping.Source})
+				}
+			}
+			if err := prepareArgs(&routeConfig); err != nil {
+				t.Fatalf("prepareArgs failed: %v", err)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tt.claims != nil {
+				c.Set("claims", tt.claims)
+			}
+			for key, value := range tt.context {
+				c.Set(key, value)
+			}
+
+			args, err := buildArgs(c, routeConfig, tt.params)
+			if tt.wantFrom != "" {
+				var missing *missingArgError
+				if !errors.As(err, &missing) || missing.mapping.From != tt.wantFrom {
+					t.Fatalf("got %v, %v, want a missing %s error", args, err, tt.wantFrom)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildArgs failed: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("args %#v, want %#v", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingArgStatus(t *testing.T) {
+	tests := []struct {
+		from       string
+		wantStatus int
+		wantCode   problem.Code
+	}{
+		{from: "claim", wantStatus: http.StatusUnauthorized, wantCode: problem.ClaimMissing},
+		{from: "context", wantStatus: http.StatusInternalServerError, wantCode: problem.InternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from, func(t *testing.T) {
+			route := prepareTestRoute(t, RouteConfig{
+				Path: "/payments",
+				Type: http.MethodGet,
+				Args: []ArgMapping{{Name: "merchant_id", From: tt.from, Source: "merchant_id", Required: true}},
+				Mock: &MockConfig{Enabled: true, Response: map[string]interface{}{"ok": true}},
+			})
+			recorder := serveRoute(route, httptest.NewRequest(http.MethodGet, "/payments", nil), func(c *gin.Context) {
+				c.Set("claims", map[string]interface{}{"sub": "user-1"})
+			})
+
+			var body problem.Problem
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || recorder.Code != tt.wantStatus || body.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want a %d %s problem", recorder.Code, recorder.Body, tt.wantStatus, tt.wantCode)
+			}
+			if tt.from == "context" && (body.ErrorID == "" || strings.Contains(body.Detail, "merchant_id")) {
+				t.Errorf("body %s, want an error ID and no internal detail", recorder.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package routes
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyLimitError is a request body rejected by the route's limits. It wraps the problem sent to
+// the client and keeps the limit that was hit for the rejection metrics.
+type bodyLimitError struct {
+	reason  string // size, depth, keys or string_length
+	problem *problem.Problem
+}
+
+func (e *bodyLimitError) Error() string {
+	return e.problem.Error()
+}
+
+func (e *bodyLimitError) Unwrap() error {
+	return e.problem
+}
+
+// tooComplex creates the error of a body breaking a depth, key or string length limit
+func tooComplex(reason, detail string) *bodyLimitError {
+	return &bodyLimitError{reason: reason, problem: problem.New(http.StatusBadRequest, problem.BodyTooComplex, detail)}
+}
+
+// tooLarge creates the error of a body exceeding the size limit
+func tooLarge(maxBytes int64) *bodyLimitError {
+	return &bodyLimitError{reason: "size", problem: problem.New(http.StatusRequestEntityTooLarge, problem.BodyTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytes))}
+}
+
+// prepareBodyLimits fills in the body limits a route leaves unset from the global ones. Multipart
+// routes default max_bytes to the room their files need rather than the global JSON limit; it runs
+// after prepareFileParams for that.
+func prepareBodyLimits(cfg *config.Config, route *RouteConfig) error {
+	limits := &route.BodyLimits
+	if limits.MaxBytes < 0 || limits.MaxDepth < 0 || limits.MaxKeys < 0 || limits.MaxStringLength < 0 {
+		return fmt.Errorf("limits must be positive")
+	}
+	if limits.MaxBytes == 0 && route.multipart {
+		limits.MaxBytes = route.maxBodySize
+	}
+	if limits.MaxBytes == 0 {
+		limits.MaxBytes = cfg.BodyLimits.MaxBytes
+	}
+	if limits.MaxDepth == 0 {
+		limits.MaxDepth = cfg.BodyLimits.MaxDepth
+	}
+	if limits.MaxKeys == 0 {
+		limits.MaxKeys = cfg.BodyLimits.MaxKeys
+	}
+	if limits.MaxStringLength == 0 {
+		limits.MaxStringLength = cfg.BodyLimits.MaxStringLength
+	}
+	return nil
+}
+
+// readJSONBody decodes a JSON object body token by token, enforcing the route's limits as it goes,
+// so an oversized or deeply nested body is rejected before it is held in memory. Numbers are kept
+// as json.Number so amounts and large IDs never go through float64.
+func readJSONBody(c *gin.Context, routeConfig RouteConfig) (map[string]interface{}, error) {
+	limits := routeConfig.BodyLimits
+	if c.Request.ContentLength > limits.MaxBytes {
+		return nil, tooLarge(limits.MaxBytes)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxBytes)
+
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.UseNumber()
+	reader := &bodyReader{decoder: decoder, limits: limits}
+	body, err := reader.object(0)
+	if err == nil {
+		err = reader.end()
+	}
+	if err != nil {
+		var limitErr *bodyLimitError
+		if errors.As(err, &limitErr) {
+			return nil, limitErr
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, tooLarge(limits.MaxBytes)
+		}
+		// The decoder's message is not shown, it describes Go types rather than the request
+		return nil, problem.New(http.StatusBadRequest, problem.BodyInvalid, "request body must be a JSON object")
+	}
+	return body, nil
+}
+
+// bodyReader builds a JSON body from the decoder's tokens, counting keys across the whole body
+type bodyReader struct {
+	decoder *json.Decoder
+	limits  config.BodyLimitsConfig
+	keys    int
+}
+
+// object reads an object, expecting its opening brace next
+func (r *bodyReader) object(depth int) (map[string]interface{}, error) {
+	token, err := r.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, fmt.Errorf("expected an object")
+	}
+	value, err := r.compound('{', depth+1)
+	if err != nil {
+		return nil, err
+	}
+	return value.(map[string]interface{}), nil
+}
+
+// end expects the body to end after the top-level object, apart from whitespace
+func (r *bodyReader) end() error {
+	_, err := r.decoder.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("unexpected data after the object")
+	}
+	return err
+}
+
+// value reads any JSON value
+func (r *bodyReader) value(depth int) (interface{}, error) {
+	token, err := r.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := token.(type) {
+	case json.Delim:
+		return r.compound(v, depth+1)
+	case string:
+		if err := r.checkString(v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// compound reads the rest of an object or array whose opening delimiter has been read
+func (r *bodyReader) compound(delim json.Delim, depth int) (interface{}, error) {
+	if depth > r.limits.MaxDepth {
+		return nil, tooComplex("depth", fmt.Sprintf("request body is nested deeper than %d levels", r.limits.MaxDepth))
+	}
+
+	if delim == '[' {
+		array := []interface{}{}
+		for r.decoder.More() {
+			item, err := r.value(depth)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+		_, err := r.decoder.Token()
+		return array, err
+	}
+
+	object := map[string]interface{}{}
+	for r.decoder.More() {
+		token, err := r.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+		r.keys++
+		if r.keys > r.limits.MaxKeys {
+			return nil, tooComplex("keys", fmt.Sprintf("request body has more than %d keys", r.limits.MaxKeys))
+		}
+		if err := r.checkString(key); err != nil {
+			return nil, err
+		}
+		if object[key], err = r.value(depth); err != nil {
+			return nil, err
+		}
+	}
+	_, err := r.decoder.Token()
+	return object, err
+}
+
+// checkString enforces the string length limit, in characters, on keys and values
+func (r *bodyReader) checkString(s string) error {
+	if len(s) > r.limits.MaxStringLength && utf8.RuneCountInString(s) > r.limits.MaxStringLength {
+		return tooComplex("string_length", fmt.Sprintf("request body has a string longer than %d characters", r.limits.MaxStringLength))
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package routes
+
+import (
+	"bytes"
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testBodyLimits are small limits the bodies below are measured against
+var testBodyLimits = config.BodyLimitsConfig{MaxBytes: 256, MaxDepth: 3, MaxKeys: 5, MaxStringLength: 8}
+
+// bodyContext creates a request context with the given body; a negative length sends it chunked
+func bodyContext(body string, contentLength int64) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Request.ContentLength = contentLength
+	if contentLength < 0 {
+		// Hide the length so only the reader limit can catch the size
+		c.Request.Body = io.NopCloser(strings.NewReader(body))
+	}
+	return c
+}
+
+func TestReadJSONBody(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		wantStatus int
+		wantCode   problem.Code
+		wantReason string
+	}{
+		{name: "flat object", body: `{"amount":"10.00","currency":"USD"}`},
+		{name: "at max depth", body: `{"a":{"b":{"c":1}}}`},
+		{name: "too deep", body: `{"a":{"b":{"c":{"d":1}}}}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "depth"},
+		{name: "too deep in arrays", body: `{"a":[[[1]]]}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "depth"},
+		{name: "at max keys", body: `{"a":1,"b":2,"c":3,"d":4,"e":5}`},
+		{name: "too many keys", body: `{"a":1,"b":2,"c":3,"d":{"e":4,"f":5}}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "keys"},
+		{name: "at max string length", body: `{"a":"12345678"}`},
+		{name: "max string length counts characters", body: `{"a":"éééééééé"}`},
+		{name: "string too long", body: `{"a":"123456789"}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "string_length"},
+		{name: "key too long", body: `{"abcdefghi":1}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "string_length"},
+		{name: "string too long in array", body: `{"a":["ok","123456789"]}`, wantStatus: 400, wantCode: problem.BodyTooComplex, wantReason: "string_length"},
+		{name: "too large", body: `{"a":"` + strings.Repeat("x", 300) + `"}`, wantStatus: 413, wantCode: problem.BodyTooLarge, wantReason: "size"},
+		{name: "too large chunked", body: `{"a":[` + strings.Repeat("1,", 200) + `1]}`, chunked: true, wantStatus: 413, wantCode: problem.BodyTooLarge, wantReason: "size"},
+		{name: "not an object", body: `[1,2]`, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "invalid JSON", body: `{"a":`, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "empty", body: ``, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "trailing whitespace", body: "{\"a\":1}\n  "},
+		{name: "second object", body: `{"a":1}{"b":2}`, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "trailing value", body: `{"a":1} 2`, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "trailing garbage", body: `{"a":1}x`, wantStatus: 400, wantCode: problem.BodyInvalid},
+		{name: "trailing data too large", body: `{"a":1}` + strings.Repeat(" ", 300) + `{}`, chunked: true, wantStatus: 413, wantCode: problem.BodyTooLarge, wantReason: "size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentLength := int64(len(tt.body))
+			if tt.chunked {
+				contentLength = -1
+			}
+			c := bodyContext(tt.body, contentLength)
+			body, err := readJSONBody(c, RouteConfig{BodyLimits: testBodyLimits})
+			if tt.wantStatus == 0 {
+				if err != nil || body == nil {
+					t.Fatalf("got %v, %v, want the decoded body", body, err)
+				}
+				return
+			}
+
+			var bodyProblem *problem.Problem
+			if !errors.As(err, &bodyProblem) || bodyProblem.Status != tt.wantStatus || bodyProblem.Code != tt.wantCode {
+				t.Fatalf("got %v, want a %d %s problem", err, tt.wantStatus, tt.wantCode)
+			}
+			var limitErr *bodyLimitError
+			if tt.wantReason != "" && (!errors.As(err, &limitErr) || limitErr.reason != tt.wantReason) {
+				t.Fatalf("got %v, want a %s limit error", err, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestReadJSONBodyKeepsNumbers(t *testing.T) {
+	c := bodyContext(`{"amount":12345678901234567890.01,"items":[{"qty":3}]}`, -1)
+	limits := testBodyLimits
+	limits.MaxStringLength = 64
+	body, err := readJSONBody(c, RouteConfig{BodyLimits: limits})
+	if err != nil {
+		t.Fatalf("readJSONBody failed: %v", err)
+	}
+	if amount, ok := body["amount"].(json.Number); !ok || amount.String() != "12345678901234567890.01" {
+		t.Errorf("amount = %#v, want the exact json.Number", body["amount"])
+	}
+	item := body["items"].([]interface{})[0].(map[string]interface{})
+	if qty, ok := item["qty"].(json.Number); !ok || qty.String() != "3" {
+		t.Errorf("items[0].qty = %#v, want json.Number 3", item["qty"])
+	}
+}
+
+func TestMultipartBodyLimits(t *testing.T) {
+	cfg := &config.Config{BodyLimits: config.BodyLimitsConfig{MaxBytes: 1 << 20, MaxDepth: 32, MaxKeys: 1000, MaxStringLength: 65536}}
+	newRoute := func(maxBytes int64) RouteConfig {
+		route := RouteConfig{
+			Path:       "/kyc/documents",
+			Type:       http.MethodPost,
+			Params:     []ParamConfig{{Name: "document", Type: "file", In: "body", MaxSize: 4 << 20}},
+			BodyLimits: config.BodyLimitsConfig{MaxBytes: maxBytes},
+		}
+		if err := prepareFileParams(cfg, &route); err != nil {
+			t.Fatalf("prepareFileParams failed: %v", err)
+		}
+		if err := prepareBodyLimits(cfg, &route); err != nil {
+			t.Fatalf("prepareBodyLimits failed: %v", err)
+		}
+		return route
+	}
+
+	// Without its own max_bytes a multipart route makes room for its files
+	if route := newRoute(0); route.BodyLimits.MaxBytes != 5<<20 {
+		t.Errorf("default max_bytes = %d, want %d", route.BodyLimits.MaxBytes, 5<<20)
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("document", "passport.pdf")
+	part.Write(bytes.Repeat([]byte("%PDF-1.4 "), 2048))
+	writer.Close()
+	for _, tt := range []struct {
+		maxBytes   int64
+		wantStatus int
+	}{{maxBytes: 0}, {maxBytes: 4096, wantStatus: 413}} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/kyc/documents", bytes.NewReader(form.Bytes()))
+		c.Request.Header.Set("Content-Type", writer.FormDataContentType())
+		_, err := readMultipart(c, newRoute(tt.maxBytes))
+		var bodyProblem *problem.Problem
+		switch {
+		case tt.wantStatus == 0 && err != nil:
+			t.Errorf("max_bytes %d: got %v, want the form", tt.maxBytes, err)
+		case tt.wantStatus != 0 && (!errors.As(err, &bodyProblem) || bodyProblem.Status != tt.wantStatus):
+			t.Errorf("max_bytes %d: got %v, want a %d problem", tt.maxBytes, err, tt.wantStatus)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// decimalPattern matches plain decimal literals; exponents are rejected so the scale is explicit
+var decimalPattern = regexp.MustCompile(`^[+-]?[0-9]+(\.[0-9]+)?$`)
+
+// decimalValue is an exact decimal number kept as its digits, never as a float64
+type decimalValue struct {
+	negative bool
+	integer  string // Integer digits without leading zeros ("0" for zero)
+	fraction string // Fraction digits without trailing zeros
+}
+
+// parseDecimal reads a decimal from a JSON number or a string
+func parseDecimal(value interface{}) (decimalValue, error) {
+	var literal string
+	switch v := value.(type) {
+	case json.Number:
+		literal = v.String()
+	case string:
+		literal = strings.TrimSpace(v)
+	case int:
+		literal = strconv.Itoa(v)
+	case float64:
+		// Only reached for defaults declared in YAML; the shortest representation is the literal as written
+		literal = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return decimalValue{}, fmt.Errorf("unsupported type for decimal conversion: %v", reflect.TypeOf(value))
+	}
+	if !decimalPattern.MatchString(literal) {
+		return decimalValue{}, fmt.Errorf("invalid decimal: %s", literal)
+	}
+
+	d := decimalValue{}
+	if literal[0] == '-' || literal[0] == '+' {
+		d.negative = literal[0] == '-'
+		literal = literal[1:]
+	}
+	integer, fraction, _ := strings.Cut(literal, ".")
+	d.integer = strings.TrimLeft(integer, "0")
+	if d.integer == "" {
+		d.integer = "0"
+	}
+	d.fraction = strings.TrimRight(fraction, "0")
+	if d.integer == "0" && d.fraction == "" {
+		d.negative = false
+	}
+	return d, nil
+}
+
+// scale returns the number of significant decimal places
+func (d decimalValue) scale() int {
+	return len(d.fraction)
+}
+
+// precision returns the number of significant digits
+func (d decimalValue) precision() int {
+	if d.integer == "0" {
+		return len(strings.TrimLeft(d.fraction, "0"))
+	}
+	return len(d.integer) + len(d.fraction)
+}
+
+// format renders the decimal with exactly the given number of decimal places (at least the significant ones)
+func (d decimalValue) format(places int) string {
+	fraction := d.fraction
+	if len(fraction) < places {
+		fraction += strings.Repeat("0", places-len(fraction))
+	}
+	literal := d.integer
+	if fraction != "" {
+		literal += "." + fraction
+	}
+	if d.negative {
+		literal = "-" + literal
+	}
+	return literal
+}
+
+// minorUnits converts the decimal to an integer count of minor units for the given scale
+func (d decimalValue) minorUnits(scale int) (int64, error) {
+	digits := strings.TrimLeft(d.format(scale), "-")
+	units, err := strconv.ParseInt(strings.Replace(digits, ".", "", 1), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount out of range")
+	}
+	if d.negative {
+		units = -units
+	}
+	return units, nil
+}
+
+// rat returns the exact rational value of the decimal
+func (d decimalValue) rat() *big.Rat {
+	r, _ := new(big.Rat).SetString(d.format(0))
+	return r
+}
+
+// ratFromFloat converts a configured bound to a rational using its shortest decimal form,
+// so a minimum of 0.01 means exactly 1/100 rather than the nearest binary float
+func ratFromFloat(value float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(value, 'f', -1, 64))
+	return r
+}
+
+// validateDecimal checks decimal and money parameters and returns the value in the configured output form.
+// Money amounts take their scale from the ISO 4217 currency, either fixed or read from a sibling parameter.
+func validateDecimal(path string, param ParamConfig, paramValue interface{}, siblings map[string]interface{}) (interface{}, error) {
+	d, err := parseDecimal(paramValue)
+	if err != nil {
+		return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected decimal - %s", path, generateDescription(param))
+	}
+
+	scale := -1
+	if param.Scale != nil {
+		scale = *param.Scale
+	}
+	if param.Type == "money" {
+		currency := param.Currency
+		if currency == "" {
+			currency, _ = siblings[param.CurrencyParam].(string)
+		}
+		minorUnits, ok := currencyMinorUnits[currency]
+		if !ok {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: unknown currency %q - %s", path, currency, generateDescription(param))
+		}
+		scale = minorUnits
+	}
+
+	if scale >= 0 && d.scale() > scale {
+		return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: more than %d decimal places - %s", path, scale, generateDescription(param))
+	}
+	if param.Precision > 0 && d.precision() > param.Precision {
+		return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: more than %d significant digits - %s", path, param.Precision, generateDescription(param))
+	}
+	if param.Minimum != nil && d.rat().Cmp(ratFromFloat(*param.Minimum)) < 0 {
+		return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: less than minimum %v - %s", path, *param.Minimum, generateDescription(param))
+	}
+	if param.Maximum != nil && d.rat().Cmp(ratFromFloat(*param.Maximum)) > 0 {
+		return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: greater than maximum %v - %s", path, *param.Maximum, generateDescription(param))
+	}
+
+	if scale < 0 {
+		scale = d.scale()
+	}
+	if param.Output == "minor_units" {
+		units, err := d.minorUnits(scale)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: %v - %s", path, err, generateDescription(param))
+		}
+		return units, nil
+	}
+	return d.format(scale), nil
+}
@@ -0,0 +1,231 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value     interface{}
+		want      string
+		scale     int
+		precision int
+		wantErr   bool
+	}{
+		{value: json.Number("12.50"), want: "12.5", scale: 1, precision: 3},
+		{value: "0012.3400", want: "12.34", scale: 2, precision: 4},
+		{value: " 7 ", want: "7", scale: 0, precision: 1},
+		{value: "-0.00", want: "0", scale: 0, precision: 0},
+		{value: "+0.005", want: "0.005", scale: 3, precision: 1},
+		{value: "-1.10", want: "-1.1", scale: 1, precision: 2},
+		{value: json.Number("123456789012345678901234567890.123456789"), want: "123456789012345678901234567890.123456789", scale: 9, precision: 39},
+		{value: 42, want: "42", scale: 0, precision: 2},
+		{value: 0.1, want: "0.1", scale: 1, precision: 1},
+		{value: "1e3", wantErr: true},
+		{value: "1.", wantErr: true},
+		{value: ".5", wantErr: true},
+		{value: "1,5", wantErr: true},
+		{value: "", wantErr: true},
+		{value: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		d, err := parseDecimal(tt.value)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDecimal(%#v) = %s, want an error", tt.value, d.format(0))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseDecimal(%#v) failed: %v", tt.value, err)
+			continue
+		}
+		if got := d.format(0); got != tt.want {
+			t.Errorf("parseDecimal(%#v) = %s, want %s", tt.value, got, tt.want)
+		}
+		if d.scale() != tt.scale || d.precision() != tt.precision {
+			t.Errorf("parseDecimal(%#v) has scale %d and precision %d, want %d and %d", tt.value, d.scale(), d.precision(), tt.scale, tt.precision)
+		}
+	}
+}
+
+func TestDecimalMinorUnits(t *testing.T) {
+	tests := []struct {
+		literal string
+		scale   int
+		want    int64
+		wantErr bool
+	}{
+		{literal: "1000", scale: 0, want: 1000},    // JPY
+		{literal: "12.345", scale: 3, want: 12345}, // KWD
+		{literal: "12.3", scale: 3, want: 12300},   // KWD
+		{literal: "19.99", scale: 2, want: 1999},   // USD
+		{literal: "-0.01", scale: 2, want: -1},     // USD
+		{literal: "0", scale: 2, want: 0},          // USD
+		{literal: "92233720368547758.08", scale: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		d, err := parseDecimal(tt.literal)
+		if err != nil {
+			t.Fatalf("parseDecimal(%q) failed: %v", tt.literal, err)
+		}
+		got, err := d.minorUnits(tt.scale)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("minorUnits(%s, %d) = %d, want an error", tt.literal, tt.scale, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("minorUnits(%s, %d) = %d, %v, want %d", tt.literal, tt.scale, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateDecimal(t *testing.T) {
+	scale2 := 2
+	minimum, maximum := 0.01, 1000.0
+	tests := []struct {
+		name     string
+		param    ParamConfig
+		value    interface{}
+		siblings map[string]interface{}
+		want     interface{}
+		wantErr  bool
+	}{
+		{name: "scale pads", param: ParamConfig{Type: "decimal", Scale: &scale2}, value: "1.5", want: "1.50"},
+		{name: "scale exceeded", param: ParamConfig{Type: "decimal", Scale: &scale2}, value: "1.505", wantErr: true},
+		{name: "no scale keeps digits", param: ParamConfig{Type: "decimal"}, value: json.Number("1.230"), want: "1.23"},
+		{name: "precision", param: ParamConfig{Type: "decimal", Precision: 4}, value: "123.4", want: "123.4"},
+		{name: "precision exceeded", param: ParamConfig{Type: "decimal", Precision: 4}, value: "123.45", wantErr: true},
+		{name: "exact minimum", param: ParamConfig{Type: "decimal", Minimum: &minimum}, value: "0.01", want: "0.01"},
+		{name: "below minimum", param: ParamConfig{Type: "decimal", Minimum: &minimum}, value: "0.009", wantErr: true},
+		{name: "above maximum", param: ParamConfig{Type: "decimal", Maximum: &maximum}, value: "1000.001", wantErr: true},
+		{name: "JPY has no decimals", param: ParamConfig{Type: "money", Currency: "JPY"}, value: "1000.5", wantErr: true},
+		{name: "JPY minor units", param: ParamConfig{Type: "money", Currency: "JPY", Output: "minor_units"}, value: "1000", want: int64(1000)},
+		{name: "KWD string", param: ParamConfig{Type: "money", Currency: "KWD"}, value: "1.5", want: "1.500"},
+		{name: "KWD minor units", param: ParamConfig{Type: "money", Currency: "KWD", Output: "minor_units"}, value: "1.234", want: int64(1234)},
+		{name: "USD string", param: ParamConfig{Type: "money", Currency: "USD"}, value: json.Number("10"), want: "10.00"},
+		{name: "USD minor units", param: ParamConfig{Type: "money", Currency: "USD", Output: "minor_units"}, value: "10.01", want: int64(1001)},
+		{name: "USD too many decimals", param: ParamConfig{Type: "money", Currency: "USD"}, value: "10.001", wantErr: true},
+		{name: "not a decimal", param: ParamConfig{Type: "money", Currency: "USD"}, value: "ten", wantErr: true},
+		{name: "currency param", param: ParamConfig{Type: "money", CurrencyParam: "currency"}, value: "5.25", siblings: map[string]interface{}{"currency": "USD"}, want: "5.25"},
+		{name: "currency param sets the scale", param: ParamConfig{Type: "money", CurrencyParam: "currency"}, value: "5.25", siblings: map[string]interface{}{"currency": "JPY"}, wantErr: true},
+		{name: "currency param minor units", param: ParamConfig{Type: "money", CurrencyParam: "currency", Output: "minor_units"}, value: "5.250", siblings: map[string]interface{}{"currency": "KWD"}, want: int64(5250)},
+		{name: "unknown currency", param: ParamConfig{Type: "money", CurrencyParam: "currency"}, value: "5", siblings: map[string]interface{}{"currency": "XYZ"}, wantErr: true},
+		{name: "missing currency", param: ParamConfig{Type: "money", CurrencyParam: "currency"}, value: "5", siblings: map[string]interface{}{}, wantErr: true},
+		{name: "lowercase currency", param: ParamConfig{Type: "money", CurrencyParam: "currency"}, value: "5", siblings: map[string]interface{}{"currency": "usd"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := validateDecimal("amount", tt.param, tt.value, tt.siblings)
+			if tt.wantErr {
+				var paramErr *paramError
+				if !errors.As(err, &paramErr) || paramErr.path != "amount" || paramErr.code != problem.ParamInvalid {
+					t.Fatalf("got %#v, %v, want an invalid amount error", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %#v, %v, want %#v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyCurrencyParamResolution(t *testing.T) {
+	// The currency is read from the sibling param of the same object, so each item has its own
+	item := ParamConfig{Name: "item", Type: "object", Properties: []ParamConfig{
+		{Name: "currency", Type: "string", Format: "currency", Required: true},
+		{Name: "amount", Type: "money", CurrencyParam: "currency", Output: "minor_units", Required: true},
+	}}
+	items := ParamConfig{Name: "items", Type: "array", Items: &item}
+	if err := prepareParams([]ParamConfig{items}, "reject"); err != nil {
+		t.Fatalf("prepareParams failed: %v", err)
+	}
+
+	value, err := validateValue("items", items, []interface{}{
+		map[string]interface{}{"currency": "JPY", "amount": "1500"},
+		map[string]interface{}{"currency": "KWD", "amount": "1.5"},
+		map[string]interface{}{"currency": "USD", "amount": json.Number("2.25")},
+	}, nil)
+	if err != nil {
+		t.Fatalf("validateValue failed: %v", err)
+	}
+	want := []int64{1500, 1500, 225}
+	for i, item := range value.([]interface{}) {
+		if got := item.(map[string]interface{})["amount"]; got != want[i] {
+			t.Errorf("items[%d].amount = %#v, want %d", i, got, want[i])
+		}
+	}
+
+	_, err = validateValue("items", items, []interface{}{
+		map[string]interface{}{"currency": "USD", "amount": "1.5"},
+		map[string]interface{}{"currency": "JPY", "amount": "1.5"},
+	}, nil)
+	var paramErr *paramError
+	if !errors.As(err, &paramErr) || paramErr.path != "items[1].amount" {
+		t.Fatalf("got %v, want an error about items[1].amount", err)
+	}
+}
+
+func TestMoneyItemsCurrencyParam(t *testing.T) {
+	// Money items take the currency of the array's sibling
+	amounts := ParamConfig{Name: "amounts", Type: "array", Items: &ParamConfig{Type: "money", CurrencyParam: "currency", Output: "minor_units"}}
+	params := []ParamConfig{{Name: "currency", Type: "string", Format: "currency"}, amounts}
+	if err := prepareParams(params, "reject"); err != nil {
+		t.Fatalf("prepareParams failed: %v", err)
+	}
+	value, err := validateValue("amounts", params[1], []interface{}{"1.5", json.Number("2")}, map[string]interface{}{"currency": "KWD"})
+	if err != nil {
+		t.Fatalf("validateValue failed: %v", err)
+	}
+	if got := value.([]interface{}); got[0] != int64(1500) || got[1] != int64(2000) {
+		t.Errorf("amounts = %#v, want KWD minor units", got)
+	}
+}
+
+func TestPrepareMoneyParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  []ParamConfig
+		wantErr string
+	}{
+		{name: "fixed currency", params: []ParamConfig{{Name: "amount", Type: "money", Currency: "EUR", Output: "string"}}},
+		{name: "currency param", params: []ParamConfig{{Name: "currency", Type: "string"}, {Name: "amount", Type: "money", CurrencyParam: "currency"}}},
+		{name: "no currency", params: []ParamConfig{{Name: "amount", Type: "money"}}, wantErr: "requires currency"},
+		{name: "unknown currency", params: []ParamConfig{{Name: "amount", Type: "money", Currency: "XYZ"}}, wantErr: "unknown currency"},
+		{name: "undeclared currency param", params: []ParamConfig{{Name: "amount", Type: "money", CurrencyParam: "currency"}}, wantErr: "not a sibling"},
+		{name: "currency param in the parent object", params: []ParamConfig{
+			{Name: "currency", Type: "string"},
+			{Name: "item", Type: "object", Properties: []ParamConfig{{Name: "amount", Type: "money", CurrencyParam: "currency"}}},
+		}, wantErr: "not a sibling"},
+		{name: "array items use the array's siblings", params: []ParamConfig{
+			{Name: "currency", Type: "string"},
+			{Name: "amounts", Type: "array", Items: &ParamConfig{Type: "money", CurrencyParam: "currency"}},
+		}},
+		{name: "object items use their properties", params: []ParamConfig{
+			{Name: "items", Type: "array", Items: &ParamConfig{Type: "object", Properties: []ParamConfig{
+				{Name: "currency", Type: "string"},
+				{Name: "amount", Type: "money", CurrencyParam: "currency"},
+			}}},
+		}},
+		{name: "unknown output", params: []ParamConfig{{Name: "amount", Type: "money", Currency: "USD", Output: "cents"}}, wantErr: "unknown output"},
+		{name: "unknown decimal output", params: []ParamConfig{{Name: "rate", Type: "decimal", Output: "float"}}, wantErr: "unknown output"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := prepareParams(tt.params, "reject")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package routes
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+)
+
+// RouteFile is the layout of routes.yaml and of the files it includes or that live in routes.d/
+type RouteFile struct {
+	Include  []string       `mapstructure:"include"` // Extra route files or globs relative to the config directory (routes.yaml only)
+	Routes   []RouteConfig  `mapstructure:"routes"`
+	Groups   []RouteGroup   `mapstructure:"groups"`
+	Versions []RouteVersion `mapstructure:"versions"`
+}
+
+// RouteVersion is a versioned set of routes, such as /v1 or /v2, that works like a group.
+// Its routes carry the version name and can map to different service methods than other versions.
+type RouteVersion struct {
+	Version       string        `mapstructure:"version"`        // Version name, e.g. "v1"
+	Prefix        string        `mapstructure:"prefix"`         // Path prefix; defaults to "/" + version
+	ServicePrefix string        `mapstructure:"service_prefix"` // Prepended to the service of every route
+	Defaults      RouteConfig   `mapstructure:"defaults"`       // e.g. deprecated and sunset for a whole version
+	Routes        []RouteConfig `mapstructure:"routes"`
+	Groups        []RouteGroup  `mapstructure:"groups"`
+}
+
+// RouteGroup shares a path prefix, a service prefix and default settings between routes.
+// A route inherits every default it doesn't set itself; nested blocks such as rate_limit are merged key by key.
+type RouteGroup struct {
+	Prefix        string        `mapstructure:"prefix"`         // Prepended to the path of every route
+	ServicePrefix string        `mapstructure:"service_prefix"` // Prepended to the service of every route, or used as the service when it has none
+	Defaults      RouteConfig   `mapstructure:"defaults"`       // Settings such as auth_type, role, rate_limit and timeout
+	Routes        []RouteConfig `mapstructure:"routes"`
+}
+
+// RouteDefinition is a route as written in a route file, with its group settings applied
+type RouteDefinition struct {
+	Route RouteConfig
+	File  string // File the route is defined in
+	Field string // Dotted path of the route within the file, e.g. "groups.0.routes.2"
+}
+
+// DefinitionError is a problem in a route file, located by file and the dotted path of the offending key
+type DefinitionError struct {
+	File  string
+	Field string
+	Err   error
+}
+
+func (e *DefinitionError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %v", e.File, e.Field, e.Err)
+}
+
+// RouteFiles returns routes.yaml followed by the files it includes and the files in routes.d/, in load order
+func RouteFiles(dir string) ([]string, error) {
+	mainFile := filepath.Join(dir, "routes.yaml")
+	raw, err := readRouteFile(mainFile)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{mainFile}
+	seen := map[string]bool{filepath.Clean(mainFile): true}
+	add := func(matches []string) {
+		sort.Strings(matches)
+		for _, file := range matches {
+			if !seen[filepath.Clean(file)] {
+				seen[filepath.Clean(file)] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	includes, _ := raw["include"].([]interface{})
+	for _, include := range includes {
+		pattern := filepath.Join(dir, fmt.Sprint(include))
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid include %q: %w", mainFile, include, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("%s: included file %s does not exist", mainFile, pattern)
+		}
+		add(matches)
+	}
+
+	for _, extension := range []string{"*.yaml", "*.yml"} {
+		matches, _ := filepath.Glob(filepath.Join(dir, "routes.d", extension))
+		add(matches)
+	}
+	return files, nil
+}
+
+// ReadRouteDefinitions reads every route file and returns the routes with their group settings applied.
+// With strict set, keys that match no setting are errors. All problems are returned, not just the first.
+func ReadRouteDefinitions(dir string, strict bool) ([]RouteDefinition, []*DefinitionError) {
+	files, err := RouteFiles(dir)
+	if err != nil {
+		return nil, []*DefinitionError{{File: filepath.Join(dir, "routes.yaml"), Err: err}}
+	}
+
+	var definitions []RouteDefinition
+	var problems []*DefinitionError
+	for i, file := range files {
+		raw, err := readRouteFile(file)
+		if err != nil {
+			problems = append(problems, &DefinitionError{File: file, Err: err})
+			continue
+		}
+		if _, exists := raw["include"]; exists && i > 0 {
+			problems = append(problems, &DefinitionError{File: file, Field: "include", Err: fmt.Errorf("include is only supported in routes.yaml")})
+		}
+		for key := range raw {
+			if key != "include" && key != "routes" && key != "groups" && key != "versions" && strict {
+				problems = append(problems, &DefinitionError{File: file, Field: key, Err: fmt.Errorf("unknown key %s", key)})
+			}
+		}
+
+		fileDefinitions, fileProblems := routeScope{}.expand(file, "", raw, strict)
+		definitions = append(definitions, fileDefinitions...)
+		problems = append(problems, fileProblems...)
+
+		versions, _ := raw["versions"].([]interface{})
+		for j, entry := range versions {
+			field := fmt.Sprintf("versions.%d", j)
+			version, ok := entry.(map[string]interface{})
+			if !ok {
+				problems = append(problems, &DefinitionError{File: file, Field: field, Err: fmt.Errorf("version must be a mapping")})
+				continue
+			}
+			name, _ := version["version"].(string)
+			if name == "" {
+				problems = append(problems, &DefinitionError{File: file, Field: field, Err: fmt.Errorf("version without a name")})
+				continue
+			}
+			if _, exists := version["prefix"]; !exists {
+				version["prefix"] = "/" + name
+			}
+			scope, scopeProblems := routeScope{}.nest(file, field, version, []string{"version", "prefix", "service_prefix", "defaults", "routes", "groups"}, strict)
+			scope.defaults = mergeDefaults(scope.defaults, map[string]interface{}{"version": name})
+			problems = append(problems, scopeProblems...)
+
+			versionDefinitions, versionProblems := scope.expand(file, field+".", version, strict)
+			definitions = append(definitions, versionDefinitions...)
+			problems = append(problems, versionProblems...)
+		}
+	}
+	return definitions, problems
+}
+
+// routeScope holds what a version or group passes down to its routes
+type routeScope struct {
+	prefix        string
+	servicePrefix string
+	defaults      map[string]interface{}
+}
+
+// nest returns the scope of a version or group declared within this scope.
+// Prefixes are appended to the parent's and defaults are merged over the parent's.
+func (scope routeScope) nest(file, field string, block map[string]interface{}, keys []string, strict bool) (routeScope, []*DefinitionError) {
+	var problems []*DefinitionError
+	allowed := map[string]bool{}
+	for _, key := range keys {
+		allowed[key] = true
+	}
+	for key := range block {
+		if !allowed[key] && strict {
+			problems = append(problems, &DefinitionError{File: file, Field: field + "." + key, Err: fmt.Errorf("unknown key %s", key)})
+		}
+	}
+
+	prefix, _ := block["prefix"].(string)
+	servicePrefix, _ := block["service_prefix"].(string)
+	defaults, _ := block["defaults"].(map[string]interface{})
+	nested := routeScope{
+		prefix:        joinPath(scope.prefix, prefix),
+		servicePrefix: joinService(scope.servicePrefix, servicePrefix),
+		defaults:      mergeDefaults(defaults, scope.defaults),
+	}
+	if prefix == "" {
+		nested.prefix = scope.prefix
+	}
+	return nested, problems
+}
+
+// expand decodes the routes and groups of a block (a file, a version or a group) within this scope
+func (scope routeScope) expand(file, fieldPrefix string, block map[string]interface{}, strict bool) ([]RouteDefinition, []*DefinitionError) {
+	var definitions []RouteDefinition
+	var problems []*DefinitionError
+
+	routes, _ := block["routes"].([]interface{})
+	for i, entry := range routes {
+		field := fmt.Sprintf("%sroutes.%d", fieldPrefix, i)
+		raw, ok := entry.(map[string]interface{})
+		if !ok {
+			problems = append(problems, &DefinitionError{File: file, Field: field, Err: fmt.Errorf("route must be a mapping")})
+			continue
+		}
+		route, err := decodeRoute(scope.apply(raw), strict)
+		if err != nil {
+			problems = append(problems, &DefinitionError{File: file, Field: field, Err: err})
+			continue
+		}
+		if route.Mock != nil && route.Mock.File != "" && !filepath.IsAbs(route.Mock.File) {
+			route.Mock.File = filepath.Join(filepath.Dir(file), route.Mock.File)
+		}
+		definitions = append(definitions, RouteDefinition{Route: route, File: file, Field: field})
+	}
+
+	groups, _ := block["groups"].([]interface{})
+	for i, entry := range groups {
+		field := fmt.Sprintf("%sgroups.%d", fieldPrefix, i)
+		group, ok := entry.(map[string]interface{})
+		if !ok {
+			problems = append(problems, &DefinitionError{File: file, Field: field, Err: fmt.Errorf("group must be a mapping")})
+			continue
+		}
+		nested, nestProblems := scope.nest(file, field, group, []string{"prefix", "service_prefix", "defaults", "routes"}, strict)
+		problems = append(problems, nestProblems...)
+		groupDefinitions, groupProblems := nested.expand(file, field+".", map[string]interface{}{"routes": group["routes"]}, strict)
+		definitions = append(definitions, groupDefinitions...)
+		problems = append(problems, groupProblems...)
+	}
+	return definitions, problems
+}
+
+// apply returns a route with the scope's defaults, path prefix and service prefix applied
+func (scope routeScope) apply(raw map[string]interface{}) map[string]interface{} {
+	merged := mergeDefaults(raw, scope.defaults)
+	path, _ := raw["path"].(string)
+	merged["path"] = joinPath(scope.prefix, path)
+	if scope.servicePrefix != "" {
+		service, _ := raw["service"].(string)
+		merged["service"] = joinService(scope.servicePrefix, service)
+	}
+	return merged
+}
+
+// CheckRouteConflicts reports routes defined more than once, and paths that put differently
+// named parameters at the same position, which the router can't tell apart
+func CheckRouteConflicts(definitions []RouteDefinition) []*DefinitionError {
+	var problems []*DefinitionError
+	first := map[string]RouteDefinition{}
+	for i, definition := range definitions {
+		route := definition.Route
+		key := strings.ToUpper(strings.TrimSpace(route.Type)) + " " + route.Path
+		if previous, exists := first[key]; exists {
+			problems = append(problems, &DefinitionError{File: definition.File, Field: definition.Field, Err: fmt.Errorf("duplicate route %s, first defined in %s at %s", key, previous.File, previous.Field)})
+			continue
+		}
+		first[key] = definition
+
+		for _, previous := range definitions[:i] {
+			if conflict := paramConflict(previous.Route.Path, route.Path); conflict != "" {
+				problems = append(problems, &DefinitionError{File: definition.File, Field: definition.Field + ".path", Err: fmt.Errorf("path %s conflicts with %s defined in %s: %s", route.Path, previous.Route.Path, previous.File, conflict)})
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// paramConflict describes why two paths can't be registered together, or returns "" when they can
+func paramConflict(a, b string) string {
+	aSegments := strings.Split(strings.Trim(a, "/"), "/")
+	bSegments := strings.Split(strings.Trim(b, "/"), "/")
+	for i := 0; i < len(aSegments) && i < len(bSegments); i++ {
+		aSegment, bSegment := aSegments[i], bSegments[i]
+		aWildcard := strings.HasPrefix(aSegment, ":") || strings.HasPrefix(aSegment, "*")
+		bWildcard := strings.HasPrefix(bSegment, ":") || strings.HasPrefix(bSegment, "*")
+		switch {
+		case aWildcard && bWildcard && aSegment != bSegment:
+			return fmt.Sprintf("%s and %s at the same position", aSegment, bSegment)
+		case aWildcard != bWildcard || aSegment != bSegment:
+			return ""
+		}
+	}
+	return ""
+}
+
+// readRouteFile parses a route file into plain maps, keeping the case of keys and values
+func readRouteFile(file string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routes config: %w", err)
+	}
+	raw := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return raw, nil
+}
+
+// decodeRoute decodes a route the way viper decodes config, with durations such as "10s" accepted
+func decodeRoute(raw interface{}, strict bool) (RouteConfig, error) {
+	var route RouteConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Result:           &route,
+		WeaklyTypedInput: true,
+		ErrorUnused:      strict,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+			flatResponseStructureHook,
+		),
+	})
+	if err != nil {
+		return route, err
+	}
+	if err := decoder.Decode(raw); err != nil {
+		return route, err
+	}
+	return route, nil
+}
+
+// IsFlatResponseStructure reports whether a response_structure uses the original flat form, a
+// mapping of field names to types, rather than envelope and fields
+func IsFlatResponseStructure(raw map[string]interface{}) bool {
+	if len(raw) == 0 {
+		return false
+	}
+	for key, value := range raw {
+		if _, ok := value.(string); !ok || key == "envelope" {
+			return false
+		}
+	}
+	return true
+}
+
+// flatResponseStructureHook decodes a flat response_structure as its fields, sorted by name
+func flatResponseStructureHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	raw, ok := data.(map[string]interface{})
+	if to != reflect.TypeOf(ResponseConfig{}) || !ok || !IsFlatResponseStructure(raw) {
+		return data, nil
+	}
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]interface{}, len(names))
+	for i, name := range names {
+		fields[i] = map[string]interface{}{"name": name, "type": raw[name]}
+	}
+	return map[string]interface{}{"fields": fields}, nil
+}
+
+// mergeDefaults returns the route with every default it doesn't set; nested mappings are merged key by key
+func mergeDefaults(route, defaults map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(route)+len(defaults))
+	for key, value := range defaults {
+		merged[key] = value
+	}
+	for key, value := range route {
+		routeMap, routeIsMap := value.(map[string]interface{})
+		defaultMap, defaultIsMap := merged[key].(map[string]interface{})
+		if routeIsMap && defaultIsMap {
+			value = mergeDefaults(routeMap, defaultMap)
+		}
+		merged[key] = value
+	}
+	return merged
+}
+
+// joinService prefixes a service name with a dotted service prefix
+func joinService(prefix, service string) string {
+	switch {
+	case prefix == "":
+		return service
+	case service == "":
+		return prefix
+	}
+	return prefix + "." + service
+}
+
+// joinPath prefixes a route path with its group prefix
+func joinPath(prefix, path string) string {
+	prefix = strings.TrimRight(prefix, "/")
+	if path == "" || path == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return prefix + path
+}
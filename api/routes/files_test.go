@@ -0,0 +1,294 @@
+package routes
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeRouteFiles writes the given files into a new config directory and returns it
+func writeRouteFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestRouteFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "routes.yaml only",
+			files: map[string]string{"routes.yaml": "routes: []\n"},
+			want:  []string{"routes.yaml"},
+		},
+		{
+			name: "includes then routes.d",
+			files: map[string]string{
+				"routes.yaml":            "include: [\"billing.yaml\", \"teams/*.yaml\", \"routes.d/a.yaml\"]\n",
+				"billing.yaml":           "routes: []\n",
+				"teams/risk.yaml":        "routes: []\n",
+				"teams/kyc.yaml":         "routes: []\n",
+				"routes.d/b.yml":         "routes: []\n",
+				"routes.d/a.yaml":        "routes: []\n",
+				"routes.d/notes.txt":     "not a route file\n",
+				"routes.d/nested/c.yaml": "routes: []\n",
+			},
+			want: []string{"routes.yaml", "billing.yaml", "teams/kyc.yaml", "teams/risk.yaml", "routes.d/a.yaml", "routes.d/b.yml"},
+		},
+		{
+			name:  "glob matching nothing",
+			files: map[string]string{"routes.yaml": "include: [\"teams/*.yaml\"]\n"},
+			want:  []string{"routes.yaml"},
+		},
+		{name: "missing include", files: map[string]string{"routes.yaml": "include: [\"billing.yaml\"]\n"}, wantErr: true},
+		{name: "missing routes.yaml", files: map[string]string{"routes.d/a.yaml": "routes: []\n"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeRouteFiles(t, tt.files)
+			files, err := RouteFiles(dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, file := range files {
+				rel, _ := filepath.Rel(dir, file)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouteGroups(t *testing.T) {
+	dir := writeRouteFiles(t, map[string]string{
+		"routes.yaml": `routes:
+  - path: "/health/deep"
+    type: "GET"
+groups:
+  - prefix: "/v1/billing"
+    service_prefix: "billing"
+    defaults:
+      auth_type: "jwt"
+      role: "finance"
+      timeout: 10s
+      rate_limit: {limit: 50, burst: 10}
+    routes:
+      - path: "/invoices"
+        type: "GET"
+        method: "list_invoices"
+      - path: "/invoices/:invoice_id"
+        type: "DELETE"
+        service: "invoices"
+        role: "admin"
+        rate_limit: {burst: 2}
+`,
+		"routes.d/risk.yaml": `groups:
+  - prefix: "/v1/risk/"
+    routes:
+      - path: "scores"
+        type: "GET"
+`,
+	})
+	definitions, problems := ReadRouteDefinitions(dir, true)
+	if len(problems) > 0 {
+		t.Fatalf("ReadRouteDefinitions failed: %v", problems)
+	}
+
+	type summary struct {
+		Path, Service, Role, AuthType, Timeout string
+		Limit, Burst                           int
+		Field                                  string
+	}
+	var got []summary
+	for _, definition := range definitions {
+		route := definition.Route
+		got = append(got, summary{route.Path, route.Service, route.Role, route.AuthType, route.Timeout.String(), route.RateLimit.Limit, route.RateLimit.Burst, filepath.Base(definition.File) + " " + definition.Field})
+	}
+	want := []summary{
+		{"/health/deep", "", "", "", "0s", 0, 0, "routes.yaml routes.0"},
+		{"/v1/billing/invoices", "billing", "finance", "jwt", "10s", 50, 10, "routes.yaml groups.0.routes.0"},
+		{"/v1/billing/invoices/:invoice_id", "billing.invoices", "admin", "jwt", "10s", 50, 2, "routes.yaml groups.0.routes.1"},
+		{"/v1/risk/scores", "", "", "", "0s", 0, 0, "risk.yaml groups.0.routes.0"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("routes\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestReadRouteDefinitionsProblems(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // Parts of each problem, in order
+	}{
+		{
+			name:  "unknown group key",
+			files: map[string]string{"routes.yaml": "groups:\n  - prefx: \"/v1\"\n    routes: []\n"},
+			want:  []string{"groups.0.prefx: unknown key prefx"},
+		},
+		{
+			name:  "unknown route key",
+			files: map[string]string{"routes.yaml": "routes:\n  - path: \"/v1/payments\"\n    type: \"GET\"\n    rol: \"admin\"\n"},
+			want:  []string{"routes.0: ", "rol"},
+		},
+		{
+			name:  "include outside routes.yaml",
+			files: map[string]string{"routes.yaml": "routes: []\n", "routes.d/a.yaml": "include: [\"b.yaml\"]\n"},
+			want:  []string{"a.yaml: include: include is only supported in routes.yaml"},
+		},
+		{
+			name:  "route not a mapping",
+			files: map[string]string{"routes.yaml": "routes:\n  - \"/v1/payments\"\n"},
+			want:  []string{"routes.0: route must be a mapping"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problems := ReadRouteDefinitions(writeRouteFiles(t, tt.files), true)
+			if len(problems) != 1 {
+				t.Fatalf("problems %v, want one", problems)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(problems[0].Error(), part) {
+					t.Errorf("problem %q, want it to contain %q", problems[0], part)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckRouteConflicts(t *testing.T) {
+	definition := func(file, method, path string) RouteDefinition {
+		return RouteDefinition{Route: RouteConfig{Type: method, Path: path}, File: file, Field: "routes.0"}
+	}
+	tests := []struct {
+		name        string
+		definitions []RouteDefinition
+		want        []string // Parts of each problem, in order
+	}{
+		{
+			name:        "distinct routes",
+			definitions: []RouteDefinition{definition("routes.yaml", "GET", "/payments/:id"), definition("a.yaml", "POST", "/payments/:id"), definition("a.yaml", "GET", "/payments/:id/refunds")},
+		},
+		{
+			name:        "duplicate across files",
+			definitions: []RouteDefinition{definition("routes.yaml", "GET", "/payments"), definition("a.yaml", "get ", "/payments")},
+			want:        []string{"a.yaml: routes.0: duplicate route GET /payments, first defined in routes.yaml"},
+		},
+		{
+			name:        "differently named params",
+			definitions: []RouteDefinition{definition("routes.yaml", "GET", "/payments/:id"), definition("a.yaml", "DELETE", "/payments/:payment_id")},
+			want:        []string{"a.yaml: routes.0.path: path /payments/:payment_id conflicts with /payments/:id defined in routes.yaml: :id and :payment_id at the same position"},
+		},
+		{
+			name:        "static segment before the param",
+			definitions: []RouteDefinition{definition("routes.yaml", "GET", "/payments/:id"), definition("a.yaml", "GET", "/refunds/:refund_id")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := CheckRouteConflicts(tt.definitions)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems %v, want %d", problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i].Error(), want) {
+					t.Errorf("problem %q, want %q", problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestRouteVersions(t *testing.T) {
+	dir := writeRouteFiles(t, map[string]string{
+		"routes.yaml": `versions:
+  - version: "v1"
+    service_prefix: "legacy"
+    defaults:
+      deprecated: true
+      sunset: "2027-06-30"
+    routes:
+      - path: "/checkout"
+        type: "POST"
+        service: "checkout"
+        successor: "/v2/checkout"
+    groups:
+      - prefix: "/refunds"
+        routes:
+          - path: "/:refund_id"
+            type: "GET"
+            deprecated: false
+  - version: "v2"
+    prefix: "/api/v2"
+    routes:
+      - path: "/checkout"
+        type: "POST"
+        service: "checkout"
+`,
+	})
+	definitions, problems := ReadRouteDefinitions(dir, true)
+	if len(problems) > 0 {
+		t.Fatalf("ReadRouteDefinitions failed: %v", problems)
+	}
+
+	type summary struct {
+		Path, Version, Service string
+		Deprecated             bool
+		Sunset, Successor      string
+	}
+	var got []summary
+	for _, definition := range definitions {
+		route := definition.Route
+		got = append(got, summary{route.Path, route.Version, route.Service, route.Deprecated, route.Sunset, route.Successor})
+	}
+	want := []summary{
+		{"/v1/checkout", "v1", "legacy.checkout", true, "2027-06-30", "/v2/checkout"},
+		{"/v1/refunds/:refund_id", "v1", "legacy", false, "2027-06-30", ""},
+		{"/api/v2/checkout", "v2", "checkout", false, "", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("routes\n%+v\nwant\n%+v", got, want)
+	}
+	if problems := CheckRouteConflicts(definitions); len(problems) > 0 {
+		t.Errorf("versions conflict: %v", problems)
+	}
+}
+
+func TestRouteVersionProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{name: "no name", yaml: "versions:\n  - prefix: \"/v1\"\n    routes: []\n", want: "versions.0: version without a name"},
+		{name: "unknown key", yaml: "versions:\n  - version: \"v1\"\n    sunset: \"2027-06-30\"\n", want: "versions.0.sunset: unknown key sunset"},
+		{name: "not a mapping", yaml: "versions:\n  - \"v1\"\n", want: "versions.0: version must be a mapping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, problems := ReadRouteDefinitions(writeRouteFiles(t, map[string]string{"routes.yaml": tt.yaml}), true)
+			if len(problems) != 1 || !strings.Contains(problems[0].Error(), tt.want) {
+				t.Errorf("problems %v, want %q", problems, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/render"
+)
+
+// CSVConfig sets how the rows of a CSV response are read and laid out
+type CSVConfig struct {
+	Field    string      `mapstructure:"field"`    // Array field of the response holding the rows; the page items of paginated routes
+	Columns  []CSVColumn `mapstructure:"columns"`  // Defaults to the declared fields of the rows, else the keys of the first row
+	Filename string      `mapstructure:"filename"` // Sent as an attachment with this name when set
+}
+
+// CSVColumn maps a row field to a CSV column
+type CSVColumn struct {
+	Field  string `mapstructure:"field"`  // Dotted path within a row, e.g. customer.email
+	Header string `mapstructure:"header"` // Defaults to the field
+}
+
+// formatTypes lists the response formats and the media types that ask for them
+var formatTypes = map[string][]string{
+	"json":    {"application/json"},
+	"msgpack": {"application/msgpack", "application/x-msgpack"},
+	"csv":     {"text/csv"},
+}
+
+// prepareFormats fills in the default format and the CSV columns of a route
+func prepareFormats(route *RouteConfig) error {
+	if len(route.Formats) == 0 {
+		route.Formats = []string{"json"}
+	}
+	csvEnabled := false
+	for _, format := range route.Formats {
+		if _, ok := formatTypes[format]; !ok {
+			return fmt.Errorf("invalid format %q (expected json, msgpack or csv)", format)
+		}
+		csvEnabled = csvEnabled || format == "csv"
+	}
+	if !csvEnabled {
+		return nil
+	}
+
+	if route.CSV == nil {
+		route.CSV = &CSVConfig{}
+	}
+	rowFields := route.ResponseStructure.Fields
+	if route.Pagination == nil {
+		if route.CSV.Field == "" {
+			return fmt.Errorf("csv needs pagination or csv.field naming the array of rows")
+		}
+		rowFields = nil
+		for _, field := range route.ResponseStructure.Fields {
+			if field.Name == route.CSV.Field && field.Items != nil {
+				rowFields = field.Items.Properties
+			}
+		}
+	}
+	for i, column := range route.CSV.Columns {
+		if column.Field == "" {
+			return fmt.Errorf("csv column %d has no field", i)
+		}
+	}
+	if len(route.CSV.Columns) == 0 {
+		for _, field := range rowFields {
+			route.CSV.Columns = append(route.CSV.Columns, CSVColumn{Field: field.Name})
+		}
+	}
+	return nil
+}
+
+// negotiateFormat picks the route format the client prefers according to Accept, the first one when
+// it has no preference. It returns "" when the client accepts none of them.
+func negotiateFormat(accept string, formats []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return formats[0]
+	}
+	best, bestQuality := "", 0.0
+	for _, format := range formats {
+		if quality := formatQuality(accept, format); quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	return best
+}
+
+// formatQuality returns the quality Accept gives a format, from the most specific matching range
+func formatQuality(accept, format string) float64 {
+	quality, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		rangeQuality := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				rangeQuality = parsed
+			}
+		}
+		for _, mediaType := range formatTypes[format] {
+			rangeSpecificity := -1
+			switch mediaRange {
+			case mediaType:
+				rangeSpecificity = 2
+			case strings.Split(mediaType, "/")[0] + "/*":
+				rangeSpecificity = 1
+			case "*/*":
+				rangeSpecificity = 0
+			}
+			if rangeSpecificity > specificity {
+				quality, specificity = rangeQuality, rangeSpecificity
+			}
+		}
+	}
+	return quality
+}
+
+// acceptedFormats is the detail of a 406 response, listing the media types of the route
+func acceptedFormats(formats []string) string {
+	var mediaTypes []string
+	for _, format := range formats {
+		mediaTypes = append(mediaTypes, formatTypes[format][0])
+	}
+	return "acceptable formats: " + strings.Join(mediaTypes, ", ")
+}
+
+// writeResponse sends a shaped response in the negotiated format
+func writeResponse(c *gin.Context, routeConfig RouteConfig, status int, format string, body interface{}) {
+	switch format {
+	case "msgpack":
+		c.Render(status, render.MsgPack{Data: msgpackValue(body)})
+	case "csv":
+		writeCSV(c, routeConfig, status, body)
+	default:
+		c.JSON(status, body)
+	}
+}
+
+// writeCSV sends the rows of a shaped response as CSV with a header row
+func writeCSV(c *gin.Context, routeConfig RouteConfig, status int, body interface{}) {
+	data := body
+	if envelope := routeConfig.ResponseStructure.Envelope; envelope != nil && *envelope {
+		data = body.(gin.H)["data"]
+	}
+	var value interface{} = data
+	if routeConfig.Pagination == nil {
+		object, _ := data.(map[string]interface{})
+		value = object[routeConfig.CSV.Field]
+	}
+	rows, ok := value.([]interface{})
+	if !ok && value != nil {
+		problem.Abort(c, http.StatusBadGateway, problem.UpstreamInvalid, "the service response has no rows to export as CSV")
+		return
+	}
+
+	columns := routeConfig.CSV.Columns
+	if len(columns) == 0 && len(rows) > 0 {
+		first, _ := rows[0].(map[string]interface{})
+		for key := range first {
+			columns = append(columns, CSVColumn{Field: key})
+		}
+		sort.Slice(columns, func(i, j int) bool { return columns[i].Field < columns[j].Field })
+	}
+
+	if routeConfig.CSV.Filename != "" {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": routeConfig.CSV.Filename}))
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(status)
+	writer := csv.NewWriter(c.Writer)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Header
+		if header[i] == "" {
+			header[i] = column.Field
+		}
+	}
+	writer.Write(header)
+	for _, row := range rows {
+		object, _ := row.(map[string]interface{})
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = csvCell(lookupPath(object, column.Field))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+}
+
+// lookupPath returns the value at a dotted path within an object, or nil
+func lookupPath(object map[string]interface{}, path string) interface{} {
+	var value interface{} = object
+	for _, key := range strings.Split(path, ".") {
+		current, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = current[key]
+	}
+	return value
+}
+
+// csvCell formats a value as a CSV cell; objects and arrays are written as JSON. Text starting like
+// a spreadsheet formula is prefixed with a quote, so opening an export never runs it.
+func csvCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return "'" + v
+			}
+		}
+		return v
+	case map[string]interface{}, []interface{}:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// msgpackValue prepares a shaped response for MessagePack. Service numbers are kept as json.Number
+// to preserve their precision; they are encoded as integers or floats when that is exact, as strings
+// otherwise.
+func msgpackValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case gin.H:
+		return msgpackValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = msgpackValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = msgpackValue(item)
+		}
+		return result
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			return integer
+		}
+		if float, err := v.Float64(); err == nil && strconv.FormatFloat(float, 'f', -1, 64) == v.String() {
+			return float
+		}
+		return v.String()
+	default:
+		return value
+	}
+}
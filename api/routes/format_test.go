@@ -0,0 +1,208 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ugorji/go/codec"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	tests := []struct {
+		accept  string
+		formats []string
+		want    string
+	}{
+		{"", []string{"csv", "json"}, "csv"},
+		{"*/*", []string{"json", "csv"}, "json"},
+		{"application/json", []string{"json", "msgpack"}, "json"},
+		{"application/x-msgpack", []string{"json", "msgpack"}, "msgpack"},
+		{"text/csv;q=0.5, application/json;q=0.9", []string{"csv", "json"}, "json"},
+		{"text/*;q=0.8, application/*;q=0.2", []string{"json", "csv"}, "csv"},
+		{"text/csv;q=0, */*", []string{"csv", "json"}, "json"},
+		{"application/json;q=0", []string{"json"}, ""},
+		{"text/html", []string{"json", "csv"}, ""},
+		{"not a media type, text/csv", []string{"json", "csv"}, "csv"},
+	}
+	for _, tt := range tests {
+		if got := negotiateFormat(tt.accept, tt.formats); got != tt.want {
+			t.Errorf("negotiateFormat(%q, %v) = %q, want %q", tt.accept, tt.formats, got, tt.want)
+		}
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"paid", "paid"},
+		{"=HYPERLINK(\"https://example.com\")", "'=HYPERLINK(\"https://example.com\")"},
+		{"+1+cmd|' /C calc'!A0", "'+1+cmd|' /C calc'!A0"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1", "'\t=1"},
+		{"-12.50", "-12.50"},
+		{"+44", "+44"},
+		{json.Number("10.25"), "10.25"},
+		{true, "true"},
+		{map[string]interface{}{"id": "cus_1"}, `{"id":"cus_1"}`},
+		{[]interface{}{"a", 1.0}, `["a",1]`},
+	}
+	for _, tt := range tests {
+		if got := csvCell(tt.value); got != tt.want {
+			t.Errorf("csvCell(%#v) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMsgpackValue(t *testing.T) {
+	got := msgpackValue(map[string]interface{}{
+		"integer": json.Number("42"),
+		"float":   json.Number("10.25"),
+		"large":   json.Number("123456789012345678901234567890"),
+		"nested":  []interface{}{json.Number("1"), "a"},
+	})
+	want := map[string]interface{}{
+		"integer": int64(42),
+		"float":   10.25,
+		"large":   "123456789012345678901234567890",
+		"nested":  []interface{}{int64(1), "a"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("msgpackValue = %#v, want %#v", got, want)
+	}
+}
+
+func TestFormats(t *testing.T) {
+	service := `{"id":"x","payments":[{"id":"pay_1","amount":10.25,"note":"=cmd()","customer":{"email":"a@example.com"}},{"id":"pay_2","amount":7}]}`
+	tests := []struct {
+		name        string
+		formats     []string
+		csv         *CSVConfig
+		accept      string
+		wantStatus  int
+		wantType    string
+		wantBody    string // Exact body, for CSV
+		wantVary    bool
+		wantHeaders map[string]string
+	}{
+		{name: "json by default", formats: []string{"json", "csv"}, csv: &CSVConfig{Field: "payments"}, wantType: "application/json; charset=utf-8", wantVary: true},
+		{name: "single format", formats: []string{"json"}, accept: "application/json", wantType: "application/json; charset=utf-8"},
+		{name: "not acceptable", formats: []string{"json"}, accept: "text/csv", wantStatus: http.StatusNotAcceptable, wantType: "application/problem+json"},
+		{name: "msgpack", formats: []string{"json", "msgpack"}, accept: "application/msgpack", wantType: "application/msgpack; charset=utf-8", wantVary: true},
+		{
+			name: "csv with columns", formats: []string{"json", "csv"}, accept: "text/csv", wantVary: true,
+			csv:         &CSVConfig{Field: "payments", Filename: "payments.csv", Columns: []CSVColumn{{Field: "id", Header: "ID"}, {Field: "customer.email", Header: "Email"}, {Field: "note"}}},
+			wantType:    "text/csv; charset=utf-8",
+			wantBody:    "ID,Email,note\npay_1,a@example.com,'=cmd()\npay_2,,\n",
+			wantHeaders: map[string]string{"Content-Disposition": `attachment; filename=payments.csv`},
+		},
+		{
+			name: "csv columns from the first row", formats: []string{"csv"}, csv: &CSVConfig{Field: "payments"},
+			wantType: "text/csv; charset=utf-8",
+			wantBody: "amount,customer,id,note\n10.25,\"{\"\"email\"\":\"\"a@example.com\"\"}\",pay_1,'=cmd()\n7,,pay_2,\n",
+		},
+		{name: "csv field not a list", formats: []string{"csv"}, csv: &CSVConfig{Field: "id"}, wantStatus: http.StatusBadGateway, wantType: "application/problem+json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := prepareTestRoute(t, RouteConfig{
+				Path:    "/payments",
+				Type:    http.MethodGet,
+				Formats: tt.formats,
+				CSV:     tt.csv,
+				Mock:    &MockConfig{Enabled: true, Template: service},
+			})
+			req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			recorder := serveRoute(route, req)
+
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if recorder.Code != wantStatus || recorder.Header().Get("Content-Type") != tt.wantType {
+				t.Fatalf("got %d %q %s, want %d %s", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body, wantStatus, tt.wantType)
+			}
+			if vary := recorder.Header().Get("Vary") == "Accept"; vary != tt.wantVary {
+				t.Errorf("Vary %q, want Accept: %v", recorder.Header().Get("Vary"), tt.wantVary)
+			}
+			for name, want := range tt.wantHeaders {
+				if got := recorder.Header().Get(name); got != want {
+					t.Errorf("%s %q, want %q", name, got, want)
+				}
+			}
+			if tt.wantBody != "" && recorder.Body.String() != tt.wantBody {
+				t.Errorf("body %q, want %q", recorder.Body, tt.wantBody)
+			}
+			if strings.HasPrefix(tt.wantType, "application/msgpack") {
+				var decoded map[string]interface{}
+				handle := &codec.MsgpackHandle{}
+				handle.RawToString = true
+				if err := codec.NewDecoderBytes(recorder.Body.Bytes(), handle).Decode(&decoded); err != nil {
+					t.Fatalf("invalid msgpack body: %v", err)
+				}
+				payments, _ := decoded["payments"].([]interface{})
+				if len(payments) != 2 {
+					t.Fatalf("decoded %v, want the two payments", decoded)
+				}
+				first, _ := payments[0].(map[interface{}]interface{})
+				if first["amount"] != 10.25 || payments[1].(map[interface{}]interface{})["amount"] != int64(7) {
+					t.Errorf("amounts %v and %v, want 10.25 and 7", first["amount"], payments[1].(map[interface{}]interface{})["amount"])
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareFormats(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		want    []CSVColumn
+		wantErr bool
+	}{
+		{name: "json default", route: RouteConfig{}},
+		{name: "unknown format", route: RouteConfig{Formats: []string{"xml"}}, wantErr: true},
+		{name: "csv without rows", route: RouteConfig{Formats: []string{"csv"}}, wantErr: true},
+		{name: "csv column without field", route: RouteConfig{Formats: []string{"csv"}, CSV: &CSVConfig{Field: "payments", Columns: []CSVColumn{{Header: "ID"}}}}, wantErr: true},
+		{
+			name: "csv columns from declared items",
+			route: RouteConfig{Formats: []string{"csv"}, CSV: &CSVConfig{Field: "payments"}, ResponseStructure: ResponseConfig{Fields: []ParamConfig{
+				{Name: "payments", Type: "array", Items: &ParamConfig{Type: "object", Properties: []ParamConfig{{Name: "id", Type: "string"}, {Name: "amount", Type: "number"}}}},
+			}}},
+			want: []CSVColumn{{Field: "id"}, {Field: "amount"}},
+		},
+		{
+			name:  "csv columns from paginated items",
+			route: RouteConfig{Formats: []string{"csv"}, Pagination: &PaginationConfig{}, ResponseStructure: ResponseConfig{Fields: []ParamConfig{{Name: "id", Type: "string"}}}},
+			want:  []CSVColumn{{Field: "id"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := tt.route
+			err := prepareFormats(&route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("prepareFormats error %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(route.Formats) == 0 {
+				t.Error("no default format")
+			}
+			if route.CSV != nil && !reflect.DeepEqual(route.CSV.Columns, tt.want) {
+				t.Errorf("columns %v, want %v", route.CSV.Columns, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"bytes"
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// MockConfig serves a canned response instead of calling the service, so frontend work can start
+// before the service exists. The response goes through the same validation and shaping as a real one.
+type MockConfig struct {
+	Enabled     bool          `mapstructure:"enabled"`      // Mock this route even when the global mock_mode is off
+	Response    interface{}   `mapstructure:"response"`     // Static response object
+	File        string        `mapstructure:"file"`         // JSON file holding the response, relative to the route file
+	Template    string        `mapstructure:"template"`     // text/template rendering the JSON response from .Params, .Args and .RequestID
+	Latency     time.Duration `mapstructure:"latency"`      // Delay added before responding
+	ErrorRate   float64       `mapstructure:"error_rate"`   // Share of requests, from 0 to 1, answered with an injected error
+	ErrorStatus int           `mapstructure:"error_status"` // Status of injected errors (default: 500)
+
+	response map[string]interface{} // Static or file response, set by PrepareRoute
+	template *template.Template     // Parsed Template, set by PrepareRoute
+}
+
+// mockFuncs are the functions available in mock templates
+var mockFuncs = template.FuncMap{
+	"uuid": func() string { return uuid.New().String() },
+	"now":  func() string { return time.Now().UTC().Format(time.RFC3339) },
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// prepareMock loads the mock response of a route and checks its settings
+func prepareMock(mock *MockConfig) error {
+	sources := 0
+	for _, set := range []bool{mock.Response != nil, mock.File != "", mock.Template != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("exactly one of response, file or template is required")
+	}
+	if mock.ErrorRate < 0 || mock.ErrorRate > 1 {
+		return fmt.Errorf("error_rate must be between 0 and 1")
+	}
+	if mock.ErrorStatus == 0 {
+		mock.ErrorStatus = http.StatusInternalServerError
+	}
+	if mock.ErrorStatus < 400 || mock.ErrorStatus > 599 {
+		return fmt.Errorf("error_status must be a 4xx or 5xx status")
+	}
+
+	var data []byte
+	switch {
+	case mock.Template != "":
+		parsed, err := template.New("mock").Funcs(mockFuncs).Parse(mock.Template)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		mock.template = parsed
+		return nil
+	case mock.File != "":
+		contents, err := os.ReadFile(mock.File)
+		if err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		data = contents
+	default:
+		// Round trip through JSON so YAML values look exactly like a decoded service response
+		encoded, err := json.Marshal(mock.Response)
+		if err != nil {
+			return fmt.Errorf("invalid response: %w", err)
+		}
+		data = encoded
+	}
+
+	response, err := decodeResponse(data)
+	if err != nil {
+		return err
+	}
+	mock.response = response
+	return nil
+}
+
+// decodeResponse decodes a JSON response, which must be an object like a service response
+func decodeResponse(data []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var response map[string]interface{}
+	if err := decoder.Decode(&response); err != nil {
+		return nil, fmt.Errorf("response must be a JSON object: %w", err)
+	}
+	return response, nil
+}
+
+// mockResponse produces the mocked service response of a route. When it returns false the
+// response has already been written, e.g. an injected error.
+func mockResponse(c *gin.Context, routeConfig RouteConfig, params, args map[string]interface{}) (map[string]interface{}, bool) {
+	mock := routeConfig.Mock
+	if mock == nil {
+		problem.Abort(c, http.StatusNotImplemented, problem.NotImplemented, "no mock response defined for this route")
+		return nil, false
+	}
+	c.Header("X-Mock-Response", "true")
+
+	if mock.Latency > 0 {
+		select {
+		case <-time.After(mock.Latency):
+		case <-c.Request.Context().Done():
+			return nil, false
+		}
+	}
+	if mock.ErrorRate > 0 && rand.Float64() < mock.ErrorRate {
+		problem.Abort(c, mock.ErrorStatus, problem.MockError, "injected mock error")
+		return nil, false
+	}
+
+	if mock.template == nil {
+		return mock.response, true
+	}
+	var rendered bytes.Buffer
+	if err := mock.template.Execute(&rendered, gin.H{"Params": params, "Args": args, "RequestID": requestID(c)}); err != nil {
+		problem.Abort(c, http.StatusInternalServerError, problem.InternalError, fmt.Sprintf("mock template failed: %v", err))
+		return nil, false
+	}
+	response, err := decodeResponse(rendered.Bytes())
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, problem.InternalError, fmt.Sprintf("mock template output: %v", err))
+		return nil, false
+	}
+	return response, true
+}
+
+// MockExample returns the response a client would receive from the route's static or file mock,
+// for use as a documentation example, or nil when the route has none
+func MockExample(route RouteConfig) interface{} {
+	if route.Mock == nil || route.Mock.response == nil {
+		return nil
+	}
+	requestID := "3f2b8c1e-5d4a-4e6f-9a7b-1c2d3e4f5a6b"
+	if route.Pagination != nil {
+		return shapePage(route, route.Mock.response, requestID, pageRequest{limit: route.Pagination.DefaultLimit})
+	}
+	return shapeData(route, route.Mock.response, requestID)
+}
@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMockResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		mock       MockConfig
+		wantStatus int
+		want       map[string]interface{}
+		wantCode   problem.Code
+	}{
+		{name: "static", mock: MockConfig{Response: map[string]interface{}{"status": "paid"}}, wantStatus: http.StatusOK, want: map[string]interface{}{"status": "paid"}},
+		{name: "template", mock: MockConfig{Template: `{"payment_id": {{json .Params.payment_id}}, "request_id": {{json .RequestID}}}`}, wantStatus: http.StatusOK, want: map[string]interface{}{"payment_id": "pay_1", "request_id": "req-1"}},
+		{name: "template output not an object", mock: MockConfig{Template: `[{{json .Params.payment_id}}]`}, wantStatus: http.StatusInternalServerError, wantCode: problem.InternalError},
+		{name: "injected error", mock: MockConfig{Response: map[string]interface{}{}, ErrorRate: 1, ErrorStatus: http.StatusServiceUnavailable}, wantStatus: http.StatusServiceUnavailable, wantCode: problem.MockError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mock.Enabled = true
+			route := prepareTestRoute(t, RouteConfig{
+				Path:   "/payments/:payment_id",
+				Type:   http.MethodGet,
+				Params: []ParamConfig{{Name: "payment_id", Type: "string"}},
+				Mock:   &tt.mock,
+			})
+			recorder := serveRoute(route, httptest.NewRequest(http.MethodGet, "/payments/pay_1", nil), func(c *gin.Context) {
+				c.Set("request_id", "req-1")
+			})
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				var body problem.Problem
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+					t.Errorf("body %s, want a %s problem", recorder.Body, tt.wantCode)
+				}
+				return
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid body %s: %v", recorder.Body, err)
+			}
+			for key, value := range tt.want {
+				if body[key] != value {
+					t.Errorf("%s = %#v, want %#v in %s", key, body[key], value, recorder.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareMock(t *testing.T) {
+	tests := []struct {
+		name    string
+		mock    MockConfig
+		wantErr bool
+	}{
+		{name: "template is parsed on load", mock: MockConfig{Template: `{"id": {{json .Params.id}}}`}},
+		{name: "invalid template", mock: MockConfig{Template: `{"id": {{json .Params.id}`}, wantErr: true},
+		{name: "unknown template function", mock: MockConfig{Template: `{"id": {{uuid4}}}`}, wantErr: true},
+		{name: "no source", mock: MockConfig{}, wantErr: true},
+		{name: "two sources", mock: MockConfig{Response: map[string]interface{}{}, Template: `{}`}, wantErr: true},
+		{name: "error rate above 1", mock: MockConfig{Response: map[string]interface{}{}, ErrorRate: 1.5}, wantErr: true},
+		{name: "error status not an error", mock: MockConfig{Response: map[string]interface{}{}, ErrorStatus: http.StatusOK}, wantErr: true},
+		{name: "response not an object", mock: MockConfig{Response: []interface{}{1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := prepareMock(&tt.mock)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && tt.mock.Template != "" && tt.mock.template == nil {
+				t.Error("template was not stored on the route")
+			}
+		})
+	}
+}
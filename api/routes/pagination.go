@@ -0,0 +1,254 @@
+package routes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PaginationConfig gives a list route the standard limit and cursor or offset query params. They are
+// passed to the service as args.pagination, and the page is returned as data with meta.pagination
+// and RFC 8288 Link headers.
+type PaginationConfig struct {
+	Mode         string `mapstructure:"mode"`          // cursor (default) or offset
+	DefaultLimit int    `mapstructure:"default_limit"` // Limit when the client sends none (default: 20)
+	MaxLimit     int    `mapstructure:"max_limit"`     // Largest limit accepted (default: 100)
+	ItemsField   string `mapstructure:"items_field"`   // Service response field holding the items (default: items)
+}
+
+// The service returns the items with next_cursor (cursor mode) and, optionally, total
+const (
+	nextCursorField = "next_cursor"
+	totalField      = "total"
+	paginationKey   = "pagination"
+)
+
+// paginationModes lists the valid values of a pagination block's mode
+var paginationModes = map[string]bool{
+	"cursor": true,
+	"offset": true,
+}
+
+// pageRequest is the validated page a client asked for
+type pageRequest struct {
+	limit  int
+	cursor string
+	offset int
+}
+
+// preparePagination fills in the defaults of a pagination block and declares its query params
+func preparePagination(route *RouteConfig) error {
+	pagination := route.Pagination
+	if pagination.Mode == "" {
+		pagination.Mode = "cursor"
+	}
+	if !paginationModes[pagination.Mode] {
+		return fmt.Errorf("invalid mode %q (expected cursor or offset)", pagination.Mode)
+	}
+	if pagination.MaxLimit == 0 {
+		pagination.MaxLimit = 100
+	}
+	if pagination.DefaultLimit == 0 {
+		pagination.DefaultLimit = min(20, pagination.MaxLimit)
+	}
+	if pagination.DefaultLimit < 1 || pagination.DefaultLimit > pagination.MaxLimit {
+		return fmt.Errorf("default_limit must be between 1 and max_limit")
+	}
+	if pagination.ItemsField == "" {
+		pagination.ItemsField = "items"
+	}
+	if envelope := route.ResponseStructure.Envelope; envelope != nil && !*envelope {
+		return fmt.Errorf("pagination requires the response envelope, meta.pagination is part of it")
+	}
+	envelope := true
+	route.ResponseStructure.Envelope = &envelope
+
+	minLimit, maxLimit, minOffset, maxCursor := 1.0, float64(pagination.MaxLimit), 0.0, 1024
+	params := []ParamConfig{{
+		Name: "limit", In: "query", Type: "integer", Minimum: &minLimit, Maximum: &maxLimit,
+		Default: pagination.DefaultLimit, Description: "Maximum number of items to return",
+	}}
+	if pagination.Mode == "cursor" {
+		params = append(params, ParamConfig{
+			Name: "cursor", In: "query", Type: "string", MaxLength: &maxCursor,
+			Description: "next_cursor of the previous page; the first page is returned without it",
+		})
+	} else {
+		params = append(params, ParamConfig{
+			Name: "offset", In: "query", Type: "integer", Minimum: &minOffset, Default: 0,
+			Description: "Number of items to skip",
+		})
+	}
+	for _, param := range route.Params {
+		for _, reserved := range params {
+			if param.Name == reserved.Name {
+				return fmt.Errorf("param %s is declared by pagination", param.Name)
+			}
+		}
+	}
+	// Copied so the params of the raw definition are left untouched
+	route.Params = append(append([]ParamConfig{}, route.Params...), params...)
+	return nil
+}
+
+// paginationArgs returns the args with the page params moved into the standard args.pagination shape
+// and records the page for the response. The args are copied first, as without arg mappings they are
+// the validated params, which mocks still read.
+func paginationArgs(c *gin.Context, routeConfig RouteConfig, params map[string]interface{}) map[string]interface{} {
+	args := make(map[string]interface{}, len(params)+1)
+	for key, value := range params {
+		args[key] = value
+	}
+	page := pageRequest{}
+	page.limit, _ = convertToInt(args["limit"])
+	delete(args, "limit")
+	arg := map[string]interface{}{"limit": page.limit}
+
+	if routeConfig.Pagination.Mode == "cursor" {
+		page.cursor, _ = args["cursor"].(string)
+		delete(args, "cursor")
+		if page.cursor != "" {
+			arg["cursor"] = page.cursor
+		}
+	} else {
+		page.offset, _ = convertToInt(args["offset"])
+		delete(args, "offset")
+		arg["offset"] = page.offset
+	}
+	args[paginationKey] = arg
+	c.Set(paginationKey, page)
+	return args
+}
+
+// pageItems returns the items of a paginated service response, or an error when they are not a list
+func pageItems(routeConfig RouteConfig, response map[string]interface{}) ([]interface{}, error) {
+	value, exists := response[routeConfig.Pagination.ItemsField]
+	if !exists || value == nil {
+		return []interface{}{}, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: expected array, got %s", routeConfig.Pagination.ItemsField, jsonKind(value))
+	}
+	return items, nil
+}
+
+// checkPageContract validates every item of a paginated service response against the response fields
+func checkPageContract(routeConfig RouteConfig, response map[string]interface{}) []string {
+	items, err := pageItems(routeConfig, response)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var violations []string
+	for i, item := range items {
+		path := fmt.Sprintf("%s[%d]", routeConfig.Pagination.ItemsField, i)
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			violations = append(violations, fmt.Sprintf("%s: expected object, got %s", path, jsonKind(item)))
+			continue
+		}
+		violations = append(violations, checkContract(routeConfig.ResponseStructure.Fields, object, path)...)
+	}
+	return violations
+}
+
+// shapePage returns a page as {data: [items], request_id, meta: {pagination}}, each item projected
+// onto the response fields
+func shapePage(routeConfig RouteConfig, response map[string]interface{}, requestID string, page pageRequest) gin.H {
+	items, _ := pageItems(routeConfig, response)
+	data := make([]interface{}, len(items))
+	for i, item := range items {
+		data[i] = item
+		if object, ok := item.(map[string]interface{}); ok && len(routeConfig.ResponseStructure.Fields) > 0 {
+			data[i] = projectObject(routeConfig.ResponseStructure.Fields, object)
+		}
+	}
+	return gin.H{
+		"data":       data,
+		"request_id": requestID,
+		"meta":       gin.H{"pagination": pageMeta(routeConfig, response, page, len(items))},
+	}
+}
+
+// pageMeta describes the returned page; has_more comes from next_cursor, or total when known
+func pageMeta(routeConfig RouteConfig, response map[string]interface{}, page pageRequest, count int) gin.H {
+	meta := gin.H{"limit": page.limit}
+	total, err := convertToInt(response[totalField])
+	if err == nil {
+		meta["total"] = total
+	}
+
+	if routeConfig.Pagination.Mode == "cursor" {
+		nextCursor, _ := response[nextCursorField].(string)
+		meta["has_more"] = nextCursor != ""
+		if nextCursor != "" {
+			meta["next_cursor"] = nextCursor
+		} else {
+			meta["next_cursor"] = nil
+		}
+		return meta
+	}
+
+	meta["offset"] = page.offset
+	if err == nil {
+		meta["has_more"] = page.offset+count < total
+	} else {
+		meta["has_more"] = count == page.limit
+	}
+	return meta
+}
+
+// setPageLinks adds the RFC 8288 Link header with the next, previous, first and last pages, as far
+// as the pagination mode and the response allow
+func setPageLinks(c *gin.Context, routeConfig RouteConfig, page pageRequest, meta gin.H) {
+	link := func(rel string, values map[string]interface{}) string {
+		target := *c.Request.URL
+		query := target.Query()
+		for name, value := range values {
+			if value == nil {
+				query.Del(name)
+				continue
+			}
+			query.Set(name, fmt.Sprint(value))
+		}
+		target.RawQuery = query.Encode()
+		return fmt.Sprintf(`<%s>; rel="%s"`, target.RequestURI(), rel)
+	}
+
+	var links []string
+	if routeConfig.Pagination.Mode == "cursor" {
+		if nextCursor, ok := meta["next_cursor"].(string); ok {
+			links = append(links, link("next", map[string]interface{}{"cursor": nextCursor, "limit": page.limit}))
+		}
+		if page.cursor != "" {
+			links = append(links, link("first", map[string]interface{}{"cursor": nil, "limit": page.limit}))
+		}
+	} else {
+		if meta["has_more"] == true {
+			links = append(links, link("next", map[string]interface{}{"offset": page.offset + page.limit, "limit": page.limit}))
+		}
+		if page.offset > 0 {
+			links = append(links, link("prev", map[string]interface{}{"offset": max(page.offset-page.limit, 0), "limit": page.limit}))
+			links = append(links, link("first", map[string]interface{}{"offset": 0, "limit": page.limit}))
+		}
+		if total, ok := meta["total"].(int); ok && total > 0 {
+			links = append(links, link("last", map[string]interface{}{"offset": (total - 1) / page.limit * page.limit, "limit": page.limit}))
+		}
+	}
+	if len(links) > 0 {
+		// Added rather than set, so the successor-version link of deprecated routes is kept
+		c.Writer.Header().Add("Link", strings.Join(links, ", "))
+	}
+}
+
+// shapePageResponse shapes a paginated response for the current request and sets its Link header
+func shapePageResponse(c *gin.Context, routeConfig RouteConfig, response map[string]interface{}) interface{} {
+	page := pageRequest{limit: routeConfig.Pagination.DefaultLimit}
+	if value, exists := c.Get(paginationKey); exists {
+		page = value.(pageRequest)
+	}
+	body := shapePage(routeConfig, response, requestID(c), page)
+	setPageLinks(c, routeConfig, page, body["meta"].(gin.H)["pagination"].(gin.H))
+	return body
+}
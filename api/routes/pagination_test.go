@@ -0,0 +1,149 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPagination(t *testing.T) {
+	tests := []struct {
+		name       string
+		pagination PaginationConfig
+		successor  string
+		target     string
+		service    string // Mocked service response; items holds the args it received
+		wantStatus int
+		wantArgs   map[string]interface{}
+		wantMeta   map[string]interface{}
+		wantLinks  []string
+	}{
+		{
+			name:     "first cursor page",
+			target:   "/payments?limit=2&status=paid",
+			service:  `{"items":[{{json .Args}}],"next_cursor":"c2"}`,
+			wantArgs: map[string]interface{}{"status": "paid", "pagination": map[string]interface{}{"limit": 2.0}},
+			wantMeta: map[string]interface{}{"limit": 2.0, "has_more": true, "next_cursor": "c2"},
+			wantLinks: []string{
+				`</payments?cursor=c2&limit=2&status=paid>; rel="next"`,
+			},
+		},
+		{
+			name:      "last cursor page",
+			target:    "/payments?cursor=c2",
+			service:   `{"items":[{{json .Args}}],"next_cursor":"","total":3}`,
+			wantArgs:  map[string]interface{}{"pagination": map[string]interface{}{"limit": 20.0, "cursor": "c2"}},
+			wantMeta:  map[string]interface{}{"limit": 20.0, "has_more": false, "next_cursor": nil, "total": 3.0},
+			wantLinks: []string{`</payments?limit=20>; rel="first"`},
+		},
+		{
+			name:       "offset page with total",
+			pagination: PaginationConfig{Mode: "offset"},
+			target:     "/payments?offset=20&limit=10",
+			service:    `{"items":[{{json .Args}}],"total":45}`,
+			wantArgs:   map[string]interface{}{"pagination": map[string]interface{}{"limit": 10.0, "offset": 20.0}},
+			wantMeta:   map[string]interface{}{"limit": 10.0, "offset": 20.0, "total": 45.0, "has_more": true},
+			wantLinks: []string{
+				`</payments?limit=10&offset=30>; rel="next", </payments?limit=10&offset=10>; rel="prev", </payments?limit=10&offset=0>; rel="first", </payments?limit=10&offset=40>; rel="last"`,
+			},
+		},
+		{
+			name:       "offset page without total",
+			pagination: PaginationConfig{Mode: "offset"},
+			target:     "/payments?limit=1",
+			service:    `{"items":[{{json .Args}}]}`,
+			wantArgs:   map[string]interface{}{"pagination": map[string]interface{}{"limit": 1.0, "offset": 0.0}},
+			wantMeta:   map[string]interface{}{"limit": 1.0, "offset": 0.0, "has_more": true},
+			wantLinks:  []string{`</payments?limit=1&offset=1>; rel="next"`},
+		},
+		{
+			name:      "deprecation link kept",
+			successor: "/v2/payments",
+			target:    "/payments",
+			service:   `{"items":[{{json .Args}}],"next_cursor":"c2"}`,
+			wantArgs:  map[string]interface{}{"pagination": map[string]interface{}{"limit": 20.0}},
+			wantMeta:  map[string]interface{}{"limit": 20.0, "has_more": true, "next_cursor": "c2"},
+			wantLinks: []string{`</v2/payments>; rel="successor-version"`, `</payments?cursor=c2&limit=20>; rel="next"`},
+		},
+		{name: "limit above max_limit", target: "/payments?limit=101", service: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "limit below 1", target: "/payments?limit=0", service: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "negative offset", pagination: PaginationConfig{Mode: "offset"}, target: "/payments?offset=-1", service: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "items not a list", target: "/payments", service: `{"items":{"id":"a"}}`, wantStatus: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pagination := tt.pagination
+			route := RouteConfig{
+				Path:         "/payments",
+				Type:         http.MethodGet,
+				Params:       []ParamConfig{{Name: "status", Type: "string"}},
+				Pagination:   &pagination,
+				Successor:    tt.successor,
+				ContractMode: "enforce",
+				Mock:         &MockConfig{Enabled: true, Template: tt.service},
+			}
+			route = prepareTestRoute(t, route)
+			recorder := serveRoute(route, httptest.NewRequest(http.MethodGet, tt.target, nil), buildMiddlewareStack(nil, route, testConfig(), testLogger)...)
+
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if recorder.Code != wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body, wantStatus)
+			}
+			if wantStatus != http.StatusOK {
+				return
+			}
+			var body struct {
+				Data []map[string]interface{} `json:"data"`
+				Meta struct {
+					Pagination map[string]interface{} `json:"pagination"`
+				} `json:"meta"`
+			}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || len(body.Data) != 1 {
+				t.Fatalf("invalid body %s: %v", recorder.Body, err)
+			}
+			if !reflect.DeepEqual(body.Data[0], tt.wantArgs) {
+				t.Errorf("service args %v, want %v", body.Data[0], tt.wantArgs)
+			}
+			if !reflect.DeepEqual(body.Meta.Pagination, tt.wantMeta) {
+				t.Errorf("meta.pagination %v, want %v", body.Meta.Pagination, tt.wantMeta)
+			}
+			if links := recorder.Header().Values("Link"); !reflect.DeepEqual(links, tt.wantLinks) {
+				t.Errorf("Link %q, want %q", links, tt.wantLinks)
+			}
+		})
+	}
+}
+
+func TestPreparePagination(t *testing.T) {
+	envelope := false
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		wantErr bool
+	}{
+		{name: "defaults", route: RouteConfig{Pagination: &PaginationConfig{}}},
+		{name: "unknown mode", route: RouteConfig{Pagination: &PaginationConfig{Mode: "page"}}, wantErr: true},
+		{name: "default above max", route: RouteConfig{Pagination: &PaginationConfig{DefaultLimit: 50, MaxLimit: 10}}, wantErr: true},
+		{name: "without envelope", route: RouteConfig{Pagination: &PaginationConfig{}, ResponseStructure: ResponseConfig{Envelope: &envelope}}, wantErr: true},
+		{name: "reserved param", route: RouteConfig{Pagination: &PaginationConfig{}, Params: []ParamConfig{{Name: "limit"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := preparePagination(&tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				pagination := tt.route.Pagination
+				if pagination.Mode != "cursor" || pagination.DefaultLimit != 20 || pagination.MaxLimit != 100 || pagination.ItemsField != "items" || len(tt.route.Params) != 2 {
+					t.Errorf("got %+v with %d params, want the defaults and the limit and cursor params", pagination, len(tt.route.Params))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,700 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"caaspay-api-go/internal/logging"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+func validateAndExtractParams(c *gin.Context, routeConfig RouteConfig, logger *logging.Logger) (map[string]interface{}, error) {
+	body := make(map[string]interface{})
+
+	// Extract parameters from the request body for POST/PUT/PATCH, and for DELETE when a body is sent,
+	// within the route's body limits. Routes with file params read a multipart/form-data body instead.
+	if routeConfig.multipart {
+		form, err := readMultipart(c, routeConfig)
+		if err != nil {
+			return nil, err
+		}
+		body = form
+	} else if AcceptsBody(c.Request.Method) || (c.Request.Method == http.MethodDelete && c.Request.ContentLength > 0) {
+		decoded, err := readJSONBody(c, routeConfig)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+
+	// Read each parameter from its declared location only, so a query string
+	// can't override a body field
+	args := make(map[string]interface{})
+	declared := map[string]map[string]bool{"body": {}, "query": {}}
+	for _, param := range routeConfig.Params {
+		if declared[param.In] != nil {
+			declared[param.In][param.Name] = true
+		}
+		value, exists, err := lookupParam(c, param, body)
+		if err != nil {
+			return nil, fieldProblem(param.Name, err)
+		}
+		if exists {
+			args[param.Name] = value
+		} else if param.Default != nil {
+			// Fall back to the declared default when the parameter was not provided
+			args[param.Name] = param.Default
+		}
+	}
+
+	// Handle body and query params that are not declared for the route
+	unknown := map[string]interface{}{}
+	for key, value := range body {
+		if !declared["body"][key] {
+			unknown[key] = value
+		}
+	}
+	for key, values := range c.Request.URL.Query() {
+		if declared["query"][key] || len(values) == 0 {
+			continue
+		}
+		if len(values) == 1 {
+			unknown[key] = values[0]
+			continue
+		}
+		// A repeated key is passed through as an array of all its values
+		items := make([]interface{}, len(values))
+		for i, value := range values {
+			items[i] = value
+		}
+		unknown[key] = items
+	}
+	if len(unknown) > 0 {
+		keys := sortedKeys(unknown)
+		switch routeConfig.UnknownParams {
+		case "reject":
+			unknownProblem := problem.New(http.StatusBadRequest, problem.ParamUnknown, fmt.Sprintf("unknown parameters: %s", strings.Join(keys, ", ")))
+			for _, key := range keys {
+				unknownProblem.Errors = append(unknownProblem.Errors, problem.FieldError{Field: key, Code: problem.ParamUnknown, Message: "parameter is not accepted by this route"})
+			}
+			return nil, unknownProblem
+		case "passthrough":
+			// Tagged on the context so the request log lists them
+			logger.LogWithStats("info", "Passing through unvalidated params", map[string]string{
+				"metric_name": "unknown_params",
+				"route":       routeConfig.Type + " " + routeConfig.Path,
+				"mode":        "passthrough",
+			}, map[string]interface{}{"params": keys})
+			c.Set("unvalidated_params", keys)
+		default:
+			logger.LogWithStats("debug", "Dropped unknown params", map[string]string{
+				"metric_name": "unknown_params",
+				"route":       routeConfig.Type + " " + routeConfig.Path,
+				"mode":        "drop",
+			}, map[string]interface{}{"params": keys})
+		}
+	}
+
+	for _, param := range routeConfig.Params {
+		paramValue, exists := args[param.Name]
+
+		// If the parameter is required but not provided
+		if !exists {
+			if param.Required {
+				return nil, problem.Field(problem.ParamMissing, param.Name, fmt.Sprintf("missing required parameter: %s - %s", param.Name, generateDescription(param)))
+			}
+			continue
+		}
+
+		// Uploaded files are replaced by their metadata and content
+		if param.Type == "file" {
+			upload, err := readUpload(c, routeConfig, param, paramValue)
+			if err != nil {
+				return nil, problem.Field(problem.ParamInvalid, param.Name, err.Error())
+			}
+			args[param.Name] = upload
+			continue
+		}
+
+		// Validate its type and constraints
+		value, err := validateValue(param.Name, param, paramValue, args)
+		if err != nil {
+			return nil, fieldProblem(param.Name, err)
+		}
+		args[param.Name] = value
+	}
+
+	// Unvalidated params are forwarded for legacy services; declared params keep precedence
+	if routeConfig.UnknownParams == "passthrough" {
+		for key, value := range unknown {
+			if _, isFile := value.(*multipart.FileHeader); isFile {
+				continue
+			}
+			if _, exists := args[key]; !exists {
+				args[key] = value
+			}
+		}
+	}
+
+	return args, nil
+}
+
+// unknownParamModes lists the valid values of the unknown_params setting
+var unknownParamModes = map[string]bool{
+	"reject":      true,
+	"drop":        true,
+	"passthrough": true,
+}
+
+// unknownProperties returns the sorted keys of an object that its parameter doesn't declare
+func unknownProperties(param ParamConfig, object map[string]interface{}) []string {
+	declared := make(map[string]bool, len(param.Properties))
+	for _, property := range param.Properties {
+		declared[property.Name] = true
+	}
+	unknown := map[string]interface{}{}
+	for key, value := range object {
+		if !declared[key] {
+			unknown[key] = value
+		}
+	}
+	return sortedKeys(unknown)
+}
+
+// sortedKeys returns the keys of a map in a stable order for messages and logs
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// lookupParam reads a parameter from its declared location
+func lookupParam(c *gin.Context, param ParamConfig, body map[string]interface{}) (interface{}, bool, error) {
+	switch param.In {
+	case "path":
+		if value := c.Param(param.Name); value != "" {
+			return value, true, nil
+		}
+	case "query":
+		if param.Type == "array" {
+			if values, exists := c.GetQueryArray(param.Name); exists {
+				items, err := queryArray(param, values)
+				return items, true, err
+			}
+			break
+		}
+		if value, exists := c.GetQuery(param.Name); exists {
+			return value, true, nil
+		}
+	case "header":
+		if values := c.Request.Header.Values(param.Name); len(values) > 0 {
+			return values[0], true, nil
+		}
+	case "cookie":
+		if value, err := c.Cookie(param.Name); err == nil {
+			return value, true, nil
+		}
+	case "body":
+		value, exists := body[param.Name]
+		return value, exists, nil
+	}
+	return nil, false, nil
+}
+
+// queryStyles lists the valid values of an array query parameter's style
+var queryStyles = map[string]bool{
+	"repeated": true,
+	"comma":    true,
+}
+
+// queryArray collects the items of an array query parameter from repeated keys and comma-separated
+// values, as its style allows; comma style rejects repeated keys rather than dropping their values.
+// A single JSON array (?ids=[1,2]) is still accepted unless a style is set.
+func queryArray(param ParamConfig, values []string) (interface{}, error) {
+	if param.Style == "" && len(values) == 1 && strings.HasPrefix(strings.TrimSpace(values[0]), "[") {
+		return values[0], nil
+	}
+	if param.Style == "comma" && len(values) > 1 {
+		return nil, paramErrorf(param.Name, problem.ParamInvalid, "invalid parameter value for %s: repeated keys are not accepted, send comma-separated values - %s", param.Name, generateDescription(param))
+	}
+
+	items := []interface{}{}
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if param.Style == "repeated" {
+			items = append(items, value)
+			continue
+		}
+		for _, item := range strings.Split(value, ",") {
+			items = append(items, strings.TrimSpace(item))
+		}
+	}
+	return items, nil
+}
+
+// paramLocations lists the valid values of a parameter's `in` field
+var paramLocations = map[string]bool{
+	"path":   true,
+	"query":  true,
+	"header": true,
+	"cookie": true,
+	"body":   true,
+}
+
+// resolveParamLocations checks each parameter's declared location and fills in the default one:
+// parameters named after a path segment come from the path, the others from the body
+// on POST/PUT/PATCH routes and from the query string otherwise.
+func resolveParamLocations(route *RouteConfig) error {
+	pathParams := map[string]bool{}
+	for _, name := range PathParams(route.Path) {
+		pathParams[name] = true
+	}
+
+	for i := range route.Params {
+		param := &route.Params[i]
+		param.In = strings.ToLower(strings.TrimSpace(param.In))
+		if param.In == "" {
+			switch {
+			case pathParams[param.Name]:
+				param.In = "path"
+			case AcceptsBody(route.Type):
+				param.In = "body"
+			default:
+				param.In = "query"
+			}
+		}
+
+		if !paramLocations[param.In] {
+			return fmt.Errorf("param %s: unknown location %q", param.Name, param.In)
+		}
+		if param.In == "path" && !pathParams[param.Name] {
+			return fmt.Errorf("param %s: not a segment of path %s", param.Name, route.Path)
+		}
+		if param.In == "body" && !AcceptsBody(route.Type) && route.Type != http.MethodDelete {
+			return fmt.Errorf("param %s: %s requests have no body", param.Name, route.Type)
+		}
+		if param.Style != "" {
+			if !queryStyles[param.Style] {
+				return fmt.Errorf("param %s: invalid style %q (expected repeated or comma)", param.Name, param.Style)
+			}
+			if param.Type != "array" || param.In != "query" {
+				return fmt.Errorf("param %s: style only applies to array query params", param.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// paramError is a parameter that failed validation, located by its path within the request, e.g.
+// items[2].amount, so the problem names the offending field rather than its top-level param
+type paramError struct {
+	path    string
+	code    problem.Code
+	message string
+}
+
+func (e *paramError) Error() string {
+	return e.message
+}
+
+// paramErrorf creates the error of the param at path
+func paramErrorf(path string, code problem.Code, format string, args ...interface{}) error {
+	return &paramError{path: path, code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// fieldProblem converts a validation error of the named param into a 400 problem about the field
+// that caused it
+func fieldProblem(name string, err error) *problem.Problem {
+	var paramErr *paramError
+	if errors.As(err, &paramErr) {
+		return problem.Field(paramErr.code, paramErr.path, paramErr.message)
+	}
+	return problem.Field(problem.ParamInvalid, name, err.Error())
+}
+
+// validateValue checks a value against its parameter definition and returns it converted to the declared type.
+// path locates the value in the request (e.g. items[2].amount) and is used in error messages;
+// siblings holds the other values of the enclosing object, used to resolve money currencies.
+func validateValue(path string, param ParamConfig, paramValue interface{}, siblings map[string]interface{}) (interface{}, error) {
+	switch param.Type {
+	case "string":
+		// Validate against the pattern if one is provided
+		value, ok := paramValue.(string)
+		if !ok {
+			return nil, paramErrorf(path, problem.ParamInvalid, "unable to parse parameter %s: - %s", path, generateDescription(param))
+		}
+		if param.Pattern != "" && !matchPattern(param, value) {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: does not match pattern %s - %s", path, param.Pattern, generateDescription(param))
+		}
+		length := utf8.RuneCountInString(value)
+		if param.MinLength != nil && length < *param.MinLength {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: shorter than %d characters - %s", path, *param.MinLength, generateDescription(param))
+		}
+		if param.MaxLength != nil && length > *param.MaxLength {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: longer than %d characters - %s", path, *param.MaxLength, generateDescription(param))
+		}
+		if param.Format != "" && !formatValidators[param.Format](value) {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: not a valid %s - %s", path, param.Format, generateDescription(param))
+		}
+		return value, checkEnum(path, param, value)
+
+	case "integer":
+		// Handle int conversion for both string and numeric input
+		intValue, err := convertToInt(paramValue)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected int - %s", path, generateDescription(param))
+		}
+		if err := checkRange(path, param, float64(intValue)); err != nil {
+			return nil, err
+		}
+		return intValue, checkEnum(path, param, intValue)
+
+	case "number":
+		// Handle float conversion for both string and numeric input
+		floatValue, err := convertToFloat(paramValue)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected float - %s", path, generateDescription(param))
+		}
+		if err := checkRange(path, param, floatValue); err != nil {
+			return nil, err
+		}
+		return floatValue, checkEnum(path, param, floatValue)
+
+	case "decimal", "money":
+		value, err := validateDecimal(path, param, paramValue, siblings)
+		if err != nil {
+			return nil, err
+		}
+		// The enum holds amounts, so it is checked against the input rather than minor units
+		return value, checkEnum(path, param, paramValue)
+
+	case "boolean":
+		// Handle boolean conversion for both string and native bool
+		boolValue, err := convertToBool(paramValue)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected bool - %s", path, generateDescription(param))
+		}
+		return boolValue, checkEnum(path, param, boolValue)
+
+	case "object":
+		object, err := convertToObject(paramValue)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected object - %s", path, generateDescription(param))
+		}
+		// Objects without declared properties are passed through as-is
+		if len(param.Properties) == 0 {
+			return object, nil
+		}
+
+		// Declared properties are validated recursively, the others follow the unknown_params mode
+		result := make(map[string]interface{}, len(param.Properties))
+		if unknown := unknownProperties(param, object); len(unknown) > 0 {
+			switch param.unknownParams {
+			case "reject":
+				return nil, paramErrorf(path, problem.ParamUnknown, "unknown parameters: %s.%s", path, strings.Join(unknown, ", "+path+"."))
+			case "passthrough":
+				for _, key := range unknown {
+					result[key] = object[key]
+				}
+			}
+		}
+		for _, property := range param.Properties {
+			propertyPath := path + "." + property.Name
+			propertyValue, exists := object[property.Name]
+			if !exists && property.Default != nil {
+				propertyValue, exists = property.Default, true
+			}
+			if !exists {
+				if property.Required {
+					return nil, paramErrorf(propertyPath, problem.ParamMissing, "missing required parameter: %s - %s", propertyPath, generateDescription(property))
+				}
+				continue
+			}
+			value, err := validateValue(propertyPath, property, propertyValue, object)
+			if err != nil {
+				return nil, err
+			}
+			result[property.Name] = value
+		}
+		return result, nil
+
+	case "array":
+		items, err := convertToArray(paramValue)
+		if err != nil {
+			return nil, paramErrorf(path, problem.ParamInvalid, "invalid parameter type for %s: expected array - %s", path, generateDescription(param))
+		}
+		// Arrays without an item definition are passed through as-is
+		if param.Items == nil {
+			return items, nil
+		}
+
+		// Object items resolve currency_param among their own properties, other items among the
+		// array's siblings
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := validateValue(fmt.Sprintf("%s[%d]", path, i), *param.Items, item, siblings)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = value
+		}
+		return result, nil
+	}
+
+	return paramValue, nil
+}
+
+// matchPattern matches a value against the parameter pattern, compiled once by LoadRouteConfigs
+func matchPattern(param ParamConfig, value string) bool {
+	if param.pattern != nil {
+		return param.pattern.MatchString(value)
+	}
+	matched, err := regexp.MatchString(param.Pattern, value)
+	return err == nil && matched
+}
+
+// checkRange enforces the minimum and maximum of a numeric parameter
+func checkRange(path string, param ParamConfig, value float64) error {
+	if param.Minimum != nil && value < *param.Minimum {
+		return paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: less than minimum %v - %s", path, *param.Minimum, generateDescription(param))
+	}
+	if param.Maximum != nil && value > *param.Maximum {
+		return paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: greater than maximum %v - %s", path, *param.Maximum, generateDescription(param))
+	}
+	return nil
+}
+
+// checkEnum ensures the value is one of the allowed values, when an enum is declared
+func checkEnum(path string, param ParamConfig, value interface{}) error {
+	if len(param.Enum) == 0 {
+		return nil
+	}
+	key, err := enumKey(param, value)
+	if err == nil {
+		for _, allowed := range param.Enum {
+			if allowedKey, err := enumKey(param, allowed); err == nil && allowedKey == key {
+				return nil
+			}
+		}
+	}
+	return paramErrorf(path, problem.ParamInvalid, "invalid parameter value for %s: must be one of %v - %s", path, param.Enum, generateDescription(param))
+}
+
+// enumKey converts a value to the parameter's type for enum comparison. Numbers are compared by
+// their exact decimal value, so 10, 10.0 and "10.00" are the same amount but "true" is not true.
+func enumKey(param ParamConfig, value interface{}) (interface{}, error) {
+	switch param.Type {
+	case "integer", "number", "decimal", "money":
+		if param.Type == "number" {
+			floatValue, err := convertToFloat(value)
+			if err != nil {
+				return nil, err
+			}
+			value = floatValue
+		}
+		d, err := parseDecimal(value)
+		if err != nil {
+			return nil, err
+		}
+		if param.Type == "integer" && d.scale() > 0 {
+			return nil, fmt.Errorf("not an integer: %s", d.format(0))
+		}
+		return d.format(0), nil
+	case "boolean":
+		return convertToBool(value)
+	case "string":
+		if _, ok := value.(string); !ok {
+			return nil, fmt.Errorf("not a string: %v", value)
+		}
+	}
+	return value, nil
+}
+
+// prepareParams compiles patterns and checks formats and defaults of the parameters, recursively,
+// and records the route's unknown_params mode on them.
+// It runs once when the route configuration is loaded so requests don't pay for it.
+func prepareParams(params []ParamConfig, unknownParams string) error {
+	return prepareSiblingParams(params, params, unknownParams)
+}
+
+// prepareSiblingParams prepares params declared next to siblings, which a currency_param must name.
+// Array items are declared next to their array's siblings.
+func prepareSiblingParams(params, siblings []ParamConfig, unknownParams string) error {
+	for i := range params {
+		param := &params[i]
+		param.unknownParams = unknownParams
+		if param.Pattern != "" {
+			compiled, err := regexp.Compile(param.Pattern)
+			if err != nil {
+				return fmt.Errorf("param %s: invalid pattern: %w", param.Name, err)
+			}
+			param.pattern = compiled
+		}
+		if param.Format != "" {
+			if _, ok := formatValidators[param.Format]; !ok {
+				return fmt.Errorf("param %s: unknown format %q", param.Name, param.Format)
+			}
+		}
+		if param.Type == "money" {
+			if param.Currency == "" && param.CurrencyParam == "" {
+				return fmt.Errorf("param %s: money requires currency or currency_param", param.Name)
+			}
+			if _, ok := currencyMinorUnits[param.Currency]; param.Currency != "" && !ok {
+				return fmt.Errorf("param %s: unknown currency %q", param.Name, param.Currency)
+			}
+			if param.CurrencyParam != "" && !slices.ContainsFunc(siblings, func(sibling ParamConfig) bool { return sibling.Name == param.CurrencyParam }) {
+				return fmt.Errorf("param %s: currency_param %q is not a sibling param", param.Name, param.CurrencyParam)
+			}
+		}
+		for _, allowed := range param.Enum {
+			if _, err := enumKey(*param, allowed); err != nil {
+				return fmt.Errorf("param %s: invalid enum value %v: %w", param.Name, allowed, err)
+			}
+		}
+		if param.Output != "" && param.Output != "string" && param.Output != "minor_units" {
+			return fmt.Errorf("param %s: unknown output %q (expected string or minor_units)", param.Name, param.Output)
+		}
+		if err := prepareParams(param.Properties, unknownParams); err != nil {
+			return fmt.Errorf("param %s: %w", param.Name, err)
+		}
+		if param.Items != nil {
+			items := []ParamConfig{*param.Items}
+			if err := prepareSiblingParams(items, siblings, unknownParams); err != nil {
+				return fmt.Errorf("param %s: %w", param.Name, err)
+			}
+			param.Items = &items[0]
+		}
+		if param.Default != nil && param.CurrencyParam == "" {
+			if _, err := validateValue(param.Name, *param, param.Default, nil); err != nil {
+				return fmt.Errorf("param %s: invalid default: %w", param.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Helper function to convert to int
+func convertToInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case json.Number:
+		// Integral values such as 1.0 are accepted, fractions are not
+		if intValue, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return int(intValue), nil
+		}
+		d, err := parseDecimal(v)
+		if err != nil || d.scale() > 0 {
+			return 0, fmt.Errorf("not an integer: %s", v)
+		}
+		return strconv.Atoi(d.format(0))
+	case float64:
+		return int(v), nil
+	case int:
+		return v, nil
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, fmt.Errorf("unsupported type for int conversion: %v", reflect.TypeOf(value))
+	}
+}
+
+// Helper function to convert to float
+func convertToFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	default:
+		return 0, fmt.Errorf("unsupported type for float conversion: %v", reflect.TypeOf(value))
+	}
+}
+
+// Helper function to convert to bool
+func convertToBool(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(v)
+	default:
+		return false, fmt.Errorf("unsupported type for bool conversion: %v", reflect.TypeOf(value))
+	}
+}
+
+// Helper function to convert to an object, accepting JSON-encoded strings from the query or path
+func convertToObject(value interface{}) (map[string]interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, nil
+	case string:
+		var object map[string]interface{}
+		err := decodeJSONString(v, &object)
+		return object, err
+	default:
+		return nil, fmt.Errorf("unsupported type for object conversion: %v", reflect.TypeOf(value))
+	}
+}
+
+// Helper function to convert to an array, accepting JSON-encoded strings from the query or path
+func convertToArray(value interface{}) ([]interface{}, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, nil
+	case string:
+		var items []interface{}
+		err := decodeJSONString(v, &items)
+		return items, err
+	default:
+		return nil, fmt.Errorf("unsupported type for array conversion: %v", reflect.TypeOf(value))
+	}
+}
+
+// decodeJSONString decodes JSON passed in a query or path value, keeping numbers exact
+func decodeJSONString(value string, target interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
+
+// generateDescription auto-generates a description for a parameter if not provided
+func generateDescription(param ParamConfig) string {
+	description := fmt.Sprintf("%s (%s)", param.Name, param.Type)
+	if param.Type == "array" && param.Items != nil {
+		description = fmt.Sprintf("%s (array of %s)", param.Name, param.Items.Type)
+	}
+	if param.Required {
+		description += ", required"
+	}
+	if param.Pattern != "" {
+		description += fmt.Sprintf(", pattern: %s", param.Pattern)
+	}
+	if param.Format != "" {
+		description += fmt.Sprintf(", format: %s", param.Format)
+	}
+	if param.Currency != "" {
+		description += fmt.Sprintf(", currency: %s", param.Currency)
+	}
+	if len(param.Enum) > 0 {
+		description += fmt.Sprintf(", one of: %v", param.Enum)
+	}
+	return description
+}
@@ -0,0 +1,401 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUnknownParams(t *testing.T) {
+	tests := []struct {
+		mode        string
+		target      string
+		body        string
+		want        map[string]interface{}
+		wantUnknown []string // Fields of the PARAM_UNKNOWN problem
+	}{
+		{mode: "reject", target: "/payments", body: `{"amount":"10.00"}`, want: map[string]interface{}{"amount": "10.00"}},
+		{mode: "reject", target: "/payments?extra=1", body: `{"amount":"10.00","note":"x"}`, wantUnknown: []string{"extra", "note"}},
+		{mode: "reject", target: "/payments", body: `{"amount":"10.00","meta":{"ref":"r1","x":1}}`, wantUnknown: []string{"meta"}},
+		{mode: "drop", target: "/payments?extra=1", body: `{"amount":"10.00","note":"x"}`, want: map[string]interface{}{"amount": "10.00"}},
+		{mode: "drop", target: "/payments", body: `{"amount":"10.00","meta":{"ref":"r1","x":1}}`, want: map[string]interface{}{"amount": "10.00", "meta": map[string]interface{}{"ref": "r1"}}},
+		{mode: "passthrough", target: "/payments?extra=1", body: `{"amount":"10.00","note":"x"}`, want: map[string]interface{}{"amount": "10.00", "extra": "1", "note": "x"}},
+		{mode: "passthrough", target: "/payments?tag=a&tag=b", body: `{"amount":"10.00"}`, want: map[string]interface{}{"amount": "10.00", "tag": []interface{}{"a", "b"}}},
+		{mode: "passthrough", target: "/payments?amount=99", body: `{"amount":"10.00"}`, want: map[string]interface{}{"amount": "10.00"}},
+		{mode: "passthrough", target: "/payments", body: `{"amount":"10.00","meta":{"ref":"r1","x":"y"}}`, want: map[string]interface{}{"amount": "10.00", "meta": map[string]interface{}{"ref": "r1", "x": "y"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.target+" "+tt.body, func(t *testing.T) {
+			routeConfig := RouteConfig{
+				Path:          "/payments",
+				Type:          http.MethodPost,
+				UnknownParams: tt.mode,
+				BodyLimits:    testBodyLimits,
+				Params: []ParamConfig{
+					{Name: "amount", Type: "string", In: "body", Required: true},
+					{Name: "meta", Type: "object", In: "body", Properties: []ParamConfig{{Name: "ref", Type: "string"}}},
+				},
+			}
+			if err := prepareParams(routeConfig.Params, tt.mode); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			args, err := validateAndExtractParams(c, routeConfig, testLogger)
+			if tt.wantUnknown != nil {
+				var unknownProblem *problem.Problem
+				if !errors.As(err, &unknownProblem) || unknownProblem.Code != problem.ParamUnknown {
+					t.Fatalf("got %v, %v, want a PARAM_UNKNOWN problem", args, err)
+				}
+				var fields []string
+				for _, fieldErr := range unknownProblem.Errors {
+					fields = append(fields, fieldErr.Field)
+				}
+				if !reflect.DeepEqual(fields, tt.wantUnknown) {
+					t.Errorf("unknown fields %v, want %v", fields, tt.wantUnknown)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateAndExtractParams failed: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("args %#v, want %#v", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryArrayParams(t *testing.T) {
+	tests := []struct {
+		style   string
+		query   string
+		want    []interface{}
+		wantErr bool
+	}{
+		{query: "status=pending&status=failed", want: []interface{}{"pending", "failed"}},
+		{query: "status=pending,failed", want: []interface{}{"pending", "failed"}},
+		{query: "status=pending,failed&status=refunded", want: []interface{}{"pending", "failed", "refunded"}},
+		{query: "status=" + url.QueryEscape(`["pending","failed"]`), want: []interface{}{"pending", "failed"}},
+		{style: "repeated", query: "status=pending&status=failed", want: []interface{}{"pending", "failed"}},
+		{style: "repeated", query: "status=pending,failed", want: []interface{}{"pending,failed"}},
+		{style: "comma", query: "status=pending,%20failed", want: []interface{}{"pending", "failed"}},
+		{style: "comma", query: "status=pending&status=failed", wantErr: true},
+		{style: "comma", query: "status=pending,failed&status=refunded", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style+" "+tt.query, func(t *testing.T) {
+			routeConfig := RouteConfig{
+				Path:          "/payments",
+				Type:          http.MethodGet,
+				UnknownParams: "reject",
+				Params:        []ParamConfig{{Name: "status", Type: "array", In: "query", Style: tt.style, Items: &ParamConfig{Type: "string"}}},
+			}
+			if err := prepareParams(routeConfig.Params, "reject"); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/payments?"+tt.query, nil)
+
+			args, err := validateAndExtractParams(c, routeConfig, testLogger)
+			if tt.wantErr {
+				var paramProblem *problem.Problem
+				if !errors.As(err, &paramProblem) || paramProblem.Code != problem.ParamInvalid || len(paramProblem.Errors) != 1 || paramProblem.Errors[0].Field != "status" {
+					t.Fatalf("got %v, %v, want a PARAM_INVALID problem for status", args, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateAndExtractParams failed: %v", err)
+			}
+			if !reflect.DeepEqual(args["status"], tt.want) {
+				t.Errorf("status %#v, want %#v", args["status"], tt.want)
+			}
+		})
+	}
+}
+
+func TestEnum(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   ParamConfig
+		value   interface{}
+		wantErr bool
+	}{
+		{name: "string", param: ParamConfig{Type: "string", Enum: []interface{}{"pending", "paid"}}, value: "paid"},
+		{name: "string not allowed", param: ParamConfig{Type: "string", Enum: []interface{}{"pending", "paid"}}, value: "lost", wantErr: true},
+		{name: "integer from a string", param: ParamConfig{Type: "integer", Enum: []interface{}{10, 20}}, value: "20"},
+		{name: "integer written as a float", param: ParamConfig{Type: "integer", Enum: []interface{}{10, 20}}, value: json.Number("20.0")},
+		{name: "integer not allowed", param: ParamConfig{Type: "integer", Enum: []interface{}{10, 20}}, value: json.Number("15"), wantErr: true},
+		{name: "number", param: ParamConfig{Type: "number", Enum: []interface{}{0.5, 1}}, value: json.Number("1.0")},
+		{name: "number close but not equal", param: ParamConfig{Type: "number", Enum: []interface{}{0.5, 1}}, value: json.Number("0.50000001"), wantErr: true},
+		{name: "decimal trailing zeros", param: ParamConfig{Type: "decimal", Enum: []interface{}{"10.5", 20}}, value: "10.50"},
+		{name: "decimal integer", param: ParamConfig{Type: "decimal", Enum: []interface{}{"10.5", 20}}, value: json.Number("20.00")},
+		{name: "decimal not allowed", param: ParamConfig{Type: "decimal", Enum: []interface{}{"10.5", 20}}, value: "10.05", wantErr: true},
+		{name: "money in minor units", param: ParamConfig{Type: "money", Currency: "USD", Output: "minor_units", Enum: []interface{}{"9.99", "19.99"}}, value: "19.99"},
+		{name: "money not allowed", param: ParamConfig{Type: "money", Currency: "USD", Output: "minor_units", Enum: []interface{}{"9.99", "19.99"}}, value: "1999", wantErr: true},
+		{name: "boolean", param: ParamConfig{Type: "boolean", Enum: []interface{}{true}}, value: "true"},
+		{name: "boolean not allowed", param: ParamConfig{Type: "boolean", Enum: []interface{}{true}}, value: false, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.param.Name = "value"
+			if err := prepareParams([]ParamConfig{tt.param}, "reject"); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			_, err := validateValue("value", tt.param, tt.value, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrepareEnum(t *testing.T) {
+	tests := []struct {
+		name    string
+		param   ParamConfig
+		wantErr bool
+	}{
+		{name: "string", param: ParamConfig{Type: "string", Enum: []interface{}{"a", "b"}}},
+		{name: "number in a string enum", param: ParamConfig{Type: "string", Enum: []interface{}{"a", 1}}, wantErr: true},
+		{name: "integer as a string", param: ParamConfig{Type: "integer", Enum: []interface{}{"1", 2}}},
+		{name: "fraction in an integer enum", param: ParamConfig{Type: "integer", Enum: []interface{}{1, 1.5}}, wantErr: true},
+		{name: "not a decimal", param: ParamConfig{Type: "decimal", Enum: []interface{}{"ten"}}, wantErr: true},
+		{name: "not a boolean", param: ParamConfig{Type: "boolean", Enum: []interface{}{"yes"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.param.Name = "value"
+			if err := prepareParams([]ParamConfig{tt.param}, "reject"); (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNestedParams(t *testing.T) {
+	one := 1.0
+	order := ParamConfig{
+		Name: "order",
+		Type: "object",
+		Properties: []ParamConfig{
+			{Name: "customer", Type: "object", Required: true, Properties: []ParamConfig{
+				{Name: "email", Type: "string", Format: "email", Required: true},
+				{Name: "locale", Type: "string", Default: "en"},
+			}},
+			{Name: "items", Type: "array", Items: &ParamConfig{Type: "object", Properties: []ParamConfig{
+				{Name: "sku", Type: "string", Required: true},
+				{Name: "qty", Type: "integer", Minimum: &one},
+			}}},
+			{Name: "tags", Type: "array", Items: &ParamConfig{Type: "string"}},
+			{Name: "meta", Type: "object"},
+		},
+	}
+	tests := []struct {
+		name     string
+		mode     string
+		value    string
+		want     string
+		wantPath string
+		wantCode problem.Code
+	}{
+		{
+			name:  "valid",
+			value: `{"customer":{"email":"a@example.com"},"items":[{"sku":"s1","qty":"2"}],"tags":["x"],"meta":{"any":[1]}}`,
+			want:  `{"customer":{"email":"a@example.com","locale":"en"},"items":[{"sku":"s1","qty":2}],"tags":["x"],"meta":{"any":[1]}}`,
+		},
+		{name: "missing nested property", value: `{"customer":{}}`, wantPath: "order.customer.email", wantCode: problem.ParamMissing},
+		{name: "missing required object", value: `{"items":[]}`, wantPath: "order.customer", wantCode: problem.ParamMissing},
+		{name: "invalid nested format", value: `{"customer":{"email":"nope"}}`, wantPath: "order.customer.email", wantCode: problem.ParamInvalid},
+		{name: "invalid array item", value: `{"customer":{"email":"a@example.com"},"items":[{"sku":"s1"},{"sku":"s2","qty":0}]}`, wantPath: "order.items[1].qty", wantCode: problem.ParamInvalid},
+		{name: "missing item property", value: `{"customer":{"email":"a@example.com"},"items":[{"qty":1}]}`, wantPath: "order.items[0].sku", wantCode: problem.ParamMissing},
+		{name: "item of the wrong type", value: `{"customer":{"email":"a@example.com"},"tags":["x",1]}`, wantPath: "order.tags[1]", wantCode: problem.ParamInvalid},
+		{name: "array expected", value: `{"customer":{"email":"a@example.com"},"items":{"sku":"s1"}}`, wantPath: "order.items", wantCode: problem.ParamInvalid},
+		{name: "object expected", value: `"order"`, wantPath: "order", wantCode: problem.ParamInvalid},
+		{name: "unknown property dropped", mode: "drop", value: `{"customer":{"email":"a@example.com","vip":true}}`, want: `{"customer":{"email":"a@example.com","locale":"en"}}`},
+		{name: "unknown property rejected", mode: "reject", value: `{"customer":{"email":"a@example.com","vip":true}}`, wantPath: "order.customer", wantCode: problem.ParamUnknown},
+		{name: "unknown property passed through", mode: "passthrough", value: `{"customer":{"email":"a@example.com","vip":true}}`, want: `{"customer":{"email":"a@example.com","locale":"en","vip":true}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mode := tt.mode
+			if mode == "" {
+				mode = "drop"
+			}
+			params := []ParamConfig{order}
+			if err := prepareParams(params, mode); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			var value interface{}
+			decoder := json.NewDecoder(strings.NewReader(tt.value))
+			decoder.UseNumber()
+			if err := decoder.Decode(&value); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := validateValue("order", params[0], value, nil)
+			if tt.wantPath != "" {
+				var fieldErr *paramError
+				if !errors.As(err, &fieldErr) || fieldErr.path != tt.wantPath || fieldErr.code != tt.wantCode {
+					t.Fatalf("got %v, %v, want a %s error for %s", got, err, tt.wantCode, tt.wantPath)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateValue failed: %v", err)
+			}
+			var want interface{}
+			json.Unmarshal([]byte(tt.want), &want)
+			encoded, _ := json.Marshal(got)
+			var gotJSON interface{}
+			json.Unmarshal(encoded, &gotJSON)
+			if !reflect.DeepEqual(gotJSON, want) {
+				t.Errorf("got %s, want %s", encoded, tt.want)
+			}
+		})
+	}
+}
+
+func TestNestedParamsFromQuery(t *testing.T) {
+	routeConfig := RouteConfig{
+		Path:          "/payments",
+		Type:          http.MethodGet,
+		UnknownParams: "reject",
+		Params: []ParamConfig{
+			{Name: "filter", Type: "object", In: "query", Properties: []ParamConfig{{Name: "status", Type: "string"}}},
+			{Name: "ids", Type: "array", In: "query", Items: &ParamConfig{Type: "integer"}},
+		},
+	}
+	if err := prepareParams(routeConfig.Params, "reject"); err != nil {
+		t.Fatalf("prepareParams failed: %v", err)
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/payments?filter="+url.QueryEscape(`{"status":"paid"}`)+"&ids=1,2", nil)
+
+	args, err := validateAndExtractParams(c, routeConfig, testLogger)
+	if err != nil {
+		t.Fatalf("validateAndExtractParams failed: %v", err)
+	}
+	want := map[string]interface{}{"filter": map[string]interface{}{"status": "paid"}, "ids": []interface{}{1, 2}}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("args %#v, want %#v", args, want)
+	}
+}
+
+func TestResolveParamLocations(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		want    []string // Resolved location of each param
+		wantErr bool
+	}{
+		{
+			name:  "defaults on POST",
+			route: RouteConfig{Path: "/accounts/:account_id/payments", Type: http.MethodPost, Params: []ParamConfig{{Name: "account_id"}, {Name: "amount"}, {Name: "X-Tenant", In: " Header "}}},
+			want:  []string{"path", "body", "header"},
+		},
+		{
+			name:  "defaults on GET",
+			route: RouteConfig{Path: "/accounts/:account_id/payments", Type: http.MethodGet, Params: []ParamConfig{{Name: "account_id"}, {Name: "status"}, {Name: "session", In: "cookie"}}},
+			want:  []string{"path", "query", "cookie"},
+		},
+		{name: "unknown location", route: RouteConfig{Path: "/payments", Type: http.MethodGet, Params: []ParamConfig{{Name: "status", In: "form"}}}, wantErr: true},
+		{name: "path param not in the path", route: RouteConfig{Path: "/payments", Type: http.MethodGet, Params: []ParamConfig{{Name: "payment_id", In: "path"}}}, wantErr: true},
+		{name: "body on GET", route: RouteConfig{Path: "/payments", Type: http.MethodGet, Params: []ParamConfig{{Name: "amount", In: "body"}}}, wantErr: true},
+		{name: "style on a body param", route: RouteConfig{Path: "/payments", Type: http.MethodPost, Params: []ParamConfig{{Name: "ids", Type: "array", Style: "comma"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolveParamLocations(&tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, param := range tt.route.Params {
+				got = append(got, param.In)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("locations %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParamLocations(t *testing.T) {
+	limits := testBodyLimits
+	limits.MaxStringLength = 64
+	routeConfig := RouteConfig{
+		Path:          "/accounts/:account_id/payments",
+		Type:          http.MethodPost,
+		UnknownParams: "drop",
+		BodyLimits:    limits,
+		Params: []ParamConfig{
+			{Name: "account_id", Type: "integer", In: "path"},
+			{Name: "dry_run", Type: "boolean", In: "query"},
+			{Name: "Idempotency-Key", Type: "string", In: "header"},
+			{Name: "session", Type: "string", In: "cookie"},
+			{Name: "amount", Type: "string", In: "body"},
+		},
+	}
+	if err := prepareParams(routeConfig.Params, "drop"); err != nil {
+		t.Fatalf("prepareParams failed: %v", err)
+	}
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		header map[string]string
+		want   map[string]interface{}
+	}{
+		{
+			name:   "each from its location",
+			target: "/accounts/42/payments?dry_run=true",
+			body:   `{"amount":"10.00"}`,
+			header: map[string]string{"Idempotency-Key": "key-1", "Cookie": "session=s1"},
+			want:   map[string]interface{}{"account_id": 42, "dry_run": true, "Idempotency-Key": "key-1", "session": "s1", "amount": "10.00"},
+		},
+		{
+			name:   "other locations are ignored",
+			target: "/accounts/42/payments?amount=99&Idempotency-Key=spoofed&session=spoofed",
+			body:   `{"dry_run":true,"account_id":7}`,
+			want:   map[string]interface{}{"account_id": 42},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			var args map[string]interface{}
+			var err error
+			engine.POST(routeConfig.Path, func(c *gin.Context) {
+				args, err = validateAndExtractParams(c, routeConfig, testLogger)
+			})
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			engine.ServeHTTP(httptest.NewRecorder(), req)
+
+			if err != nil {
+				t.Fatalf("validateAndExtractParams failed: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.want) {
+				t.Errorf("args %#v, want %#v", args, tt.want)
+			}
+		})
+	}
+}
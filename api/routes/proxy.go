@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"bytes"
+	"caaspay-api-go/api/problem"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyConfig forwards a route to plain HTTP upstreams instead of a Myriad service. Requests go through
+// the same middleware, validation and args mapping; JSON object responses are shaped like RPC responses
+// and other responses become a 502 problem unless pass_through is set.
+type ProxyConfig struct {
+	Upstreams       []string          `mapstructure:"upstreams"`         // Base URLs, used round-robin
+	Path            string            `mapstructure:"path"`              // Upstream path with :param placeholders; defaults to the route path
+	SetHeaders      map[string]string `mapstructure:"set_headers"`       // Headers added to or replaced in the upstream request
+	ForwardHeaders  []string          `mapstructure:"forward_headers"`   // Client headers forwarded upstream besides the defaults
+	ResponseHeaders []string          `mapstructure:"response_headers"`  // Upstream headers returned to the client
+	MaxResponseSize int64             `mapstructure:"max_response_size"` // Bytes, larger responses fail with 502 (default: 10 MiB)
+	PassThrough     bool              `mapstructure:"pass_through"`      // Return error and non-JSON responses as the upstream sent them
+
+	upstreams []*url.URL    // Parsed Upstreams, set by PrepareRoute
+	next      atomic.Uint64 // Round-robin position
+}
+
+// defaultMaxResponseSize bounds upstream responses when max_response_size isn't set
+const defaultMaxResponseSize = 10 << 20
+
+// backends lists the valid values of a route's backend
+var backends = map[string]bool{
+	"rpc":  true,
+	"http": true,
+}
+
+// proxyClient is shared by every proxy route; request timeouts come from the route's context. The
+// connections per upstream are capped so a slow upstream can't exhaust the gateway's sockets.
+var proxyClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:            (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:    5 * time.Second,
+		MaxIdleConns:           100,
+		MaxIdleConnsPerHost:    20,
+		MaxConnsPerHost:        100,
+		IdleConnTimeout:        90 * time.Second,
+		MaxResponseHeaderBytes: 64 << 10,
+		ForceAttemptHTTP2:      true,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// hopHeaders are connection-level headers that must not be forwarded by a proxy
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// forwardedHeaders are the client headers every proxy route forwards. Others, e.g. credentials or
+// headers upstreams might trust, only go through when listed in forward_headers; identity reaches
+// upstreams through args.
+var forwardedHeaders = []string{"Accept", "Accept-Language", "User-Agent"}
+
+// gatewayHeaders are consumed or set by the gateway and never forwarded from the client
+var gatewayHeaders = map[string]bool{
+	"Authorization": true, "Cookie": true, "Cf-Access-Jwt-Assertion": true, "Accept-Encoding": true,
+	"Content-Length": true, "Content-Type": true, "Host": true, "X-Request-Id": true,
+	"X-Forwarded-For": true, "X-Forwarded-Host": true, "X-Forwarded-Proto": true, "Forwarded": true,
+}
+
+// prepareProxy parses the upstreams of a proxy route and checks its settings
+func prepareProxy(proxy *ProxyConfig) error {
+	if len(proxy.Upstreams) == 0 {
+		return fmt.Errorf("at least one upstream is required")
+	}
+	proxy.upstreams = make([]*url.URL, 0, len(proxy.Upstreams))
+	for _, upstream := range proxy.Upstreams {
+		parsed, err := url.Parse(upstream)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("invalid upstream %q (expected an http or https URL)", upstream)
+		}
+		proxy.upstreams = append(proxy.upstreams, parsed)
+	}
+	if proxy.Path != "" && !strings.HasPrefix(proxy.Path, "/") {
+		return fmt.Errorf("path %q must start with /", proxy.Path)
+	}
+	for _, name := range proxy.ForwardHeaders {
+		canonical := http.CanonicalHeaderKey(name)
+		if gatewayHeaders[canonical] || slices.Contains(hopHeaders, canonical) {
+			return fmt.Errorf("header %s can't be forwarded", name)
+		}
+	}
+	if proxy.MaxResponseSize < 0 {
+		return fmt.Errorf("max_response_size must be positive")
+	}
+	if proxy.MaxResponseSize == 0 {
+		proxy.MaxResponseSize = defaultMaxResponseSize
+	}
+	return nil
+}
+
+// proxyResponse forwards the request to the next upstream. JSON object responses with a 2xx status are
+// returned for shaping. Otherwise false is returned once the response has been written: a problem for
+// failed requests, error statuses and other bodies, or the upstream response on pass_through routes.
+func proxyResponse(c *gin.Context, routeConfig RouteConfig, params, args map[string]interface{}, logger *logging.Logger) (map[string]interface{}, int, bool) {
+	proxy := routeConfig.Proxy
+	upstream := proxy.upstreams[(proxy.next.Add(1)-1)%uint64(len(proxy.upstreams))]
+
+	// Params are escaped in RawPath, so a "/" in a value doesn't add a path segment
+	target := *upstream
+	target.RawPath = strings.TrimSuffix(upstream.EscapedPath(), "/") + proxyPath(c, routeConfig, params)
+	target.Path, _ = url.PathUnescape(target.RawPath)
+
+	var body io.Reader
+	if AcceptsBody(routeConfig.Type) {
+		encoded, err := json.Marshal(args)
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "unable to encode the upstream request")
+			return nil, 0, false
+		}
+		body = bytes.NewReader(encoded)
+	} else {
+		target.RawQuery = proxyQuery(args).Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), routeConfig.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, routeConfig.Type, target.String(), body)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, problem.InternalError, "unable to build the upstream request")
+		return nil, 0, false
+	}
+	req.Header = proxyRequestHeaders(c, proxy)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	fail := func(status int, code problem.Code, message string, err error) (map[string]interface{}, int, bool) {
+		logger.LogWithStats("error", "Upstream request failed", map[string]string{
+			"metric_name": "proxy_error",
+			"route":       routeConfig.Type + " " + routeConfig.Path,
+			"upstream":    upstream.Host,
+			"code":        string(code),
+		}, map[string]interface{}{"error": err.Error()})
+		problem.Abort(c, status, code, message)
+		return nil, 0, false
+	}
+
+	resp, err := proxyClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			retainUploads(c)
+			return fail(http.StatusGatewayTimeout, problem.UpstreamTimeout, "upstream timed out", err)
+		}
+		return fail(http.StatusBadGateway, problem.UpstreamError, "upstream unavailable", err)
+	}
+	defer resp.Body.Close()
+
+	// Read one byte past the limit to tell a full response from a truncated one
+	data, err := io.ReadAll(io.LimitReader(resp.Body, proxy.MaxResponseSize+1))
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			retainUploads(c)
+			return fail(http.StatusGatewayTimeout, problem.UpstreamTimeout, "upstream timed out", err)
+		}
+		return fail(http.StatusBadGateway, problem.UpstreamError, "upstream unavailable", err)
+	}
+	if int64(len(data)) > proxy.MaxResponseSize {
+		return fail(http.StatusBadGateway, problem.UpstreamTooLarge, "upstream response too large", fmt.Errorf("response exceeds %d bytes", proxy.MaxResponseSize))
+	}
+
+	success := resp.StatusCode >= 200 && resp.StatusCode < 300
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if success && mediaType == "application/json" {
+		if response, err := decodeResponse(data); err == nil {
+			copyResponseHeaders(c, proxy, resp)
+			return response, resp.StatusCode, true
+		}
+	}
+	switch {
+	case proxy.PassThrough:
+		copyResponseHeaders(c, proxy, resp)
+		c.Data(resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	case !success:
+		// The upstream's error body isn't shown to the client, it may not follow the API's conventions
+		return fail(http.StatusBadGateway, problem.UpstreamError, "upstream responded with an error", fmt.Errorf("upstream responded with status %d", resp.StatusCode))
+	case len(data) == 0:
+		copyResponseHeaders(c, proxy, resp)
+		c.Status(resp.StatusCode)
+	default:
+		return fail(http.StatusBadGateway, problem.UpstreamInvalid, "unexpected upstream response", fmt.Errorf("upstream responded with %s, not a JSON object", strconv.Quote(mediaType)))
+	}
+	return nil, 0, false
+}
+
+// copyResponseHeaders returns the route's response_headers of the upstream response to the client
+func copyResponseHeaders(c *gin.Context, proxy *ProxyConfig, resp *http.Response) {
+	for _, name := range proxy.ResponseHeaders {
+		for _, value := range resp.Header.Values(name) {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+}
+
+// proxyPath fills the placeholders of the upstream path from the validated params, falling back to
+// the request's path segments, and returns it escaped
+func proxyPath(c *gin.Context, routeConfig RouteConfig, params map[string]interface{}) string {
+	path := routeConfig.Proxy.Path
+	if path == "" {
+		path = routeConfig.Path
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") && !strings.HasPrefix(segment, "*") {
+			continue
+		}
+		name := segment[1:]
+		value := c.Param(name)
+		if param, ok := params[name]; ok {
+			value = fmt.Sprint(param)
+		}
+		if segment[0] == '*' {
+			segments[i] = strings.TrimPrefix(value, "/")
+			continue
+		}
+		segments[i] = url.PathEscape(value)
+	}
+	return strings.Join(segments, "/")
+}
+
+// proxyQuery encodes the args as query parameters; arrays repeat the key and objects are sent as JSON
+func proxyQuery(args map[string]interface{}) url.Values {
+	query := url.Values{}
+	for name, value := range args {
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				query.Add(name, fmt.Sprint(item))
+			}
+		case map[string]interface{}:
+			encoded, _ := json.Marshal(v)
+			query.Set(name, string(encoded))
+		default:
+			query.Set(name, fmt.Sprint(v))
+		}
+	}
+	return query
+}
+
+// proxyRequestHeaders copies the allowed client headers, adds the forwarding headers and request ID,
+// and applies the route's header rewriting
+func proxyRequestHeaders(c *gin.Context, proxy *ProxyConfig) http.Header {
+	header := http.Header{}
+	for _, name := range append(forwardedHeaders, proxy.ForwardHeaders...) {
+		for _, value := range c.Request.Header.Values(name) {
+			header.Add(name, value)
+		}
+	}
+
+	// The client IP as resolved through trusted_proxies; a client supplied X-Forwarded-For is not
+	// passed on, so clients can't choose the IP upstreams see
+	header.Set("X-Forwarded-For", c.ClientIP())
+	header.Set("X-Forwarded-Host", c.Request.Host)
+	proto := "http"
+	if c.Request.TLS != nil {
+		proto = "https"
+	}
+	header.Set("X-Forwarded-Proto", proto)
+	header.Set("X-Request-ID", requestID(c))
+
+	for name, value := range proxy.SetHeaders {
+		header.Set(name, value)
+	}
+	return header
+}
@@ -0,0 +1,193 @@
+package routes
+
+import (
+	"caaspay-api-go/api/problem"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// proxyRoute creates a prepared GET proxy route for the given upstreams
+func proxyRoute(t *testing.T, path string, proxy *ProxyConfig, upstreams ...string) RouteConfig {
+	t.Helper()
+	proxy.Upstreams = upstreams
+	if err := prepareProxy(proxy); err != nil {
+		t.Fatalf("prepareProxy failed: %v", err)
+	}
+	return RouteConfig{Path: path, Type: http.MethodGet, Backend: "http", Timeout: time.Second, Proxy: proxy}
+}
+
+func TestProxyPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		proxy  string
+		params map[string]interface{}
+		want   string
+	}{
+		{name: "route path", path: "/invoices/:invoice_id", params: map[string]interface{}{"invoice_id": "inv_1"}, want: "/invoices/inv_1"},
+		{name: "proxy path", path: "/invoices/:invoice_id", proxy: "/v1/invoice/:invoice_id", params: map[string]interface{}{"invoice_id": "inv_1"}, want: "/v1/invoice/inv_1"},
+		{name: "slash is escaped", path: "/invoices/:invoice_id", params: map[string]interface{}{"invoice_id": "../admin"}, want: "/invoices/..%2Fadmin"},
+		{name: "space and query are escaped", path: "/invoices/:invoice_id", params: map[string]interface{}{"invoice_id": "a b?c"}, want: "/invoices/a%20b%3Fc"},
+		{name: "validated value", path: "/accounts/:account_id", params: map[string]interface{}{"account_id": json.Number("42")}, want: "/accounts/42"},
+		{name: "wildcard keeps slashes", path: "/files/*file", params: map[string]interface{}{"file": "/2026/01/report.pdf"}, want: "/files/2026/01/report.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			routeConfig := RouteConfig{Path: tt.path, Proxy: &ProxyConfig{Path: tt.proxy}}
+			if got := proxyPath(c, routeConfig, tt.params); got != tt.want {
+				t.Errorf("proxyPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyRequestHeaders(t *testing.T) {
+	c, engine := gin.CreateTestContext(httptest.NewRecorder())
+	engine.SetTrustedProxies([]string{"10.0.0.0/8"})
+	c.Request = httptest.NewRequest(http.MethodGet, "/legacy/invoices/inv_1", nil)
+	c.Request.RemoteAddr = "10.0.0.1:41000"
+	c.Request.Header.Set("X-Forwarded-For", "198.51.100.9, 203.0.113.7")
+	c.Request.Header.Set("Accept-Language", "fr")
+	c.Request.Header.Set("Idempotency-Key", "key-1")
+	c.Request.Header.Set("Authorization", "Bearer secret")
+	c.Request.Header.Set("Cookie", "session=secret")
+	c.Request.Header.Set("X-Internal-Token", "secret")
+	c.Request.Header.Set("X-Gateway", "spoofed")
+	c.Set("request_id", "req-1")
+
+	header := proxyRequestHeaders(c, &ProxyConfig{
+		ForwardHeaders: []string{"Idempotency-Key"},
+		SetHeaders:     map[string]string{"X-Gateway": "caaspay-api"},
+	})
+	want := map[string]string{
+		"Accept-Language":   "fr",
+		"Idempotency-Key":   "key-1",
+		"X-Forwarded-For":   "203.0.113.7",
+		"X-Forwarded-Host":  "example.com",
+		"X-Forwarded-Proto": "http",
+		"X-Request-Id":      "req-1",
+		"X-Gateway":         "caaspay-api",
+	}
+	for name, value := range want {
+		if got := header.Values(name); len(got) != 1 || got[0] != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+	for _, name := range []string{"Authorization", "Cookie", "X-Internal-Token"} {
+		if header.Get(name) != "" {
+			t.Errorf("%s was forwarded", name)
+		}
+	}
+}
+
+func TestPrepareProxyRejectsGatewayHeaders(t *testing.T) {
+	for _, name := range []string{"authorization", "X-Forwarded-For", "Connection", "Host"} {
+		proxy := &ProxyConfig{Upstreams: []string{"http://billing:8080"}, ForwardHeaders: []string{name}}
+		if err := prepareProxy(proxy); err == nil {
+			t.Errorf("forward_headers %s was accepted", name)
+		}
+	}
+}
+
+func TestProxyResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		passThrough bool
+		wantOK      bool
+		wantStatus  int
+		wantCode    problem.Code
+		wantBody    string
+	}{
+		{name: "JSON object", status: http.StatusOK, contentType: "application/json; charset=utf-8", body: `{"invoice_id":"inv_1"}`, wantOK: true, wantStatus: http.StatusOK},
+		{name: "created", status: http.StatusCreated, contentType: "application/json", body: `{"invoice_id":"inv_1"}`, wantOK: true, wantStatus: http.StatusCreated},
+		{name: "error status", status: http.StatusNotFound, contentType: "text/html", body: `<h1>Not Found</h1>`, wantStatus: http.StatusBadGateway, wantCode: problem.UpstreamError},
+		{name: "JSON error status", status: http.StatusInternalServerError, contentType: "application/json", body: `{"error":"db down"}`, wantStatus: http.StatusBadGateway, wantCode: problem.UpstreamError},
+		{name: "not JSON", status: http.StatusOK, contentType: "text/csv", body: "a,b\n", wantStatus: http.StatusBadGateway, wantCode: problem.UpstreamInvalid},
+		{name: "JSON array", status: http.StatusOK, contentType: "application/json", body: `[1,2]`, wantStatus: http.StatusBadGateway, wantCode: problem.UpstreamInvalid},
+		{name: "no content", status: http.StatusNoContent, wantStatus: http.StatusNoContent},
+		{name: "pass through error", status: http.StatusNotFound, contentType: "text/html", body: `<h1>Not Found</h1>`, passThrough: true, wantStatus: http.StatusNotFound, wantBody: `<h1>Not Found</h1>`},
+		{name: "pass through CSV", status: http.StatusOK, contentType: "text/csv", body: "a,b\n", passThrough: true, wantStatus: http.StatusOK, wantBody: "a,b\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer upstream.Close()
+
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(http.MethodGet, "/invoices/inv_1", nil)
+			routeConfig := proxyRoute(t, "/invoices/:invoice_id", &ProxyConfig{PassThrough: tt.passThrough}, upstream.URL)
+			response, status, ok := proxyResponse(c, routeConfig, map[string]interface{}{"invoice_id": "inv_1"}, map[string]interface{}{}, testLogger)
+			c.Writer.WriteHeaderNow()
+
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok {
+				if status != tt.wantStatus || response["invoice_id"] != "inv_1" {
+					t.Errorf("got %d %v, want %d and the decoded object", status, response, tt.wantStatus)
+				}
+				return
+			}
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if tt.wantCode != "" {
+				var body problem.Problem
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != tt.wantCode {
+					t.Errorf("body %s, want a %s problem", recorder.Body, tt.wantCode)
+				}
+			}
+			if tt.wantBody != "" && recorder.Body.String() != tt.wantBody {
+				t.Errorf("body %q, want %q", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestProxyRoundRobin(t *testing.T) {
+	var hits []string
+	newUpstream := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits = append(hits, name+" "+r.URL.EscapedPath())
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{}`))
+		}))
+	}
+	first, second := newUpstream("first"), newUpstream("second")
+	defer first.Close()
+	defer second.Close()
+
+	routeConfig := proxyRoute(t, "/invoices/:invoice_id", &ProxyConfig{Path: "/v1/invoice/:invoice_id"}, first.URL+"/api/", second.URL+"/api")
+	for i := 0; i < 4; i++ {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/invoices/inv_1", nil)
+		if _, _, ok := proxyResponse(c, routeConfig, map[string]interface{}{"invoice_id": "inv/1"}, map[string]interface{}{}, testLogger); !ok {
+			t.Fatalf("request %d failed", i)
+		}
+	}
+	want := []string{"first /api/v1/invoice/inv%2F1", "second /api/v1/invoice/inv%2F1", "first /api/v1/invoice/inv%2F1", "second /api/v1/invoice/inv%2F1"}
+	if len(hits) != len(want) {
+		t.Fatalf("hits %v, want %v", hits, want)
+	}
+	for i := range want {
+		if hits[i] != want[i] {
+			t.Errorf("request %d went to %s, want %s", i, hits[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ResponseConfig describes how a service response is shaped before it is returned to clients
+type ResponseConfig struct {
+	Envelope *bool         `mapstructure:"envelope"` // Wrap as {data, request_id, meta}; defaults to the global setting
+	Fields   []ParamConfig `mapstructure:"fields"`   // Only these fields are returned; all of them when empty
+}
+
+// shapeResponse projects the service response onto the declared fields and wraps it in the
+// standard envelope when enabled, so internal service fields don't leak to public clients
+func shapeResponse(c *gin.Context, routeConfig RouteConfig, response map[string]interface{}) interface{} {
+	if routeConfig.Pagination != nil {
+		return shapePageResponse(c, routeConfig, response)
+	}
+	return shapeData(routeConfig, response, requestID(c))
+}
+
+// shapeData applies the route's response structure to a service response
+func shapeData(routeConfig RouteConfig, response map[string]interface{}, requestID string) interface{} {
+	var data interface{} = response
+	if len(routeConfig.ResponseStructure.Fields) > 0 {
+		data = projectObject(routeConfig.ResponseStructure.Fields, response)
+	}
+
+	if envelope := routeConfig.ResponseStructure.Envelope; envelope != nil && *envelope {
+		return gin.H{
+			"data":       data,
+			"request_id": requestID,
+			"meta":       gin.H{},
+		}
+	}
+	return data
+}
+
+// projectObject keeps the declared fields of an object, reading each from its source field
+func projectObject(fields []ParamConfig, object map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		source := field.Source
+		if source == "" {
+			source = field.Name
+		}
+		value, exists := object[source]
+		if !exists {
+			if field.Default == nil {
+				continue
+			}
+			value = field.Default
+		}
+		result[field.Name] = projectValue(field, value)
+	}
+	return result
+}
+
+// projectValue shapes nested objects and arrays and coerces scalars to the declared type.
+// Values that can't be coerced are returned unchanged.
+func projectValue(field ParamConfig, value interface{}) interface{} {
+	switch field.Type {
+	case "object":
+		if object, ok := value.(map[string]interface{}); ok && len(field.Properties) > 0 {
+			return projectObject(field.Properties, object)
+		}
+		return value
+	case "array":
+		if items, ok := value.([]interface{}); ok && field.Items != nil {
+			result := make([]interface{}, len(items))
+			for i, item := range items {
+				result[i] = projectValue(*field.Items, item)
+			}
+			return result
+		}
+		return value
+	}
+
+	if coerced, err := coerceValue(field, value); err == nil {
+		return coerced
+	}
+	return value
+}
+
+// coerceValue converts a scalar service value to the declared type without enforcing constraints
+func coerceValue(field ParamConfig, value interface{}) (interface{}, error) {
+	switch field.Type {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case json.Number:
+			return v.String(), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		}
+	case "integer":
+		return convertToInt(value)
+	case "number":
+		switch v := value.(type) {
+		case json.Number, float64:
+			return v, nil
+		case string:
+			if _, err := strconv.ParseFloat(v, 64); err == nil {
+				return json.Number(v), nil
+			}
+		}
+	case "decimal", "money":
+		d, err := parseDecimal(value)
+		if err != nil {
+			return nil, err
+		}
+		scale := d.scale()
+		if field.Scale != nil && *field.Scale > scale {
+			scale = *field.Scale
+		}
+		if minorUnits, ok := currencyMinorUnits[field.Currency]; ok && minorUnits > scale {
+			scale = minorUnits
+		}
+		return d.format(scale), nil
+	case "boolean":
+		return convertToBool(value)
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("unsupported type for %s conversion: %v", field.Type, reflect.TypeOf(value))
+}
+
+// requestID returns the ID given to the request by the request ID middleware, or a new one
+func requestID(c *gin.Context) string {
+	if id := c.GetString("request_id"); id != "" {
+		return id
+	}
+	return uuid.New().String()
+}
+
+// responseETag returns the weak ETag of a successful service response in the given format, on routes
+// with etag enabled. It is weak because the body sent also carries the request ID.
+func responseETag(routeConfig RouteConfig, status int, format string, response map[string]interface{}) string {
+	if !routeConfig.ETag || status != http.StatusOK {
+		return ""
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(append([]byte(format+":"), encoded...))
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches the ETag, using weak comparison
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// contractModes lists the valid values of the contract_mode setting
+var contractModes = map[string]bool{
+	"enforce": true,
+	"warn":    true,
+	"off":     true,
+}
+
+// checkContract validates a service response against the declared response fields and
+// returns every violation found, each prefixed with the path of the offending field
+func checkContract(fields []ParamConfig, object map[string]interface{}, path string) []string {
+	var violations []string
+	for _, field := range fields {
+		source := field.Source
+		if source == "" {
+			source = field.Name
+		}
+		fieldPath := source
+		if path != "" {
+			fieldPath = path + "." + source
+		}
+
+		value, exists := object[source]
+		if !exists || value == nil {
+			if field.Required {
+				violations = append(violations, fmt.Sprintf("%s: missing required field", fieldPath))
+			}
+			continue
+		}
+		violations = append(violations, checkContractValue(field, value, object, fieldPath)...)
+	}
+	return violations
+}
+
+// checkContractValue validates a single response value, recursing into objects and arrays.
+// Scalars must have the declared JSON type and satisfy the declared constraints.
+func checkContractValue(field ParamConfig, value interface{}, siblings map[string]interface{}, path string) []string {
+	switch field.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %s", path, jsonKind(value))}
+		}
+		return checkContract(field.Properties, object, path)
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %s", path, jsonKind(value))}
+		}
+		if field.Items == nil {
+			return nil
+		}
+		var violations []string
+		for i, item := range items {
+			violations = append(violations, checkContractValue(*field.Items, item, nil, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return violations
+	}
+
+	expected := map[string][]string{
+		"string":  {"string"},
+		"integer": {"number"},
+		"number":  {"number"},
+		"decimal": {"number", "string"},
+		"money":   {"number", "string"},
+		"boolean": {"boolean"},
+	}[field.Type]
+	kind := jsonKind(value)
+	matched := len(expected) == 0
+	for _, allowed := range expected {
+		matched = matched || kind == allowed
+	}
+	if !matched {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, field.Type, kind)}
+	}
+
+	if _, err := validateValue(path, field, value, siblings); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
+
+// jsonKind names the JSON type of a decoded value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case json.Number, float64, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return reflect.TypeOf(value).String()
+}
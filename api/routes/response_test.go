@@ -0,0 +1,266 @@
+package routes
+
+import (
+	"caaspay-api-go/api/middleware"
+	"caaspay-api-go/api/problem"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestETag(t *testing.T) {
+	route := prepareTestRoute(t, RouteConfig{
+		Path: "/payments",
+		Type: http.MethodGet,
+		ETag: true,
+		Mock: &MockConfig{Enabled: true, Response: map[string]interface{}{"note": strings.Repeat("paid ", 100)}},
+	})
+	compression := middleware.CompressionMiddleware(256, gzip.DefaultCompression, true)
+	request := func(accept, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/payments", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serveRoute(route, req, compression)
+	}
+
+	first := request("gzip", "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || first.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got %d with ETag %q and Content-Encoding %q, want a compressed 200 with a weak ETag", first.Code, etag, first.Header().Get("Content-Encoding"))
+	}
+	// The ETag is over the service response, so it doesn't depend on the content coding
+	if other := request("br", "").Header().Get("ETag"); other != etag {
+		t.Errorf("brotli response ETag %q, want %q", other, etag)
+	}
+
+	tests := []struct {
+		name        string
+		accept      string
+		ifNoneMatch string
+		wantStatus  int
+	}{
+		{name: "match", accept: "gzip", ifNoneMatch: etag, wantStatus: http.StatusNotModified},
+		{name: "strong form matches weakly", accept: "br", ifNoneMatch: strings.TrimPrefix(etag, "W/"), wantStatus: http.StatusNotModified},
+		{name: "one of a list", accept: "", ifNoneMatch: `"other", ` + etag, wantStatus: http.StatusNotModified},
+		{name: "any", accept: "gzip", ifNoneMatch: "*", wantStatus: http.StatusNotModified},
+		{name: "changed", accept: "gzip", ifNoneMatch: `W/"other"`, wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := request(tt.accept, tt.ifNoneMatch)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", recorder.Code, tt.wantStatus)
+			}
+			if recorder.Header().Get("ETag") != etag {
+				t.Errorf("ETag %q, want %q", recorder.Header().Get("ETag"), etag)
+			}
+			if got := recorder.Header().Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+				t.Errorf("Vary %q, want Accept-Encoding", got)
+			}
+			if tt.wantStatus == http.StatusNotModified && (recorder.Body.Len() != 0 || recorder.Header().Get("Content-Encoding") != "") {
+				t.Errorf("304 with body %q and Content-Encoding %q, want neither", recorder.Body, recorder.Header().Get("Content-Encoding"))
+			}
+		})
+	}
+}
+
+func TestResponseStructureForms(t *testing.T) {
+	tests := []struct {
+		name         string
+		yaml         string
+		wantEnvelope *bool
+		wantFields   []string // name:type
+	}{
+		{name: "fields", yaml: "envelope: false\nfields:\n  - {name: id, type: string}\n  - {name: amount, type: decimal}\n", wantEnvelope: new(bool), wantFields: []string{"id:string", "amount:decimal"}},
+		{name: "flat", yaml: "status: string\nid: string\namount: decimal\n", wantFields: []string{"amount:decimal", "id:string", "status:string"}},
+		{name: "flat field named fields", yaml: "fields: string\n", wantFields: []string{"fields:string"}},
+		{name: "envelope only", yaml: "envelope: false\n", wantEnvelope: new(bool)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var structure map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &structure); err != nil {
+				t.Fatal(err)
+			}
+			route, err := decodeRoute(map[string]interface{}{"path": "/payments", "type": "GET", "response_structure": structure}, true)
+			if err != nil {
+				t.Fatalf("decodeRoute failed: %v", err)
+			}
+			if !reflect.DeepEqual(route.ResponseStructure.Envelope, tt.wantEnvelope) {
+				t.Errorf("envelope %v, want %v", route.ResponseStructure.Envelope, tt.wantEnvelope)
+			}
+			var fields []string
+			for _, field := range route.ResponseStructure.Fields {
+				fields = append(fields, field.Name+":"+field.Type)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("fields %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
+
+// responseFields are the declared response fields used by the contract and projection tests
+var responseFields = []ParamConfig{
+	{Name: "id", Type: "string", Required: true},
+	{Name: "amount", Source: "amount_value", Type: "decimal", Scale: intPtr(2)},
+	{Name: "status", Type: "string", Enum: []interface{}{"pending", "paid"}},
+	{Name: "captured", Type: "boolean", Default: false},
+	{Name: "payer", Type: "object", Properties: []ParamConfig{{Name: "email", Type: "string", Required: true}}},
+	{Name: "items", Type: "array", Items: &ParamConfig{Type: "object", Properties: []ParamConfig{{Name: "qty", Type: "integer", Required: true}}}},
+}
+
+// intPtr returns a pointer to the given int
+func intPtr(value int) *int {
+	return &value
+}
+
+// decodeJSON decodes a service response the way the RPC client does, keeping numbers exact
+func decodeJSON(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		t.Fatal(err)
+	}
+	return object
+}
+
+func TestProjectObject(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name:     "undeclared fields are dropped",
+			response: `{"id":"pay_1","internal_ref":"x","payer":{"email":"a@example.com","risk_score":7}}`,
+			want:     `{"id":"pay_1","captured":false,"payer":{"email":"a@example.com"}}`,
+		},
+		{
+			name:     "renamed and coerced",
+			response: `{"id":42,"amount_value":10.5,"captured":"true"}`,
+			want:     `{"id":"42","amount":"10.50","captured":true}`,
+		},
+		{
+			name:     "array items are projected",
+			response: `{"id":"pay_1","items":[{"qty":"2","sku":"s1"},{"qty":3}]}`,
+			want:     `{"id":"pay_1","captured":false,"items":[{"qty":2},{"qty":3}]}`,
+		},
+		{
+			name:     "values that can't be coerced are kept",
+			response: `{"id":"pay_1","amount_value":"ten","payer":"a@example.com"}`,
+			want:     `{"id":"pay_1","amount":"ten","captured":false,"payer":"a@example.com"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := prepareParams(responseFields, "drop"); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			got, err := json.Marshal(projectObject(responseFields, decodeJSON(t, tt.response)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(decodeJSON(t, string(got)), decodeJSON(t, tt.want)) {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckContract(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		want      []string
+		wantField string // Field named by the only violation, when its message comes from param validation
+	}{
+		{name: "valid", response: `{"id":"pay_1","amount_value":"10.50","status":"paid","payer":{"email":"a@example.com"},"items":[{"qty":1}]}`},
+		{name: "missing required", response: `{"status":"paid"}`, want: []string{"id: missing required field"}},
+		{name: "null required", response: `{"id":null}`, want: []string{"id: missing required field"}},
+		{name: "wrong type", response: `{"id":42,"captured":"yes"}`, want: []string{"id: expected string, got number", "captured: expected boolean, got string"}},
+		{name: "renamed field path", response: `{"id":"pay_1","amount_value":true}`, want: []string{"amount_value: expected decimal, got boolean"}},
+		{name: "not in enum", response: `{"id":"pay_1","status":"lost"}`, wantField: "status"},
+		{name: "nested", response: `{"id":"pay_1","payer":{},"items":[{"qty":1},{"qty":"2"},{}]}`, want: []string{"payer.email: missing required field", "items[1].qty: expected integer, got string", "items[2].qty: missing required field"}},
+		{name: "not an object", response: `{"id":"pay_1","payer":[],"items":{}}`, want: []string{"payer: expected object, got array", "items: expected array, got object"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := prepareParams(responseFields, "drop"); err != nil {
+				t.Fatalf("prepareParams failed: %v", err)
+			}
+			violations := checkContract(responseFields, decodeJSON(t, tt.response), "")
+			if tt.wantField != "" {
+				if len(violations) != 1 || !strings.Contains(violations[0], tt.wantField) {
+					t.Errorf("violations %q, want one for %s", violations, tt.wantField)
+				}
+				return
+			}
+			if !reflect.DeepEqual(violations, tt.want) {
+				t.Errorf("violations %q, want %q", violations, tt.want)
+			}
+		})
+	}
+}
+
+func TestContractMode(t *testing.T) {
+	tests := []struct {
+		mode       string
+		response   map[string]interface{}
+		wantStatus int
+		wantBody   string
+	}{
+		{mode: "enforce", response: map[string]interface{}{"id": "pay_1", "secret": "x"}, wantStatus: http.StatusOK, wantBody: `{"id":"pay_1"}`},
+		{mode: "enforce", response: map[string]interface{}{"id": 42, "secret": "x"}, wantStatus: http.StatusBadGateway},
+		{mode: "warn", response: map[string]interface{}{"id": 42, "secret": "x"}, wantStatus: http.StatusOK, wantBody: `{"id":"42"}`},
+		{mode: "off", response: map[string]interface{}{"secret": "x"}, wantStatus: http.StatusOK, wantBody: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.wantBody, func(t *testing.T) {
+			envelope := false
+			route := prepareTestRoute(t, RouteConfig{
+				Path:              "/payments/pay_1",
+				Type:              http.MethodGet,
+				ContractMode:      tt.mode,
+				ResponseStructure: ResponseConfig{Envelope: &envelope, Fields: []ParamConfig{{Name: "id", Type: "string", Required: true}}},
+				Mock:              &MockConfig{Enabled: true, Response: tt.response},
+			})
+			recorder := serveRoute(route, httptest.NewRequest(http.MethodGet, "/payments/pay_1", nil))
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusBadGateway {
+				var body problem.Problem
+				if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil || body.Code != problem.UpstreamInvalid || body.ErrorID == "" || strings.Contains(body.Detail, "id") {
+					t.Errorf("body %s, want an UPSTREAM_INVALID problem with an error ID and no violations", recorder.Body)
+				}
+				return
+			}
+			if strings.TrimSpace(recorder.Body.String()) != tt.wantBody {
+				t.Errorf("body %s, want %s", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPrepareContractMode(t *testing.T) {
+	cfg := testConfig()
+	route := RouteConfig{Path: "/payments", Type: http.MethodGet}
+	if err := PrepareRoute(cfg, &route); err != nil || route.ContractMode != cfg.ContractMode {
+		t.Errorf("got %v and contract_mode %q, want the global %q", err, route.ContractMode, cfg.ContractMode)
+	}
+	route = RouteConfig{Path: "/payments", Type: http.MethodGet, ContractMode: "strict"}
+	if err := PrepareRoute(cfg, &route); err == nil {
+		t.Error("contract_mode strict was accepted")
+	}
+}
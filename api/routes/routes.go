@@ -4,42 +4,97 @@ import (
 	"caaspay-api-go/api/config"
 	"caaspay-api-go/api/handlers"
 	"caaspay-api-go/api/middleware"
+	"caaspay-api-go/api/problem"
 	"caaspay-api-go/internal/logging"
 	"caaspay-api-go/internal/rpc"
+	"caaspay-api-go/internal/webhook"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/spf13/viper"
-	"log"
+	"github.com/google/uuid"
 	"net/http"
-	"reflect"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 )
 
 // RouteConfig represents the configuration for a single route
 type RouteConfig struct {
-	Path              string               `mapstructure:"path"`
-	Type              string               `mapstructure:"type"`
-	Authorization     bool                 `mapstructure:"authorization"`
-	AuthType          string               `mapstructure:"auth_type"`
-	Role              string               `mapstructure:"role"`
-	Service           string               `mapstructure:"service"`
-	Method            string               `mapstructure:"method"`
-	Params            []ParamConfig        `mapstructure:"params"`
-	RateLimit         RouteRateLimitConfig `mapstructure:"rate_limit"`
-	Description       string               `mapstructure:"description"`
-	ResponseStructure map[string]string    `mapstructure:"response_structure"`
+	Path              string                  `mapstructure:"path"`
+	Type              string                  `mapstructure:"type"`
+	Authorization     bool                    `mapstructure:"authorization"`
+	AuthType          string                  `mapstructure:"auth_type"`
+	Role              string                  `mapstructure:"role"`
+	Service           string                  `mapstructure:"service"`
+	Method            string                  `mapstructure:"method"`
+	Params            []ParamConfig           `mapstructure:"params"`
+	RateLimit         RouteRateLimitConfig    `mapstructure:"rate_limit"`
+	Description       string                  `mapstructure:"description"`
+	ResponseStructure ResponseConfig          `mapstructure:"response_structure"`
+	UnknownParams     string                  `mapstructure:"unknown_params"` // reject, drop or passthrough; defaults to the global setting
+	Args              []ArgMapping            `mapstructure:"args"`           // Maps params, claims and constants to the service args
+	ContractMode      string                  `mapstructure:"contract_mode"`  // enforce, warn or off; defaults to the global setting
+	Timeout           time.Duration           `mapstructure:"timeout"`        // RPC timeout; defaults to the global rpc_timeout
+	Mock              *MockConfig             `mapstructure:"mock"`           // Canned response served instead of calling the service
+	Backend           string                  `mapstructure:"backend"`        // rpc or http; defaults to http when proxy is set, rpc otherwise
+	Proxy             *ProxyConfig            `mapstructure:"proxy"`          // HTTP upstreams of an http backend route
+	Pagination        *PaginationConfig       `mapstructure:"pagination"`     // Standard limit/cursor/offset params and page envelope
+	Compression       *bool                   `mapstructure:"compression"`    // Compress responses per Accept-Encoding; defaults to compression.enabled
+	ETag              bool                    `mapstructure:"etag"`           // GET only: ETag over the service response, If-None-Match answered with 304
+	Formats           []string                `mapstructure:"formats"`        // json, msgpack and csv, negotiated with Accept; the first is the default (default: json)
+	CSV               *CSVConfig              `mapstructure:"csv"`            // Rows and columns of CSV responses
+	BodyLimits        config.BodyLimitsConfig `mapstructure:"body_limits"`    // JSON body limits; unset ones default to the global body_limits
+
+	// Versioning and deprecation, announced to clients with Deprecation, Sunset and Link headers
+	Version    string `mapstructure:"version"`    // Set from the enclosing version block
+	Deprecated bool   `mapstructure:"deprecated"` // Adds "Deprecation: true" and marks the operation deprecated in OpenAPI
+	Sunset     string `mapstructure:"sunset"`     // Date the route goes away, as 2006-01-02 or RFC 3339
+	Successor  string `mapstructure:"successor"`  // Path or URL of the replacement route
+
+	sunset time.Time // Parsed Sunset, set by PrepareRoute
+	mocked bool      // Serve the mock instead of calling the service, set by PrepareRoute
+
+	// Multipart handling of routes with file params, set by PrepareRoute
+	multipart       bool
+	maxBodySize     int64 // Room for the fields and files, the default body_limits.max_bytes
+	uploadDir       string
+	uploadRetention time.Duration
 }
 
 // ParamConfig defines the structure for route parameters
 type ParamConfig struct {
-	Name        string `mapstructure:"name"`
-	Type        string `mapstructure:"type"`
-	Required    bool   `mapstructure:"required"` // Defaults to false
-	Description string `mapstructure:"description"`
-	Pattern     string `mapstructure:"pattern"`
+	Name        string        `mapstructure:"name"`
+	In          string        `mapstructure:"in"`       // path, query, header, cookie or body (top-level params only)
+	Type        string        `mapstructure:"type"`     // string, integer, number, decimal, money, boolean, object or array
+	Required    bool          `mapstructure:"required"` // Defaults to false
+	Description string        `mapstructure:"description"`
+	Pattern     string        `mapstructure:"pattern"`
+	Properties  []ParamConfig `mapstructure:"properties"` // Fields of an object parameter
+	Items       *ParamConfig  `mapstructure:"items"`      // Element definition of an array parameter
+	Enum        []interface{} `mapstructure:"enum"`       // Allowed values
+	Minimum     *float64      `mapstructure:"minimum"`    // Inclusive bounds for integer and number values
+	Maximum     *float64      `mapstructure:"maximum"`
+	MinLength   *int          `mapstructure:"min_length"` // Length bounds for string values, in characters
+	MaxLength   *int          `mapstructure:"max_length"`
+	Format      string        `mapstructure:"format"`  // uuid, email, date-time, date, uri, currency or country
+	Default     interface{}   `mapstructure:"default"` // Used when the parameter is not provided
+	Source      string        `mapstructure:"source"`  // Response fields only: service field to read, when renamed
+	Style       string        `mapstructure:"style"`   // Array query params: repeated (?id=1&id=2), comma (?id=1,2) or both when empty
+
+	// Upload settings of file parameters, read from a multipart/form-data body
+	MaxSize      int64    `mapstructure:"max_size"`      // Bytes (default: 10 MiB)
+	ContentTypes []string `mapstructure:"content_types"` // Allowed types, detected from the magic bytes; "image/*" matches any image
+	Storage      string   `mapstructure:"storage"`       // base64 (default) or temp, a file under upload_dir removed after the request
+
+	// Exact decimal settings for decimal and money parameters
+	Scale         *int   `mapstructure:"scale"`          // Maximum decimal places (money uses the currency's minor unit)
+	Precision     int    `mapstructure:"precision"`      // Maximum significant digits
+	Currency      string `mapstructure:"currency"`       // Fixed ISO 4217 currency of a money parameter
+	CurrencyParam string `mapstructure:"currency_param"` // Sibling parameter holding the currency of a money parameter
+	Output        string `mapstructure:"output"`         // "string" (default) or "minor_units"
+
+	pattern       *regexp.Regexp // Compiled Pattern, set by LoadRouteConfigs
+	unknownParams string         // Route's unknown_params mode for undeclared object properties, set by LoadRouteConfigs
 }
 
 // RouteRateLimitConfig holds per-route rate limit settings.
@@ -48,53 +103,202 @@ type RouteRateLimitConfig struct {
 	Burst int `mapstructure:"burst"`
 }
 
-// LoadRouteConfigs loads and returns the route configurations from the YAML file.
-func LoadRouteConfigs(cfg *config.Config) ([]RouteConfig, error) {
-	viper.SetConfigName("routes")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("./config")
+// supportedMethods lists the HTTP methods a route `type` may declare
+var supportedMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+}
 
-	if err := viper.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read routes config: %w", err)
+// parseSunset reads a sunset date, either a plain date (end of that day, UTC) or an RFC 3339 timestamp
+func parseSunset(value string) (time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		return date.Add(24*time.Hour - time.Second), nil
 	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// authTypes lists the valid values of a route's auth_type
+var authTypes = map[string]bool{
+	"jwt":            true,
+	"oauth":          true,
+	"cloudflare_jwt": true,
+}
 
-	var routes []RouteConfig
-	if err := viper.UnmarshalKey("routes", &routes); err != nil {
-		return nil, fmt.Errorf("failed to parse routes config: %w", err)
+// AcceptsBody reports whether parameters for the given method are read from a JSON body
+func AcceptsBody(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		return true
 	}
+	return false
+}
 
-	// Set default rate limits if not defined
-	for i := range routes {
-		if routes[i].RateLimit.Limit == 0 {
-			routes[i].RateLimit.Limit = cfg.RateLimit.DefaultLimit
+// PathParams returns the names of the Gin path parameters (":id" or "*rest") in a route path
+func PathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			names = append(names, segment[1:])
+		}
+	}
+	return names
+}
+
+// LoadRouteConfigs loads and returns the route configurations from ./config/routes.yaml.
+func LoadRouteConfigs(cfg *config.Config) ([]RouteConfig, error) {
+	return LoadRouteConfigsFrom(cfg, "./config")
+}
+
+// LoadRouteConfigsFrom loads and prepares the routes of routes.yaml, the files it includes and the files in routes.d/.
+func LoadRouteConfigsFrom(cfg *config.Config, dir string) ([]RouteConfig, error) {
+	definitions, problems := ReadRouteDefinitions(dir, true)
+	problems = append(problems, CheckRouteConflicts(definitions)...)
+	if len(problems) > 0 {
+		messages := make([]string, len(problems))
+		for i, problem := range problems {
+			messages[i] = problem.Error()
 		}
-		if routes[i].RateLimit.Burst == 0 {
-			routes[i].RateLimit.Burst = cfg.RateLimit.DefaultBurst
+		return nil, fmt.Errorf("invalid routes config: %s", strings.Join(messages, "; "))
+	}
+
+	routes := make([]RouteConfig, len(definitions))
+	for i, definition := range definitions {
+		routes[i] = definition.Route
+		if err := PrepareRoute(cfg, &routes[i]); err != nil {
+			return nil, fmt.Errorf("%s: %w", definition.File, err)
 		}
 	}
 
 	return routes, nil
 }
 
+// PrepareRoute applies the global defaults to a route, checks its settings and compiles its params.
+func PrepareRoute(cfg *config.Config, route *RouteConfig) error {
+	route.Type = strings.ToUpper(strings.TrimSpace(route.Type))
+	if !supportedMethods[route.Type] {
+		return fmt.Errorf("unsupported route type %q for %s", route.Type, route.Path)
+	}
+	if route.AuthType != "" && !authTypes[route.AuthType] {
+		return fmt.Errorf("unknown auth_type %q for %s %s", route.AuthType, route.Type, route.Path)
+	}
+
+	if route.Timeout == 0 {
+		route.Timeout = cfg.RPCTimeout
+	}
+	if route.Sunset != "" {
+		sunset, err := parseSunset(route.Sunset)
+		if err != nil {
+			return fmt.Errorf("invalid sunset for %s %s: %w", route.Type, route.Path, err)
+		}
+		route.sunset = sunset
+	}
+
+	// Set default rate limits if not defined
+	if route.RateLimit.Limit == 0 {
+		route.RateLimit.Limit = cfg.RateLimit.DefaultLimit
+	}
+	if route.RateLimit.Burst == 0 {
+		route.RateLimit.Burst = cfg.RateLimit.DefaultBurst
+	}
+	if route.Pagination != nil {
+		if err := preparePagination(route); err != nil {
+			return fmt.Errorf("invalid pagination for %s %s: %w", route.Type, route.Path, err)
+		}
+	}
+	if err := resolveParamLocations(route); err != nil {
+		return fmt.Errorf("invalid params for %s %s: %w", route.Type, route.Path, err)
+	}
+	if err := prepareFileParams(cfg, route); err != nil {
+		return fmt.Errorf("invalid params for %s %s: %w", route.Type, route.Path, err)
+	}
+	if err := prepareBodyLimits(cfg, route); err != nil {
+		return fmt.Errorf("invalid body_limits for %s %s: %w", route.Type, route.Path, err)
+	}
+	if route.UnknownParams == "" {
+		route.UnknownParams = cfg.UnknownParams
+	}
+	if !unknownParamModes[route.UnknownParams] {
+		return fmt.Errorf("invalid unknown_params %q for %s %s", route.UnknownParams, route.Type, route.Path)
+	}
+	if err := prepareParams(route.Params, route.UnknownParams); err != nil {
+		return fmt.Errorf("invalid params for %s %s: %w", route.Type, route.Path, err)
+	}
+	if err := prepareArgs(route); err != nil {
+		return fmt.Errorf("invalid args for %s %s: %w", route.Type, route.Path, err)
+	}
+	if route.ResponseStructure.Envelope == nil {
+		envelope := cfg.ResponseEnvelope
+		route.ResponseStructure.Envelope = &envelope
+	}
+	if err := prepareParams(route.ResponseStructure.Fields, "drop"); err != nil {
+		return fmt.Errorf("invalid response_structure for %s %s: %w", route.Type, route.Path, err)
+	}
+	if route.ContractMode == "" {
+		route.ContractMode = cfg.ContractMode
+	}
+	if !contractModes[route.ContractMode] {
+		return fmt.Errorf("invalid contract_mode %q for %s %s", route.ContractMode, route.Type, route.Path)
+	}
+	if route.Backend == "" {
+		route.Backend = "rpc"
+		if route.Proxy != nil {
+			route.Backend = "http"
+		}
+	}
+	if !backends[route.Backend] {
+		return fmt.Errorf("invalid backend %q for %s %s", route.Backend, route.Type, route.Path)
+	}
+	if route.Backend == "http" {
+		if route.Proxy == nil {
+			return fmt.Errorf("backend http requires a proxy block for %s %s", route.Type, route.Path)
+		}
+		if err := prepareProxy(route.Proxy); err != nil {
+			return fmt.Errorf("invalid proxy for %s %s: %w", route.Type, route.Path, err)
+		}
+	}
+	if err := prepareFormats(route); err != nil {
+		return fmt.Errorf("invalid formats for %s %s: %w", route.Type, route.Path, err)
+	}
+	if route.Compression == nil {
+		compression := cfg.Compression.Enabled
+		route.Compression = &compression
+	}
+	if route.ETag && route.Type != http.MethodGet {
+		return fmt.Errorf("etag is only supported on GET routes, not %s %s", route.Type, route.Path)
+	}
+	if route.Mock != nil {
+		if err := prepareMock(route.Mock); err != nil {
+			return fmt.Errorf("invalid mock for %s %s: %w", route.Type, route.Path, err)
+		}
+	}
+	route.mocked = cfg.MockMode || (route.Mock != nil && route.Mock.Enabled)
+	return nil
+}
+
 // SetupRoutes loads the routes from the configuration and sets them up in Gin
-func SetupRoutes(r *gin.Engine, rpcClientPool *rpc.RPCClientPool, cfg *config.Config, routeConfigs []RouteConfig, logger *logging.Logger) error {
+func SetupRoutes(r *gin.Engine, rpcClientPool *rpc.RPCClientPool, readiness *handlers.Readiness, cfg *config.Config, routeConfigs []RouteConfig, logger *logging.Logger) error {
 
 	// Set trusted proxies based on the configuration
 	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
-		log.Fatalf("Failed to set trusted proxies: %v", err)
+		return fmt.Errorf("failed to set trusted proxies: %w", err)
 	}
 
 	// Conditionally add health route
 	if cfg.HealthRouteEnabled {
 		r.GET("/health", func(c *gin.Context) {
-			handlers.HealthHandler(c, rpcClientPool)
+			handlers.HealthHandler(c, rpcClientPool, readiness)
 		})
 	}
 
 	// Conditionally add status route
 	if cfg.StatusRouteEnabled {
 		r.GET("/status", func(c *gin.Context) {
-			handlers.StatusHandler(c, rpcClientPool)
+			handlers.StatusHandler(c, rpcClientPool, readiness)
 		})
 	}
 
@@ -110,23 +314,37 @@ func SetupRoutes(r *gin.Engine, rpcClientPool *rpc.RPCClientPool, cfg *config.Co
 	// Register the routes with middlewares
 	for _, routeConfig := range routeConfigs {
 		// Build the middleware stack
-		mws := buildMiddlewareStack(r, routeConfig, cfg)
+		mws := buildMiddlewareStack(r, routeConfig, cfg, logger)
 
 		// Register the route with the appropriate middlewares
-		log.Printf("FF %v %v", routeConfig, mws)
-		switch routeConfig.Type {
-		case "GET":
-			r.GET(routeConfig.Path, append(mws, createHandler(routeConfig, rpcClientPool))...)
-		case "POST":
-			r.POST(routeConfig.Path, append(mws, createHandler(routeConfig, rpcClientPool))...)
-		default:
-			fmt.Printf("Unsupported route type: %s for path: %s", routeConfig.Type, routeConfig.Path)
+		if !supportedMethods[routeConfig.Type] {
+			// PrepareRoute rejects these, so only routes that skipped it end up here
+			logger.LogWithStats("error", "Skipped route with an unsupported type", map[string]string{
+				"metric_name": "route_skipped",
+			}, map[string]interface{}{"type": routeConfig.Type, "path": routeConfig.Path})
+			continue
 		}
+		if routeConfig.Type == http.MethodOptions && (cfg.EnableCORS || cfg.EnableSecurityHeaders) {
+			// Both middlewares answer preflight requests before they reach the route
+			logger.LogWithStats("warn", "OPTIONS route is shadowed by the CORS preflight handler", map[string]string{
+				"metric_name": "route_shadowed",
+			}, map[string]interface{}{"path": routeConfig.Path})
+		}
+		r.Handle(routeConfig.Type, routeConfig.Path, append(mws, createHandler(routeConfig, rpcClientPool, logger))...)
 	}
 
 	return nil
 }
 
+// SetupWebhookRoutes registers the admin endpoints for inspecting and replaying webhook deliveries
+func SetupWebhookRoutes(r *gin.Engine, dispatcher *webhook.Dispatcher, cfg *config.Config) {
+	admin := r.Group("/admin/webhooks", middleware.JWTAuthMiddleware(cfg), middleware.RBACMiddleware(cfg.Webhooks.AdminRole))
+	admin.GET("/failed", handlers.WebhookFailedHandler(dispatcher))
+	admin.GET("/attempts", handlers.WebhookAttemptsHandler(dispatcher))
+	admin.POST("/failed/:id/replay", handlers.WebhookReplayHandler(dispatcher))
+	admin.POST("/replay", handlers.WebhookReplayAllHandler(dispatcher))
+}
+
 // addMiddlewareStack creates and adds a global middleware stack based on the configuration
 func addMiddlewareStack(r *gin.Engine, cfg *config.Config, logger *logging.Logger) {
 	// Apply security headers if enabled
@@ -151,9 +369,19 @@ func addMiddlewareStack(r *gin.Engine, cfg *config.Config, logger *logging.Logge
 }
 
 // buildMiddlewareStack creates the middleware stack for a given route
-func buildMiddlewareStack(r *gin.Engine, route RouteConfig, cfg *config.Config) []gin.HandlerFunc {
+func buildMiddlewareStack(r *gin.Engine, route RouteConfig, cfg *config.Config, logger *logging.Logger) []gin.HandlerFunc {
 	mws := []gin.HandlerFunc{} // Middleware stack
 
+	// Compress first, so rejections are compressed too
+	if route.Compression != nil && *route.Compression {
+		mws = append(mws, middleware.CompressionMiddleware(cfg.Compression.MinSize, cfg.Compression.Level, cfg.Compression.Brotli))
+	}
+
+	// Announce deprecation before the checks, so clients also see it on rejected requests
+	if route.Deprecated || route.Sunset != "" || route.Successor != "" {
+		mws = append(mws, middleware.DeprecationMiddleware(logger, route.Type+" "+route.Path, route.Version, route.Deprecated, route.sunset, route.Successor))
+	}
+
 	if route.RateLimit.Limit == 0 {
 		route.RateLimit.Limit = cfg.RateLimit.DefaultLimit
 	}
@@ -162,7 +390,7 @@ func buildMiddlewareStack(r *gin.Engine, route RouteConfig, cfg *config.Config)
 	}
 
 	if cfg.RateLimit.Enabled {
-		mws = append(mws, middleware.RateLimitMiddleware(route.Path, route.RateLimit.Limit, route.RateLimit.Burst))
+		mws = append(mws, middleware.RateLimitMiddleware(route.Type+" "+route.Path, route.RateLimit.Limit, route.RateLimit.Burst))
 	}
 	// Add authentication middleware based on auth_type
 	if route.Authorization {
@@ -185,185 +413,168 @@ func buildMiddlewareStack(r *gin.Engine, route RouteConfig, cfg *config.Config)
 }
 
 // createHandler dynamically creates a route handler based on the config and path
-func createHandler(routeConfig RouteConfig, rpcClientPool *rpc.RPCClientPool) gin.HandlerFunc {
+func createHandler(routeConfig RouteConfig, rpcClientPool *rpc.RPCClientPool, logger *logging.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Validate and extract parameters
-		args, err := validateAndExtractParams(c, routeConfig)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
+		logger := logger.ForRequest(c)
 
-		// Determine the service and method
-		service, method := getServiceAndMethod(c, routeConfig)
-
-		// Get an RPC client from the pool
-		//rpcClient := rpcClientPool.GetClient()
-		rpcClient, err := rpcClientPool.GetClient(5 * time.Second)
-		if err != nil {
-			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "all clients are busy"})
+		// Refuse early when the client accepts none of the route's formats
+		if len(routeConfig.Formats) > 1 {
+			c.Writer.Header().Add("Vary", "Accept")
+		}
+		format := negotiateFormat(c.GetHeader("Accept"), routeConfig.Formats)
+		if format == "" {
+			problem.Abort(c, http.StatusNotAcceptable, problem.NotAcceptable, acceptedFormats(routeConfig.Formats))
 			return
 		}
-		defer rpcClientPool.ReturnClient(rpcClient) // Ensure client is returned to the pool
 
-		// Send the RPC request and get the response
-		log.Printf("To call RPC: s:%v m:%v a:%v", service, method, args)
-		response, err := rpcClient.CallRPC(service, method, args)
+		// Validate and extract parameters
+		defer cleanupUploads(c, routeConfig)
+		params, err := validateAndExtractParams(c, routeConfig, logger)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			var limitErr *bodyLimitError
+			if errors.As(err, &limitErr) {
+				logger.LogWithStats("warn", "Request body rejected", map[string]string{
+					"metric_name": "request_body_rejected",
+					"route":       routeConfig.Type + " " + routeConfig.Path,
+					"reason":      limitErr.reason,
+				}, map[string]interface{}{"detail": limitErr.Error()})
+			}
+			var paramProblem *problem.Problem
+			if !errors.As(err, &paramProblem) {
+				paramProblem = problem.New(http.StatusBadRequest, problem.ParamInvalid, err.Error())
+			}
+			problem.Write(c, paramProblem)
 			return
 		}
 
-		// Assuming `response` is of type map[string]interface{}
-		innerResponse, ok := response["response"].(map[string]interface{})
-		if !ok {
-			// Handle the case where "response" field is missing or not of expected type
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "unexpected response structure"})
+		// Build the service args from the params and the auth context
+		args, err := buildArgs(c, routeConfig, params)
+		if err != nil {
+			var missing *missingArgError
+			if errors.As(err, &missing) && missing.mapping.From == "claim" {
+				problem.Abort(c, http.StatusUnauthorized, problem.ClaimMissing, err.Error())
+				return
+			}
+			// Context values are set by the gateway's middleware, so a missing one is a configuration
+			// error rather than the client's
+			errorID := uuid.New().String()
+			logger.LogWithStats("error", "Failed to build service args", map[string]string{
+				"metric_name": "route_args_error",
+				"route":       routeConfig.Type + " " + routeConfig.Path,
+			}, map[string]interface{}{"error_id": errorID, "error": err.Error()})
+			argsProblem := problem.New(http.StatusInternalServerError, problem.InternalError, "unable to build the service request")
+			argsProblem.ErrorID = errorID
+			problem.Write(c, argsProblem)
 			return
 		}
-
-		c.JSON(http.StatusOK, innerResponse)
-
-		// Return the response to the client
-		//c.JSON(200, response.Response)
-	}
-}
-
-func validateAndExtractParams(c *gin.Context, routeConfig RouteConfig) (map[string]interface{}, error) {
-	args := make(map[string]interface{})
-
-	// Extract parameters from the request body for POST/PUT methods
-	if c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPut {
-		if err := c.ShouldBindJSON(&args); err != nil {
-			return nil, fmt.Errorf("Error parsing/binding request body: %v", err.Error())
+		if routeConfig.Pagination != nil {
+			args = paginationArgs(c, routeConfig, args)
 		}
-	}
 
-	log.Printf("BIND: %v", args)
-
-	// Track allowed parameters and validate them
-	allowedParams := map[string]bool{}
-	for _, param := range routeConfig.Params {
-		allowedParams[param.Name] = true
-		// Check query and path params first
-		queryValue, passedAsQuery := c.GetQuery(param.Name)
-		pathValue := c.Param(param.Name)
-
-		// Query parameters have higher precedence over body and path
-		if passedAsQuery {
-			args[param.Name] = queryValue
-		} else if pathValue != "" {
-			args[param.Name] = pathValue
-		}
+		// Determine the service and method
+		service, method := getServiceAndMethod(c, routeConfig)
 
-		// If the parameter is required but not provided
-		if param.Required {
-			if _, exists := args[param.Name]; !exists {
-				return nil, fmt.Errorf("missing required parameter: %s - %s", param.Name, generateDescription(param))
+		// Serve the mock instead of calling the service
+		var innerResponse map[string]interface{}
+		status := http.StatusOK
+		if routeConfig.mocked {
+			var ok bool
+			if innerResponse, ok = mockResponse(c, routeConfig, params, args); !ok {
+				return
 			}
-		}
-
-		// If the parameter exists, validate its type and pattern
-		if paramValue, exists := args[param.Name]; exists {
-			switch param.Type {
-			case "string":
-				// Validate against the pattern if one is provided
-				value, ok := paramValue.(string)
-				if !ok {
-					return nil, fmt.Errorf("unable to parse parameter %s: - %s", param.Name, generateDescription(param))
-				}
-				if param.Pattern != "" {
-					matched, err := regexp.MatchString(param.Pattern, value)
-					if err != nil || !matched {
-						return nil, fmt.Errorf("invalid parameter value for %s: does not match pattern %s - %s", param.Name, param.Pattern, generateDescription(param))
-					}
+		} else if routeConfig.Backend == "http" {
+			var ok bool
+			if innerResponse, status, ok = proxyResponse(c, routeConfig, params, args, logger); !ok {
+				return
+			}
+		} else {
+			// Get an RPC client from the pool
+			//rpcClient := rpcClientPool.GetClient()
+			rpcClient, err := rpcClientPool.GetClient(5 * time.Second)
+			if err != nil {
+				problem.Abort(c, http.StatusServiceUnavailable, problem.ServiceBusy, "all clients are busy")
+				return
+			}
+			defer rpcClientPool.ReturnClient(rpcClient) // Ensure client is returned to the pool
+
+			// Send the RPC request and get the response
+			// Args are not logged, they can hold personal data and uploaded file contents
+			logger.LogWithStats("debug", "Calling service", map[string]string{"metric_name": "rpc_call"}, map[string]interface{}{"service": service, "method": method})
+			response, err := rpcClient.CallRPCWithRequestID(service, method, args, requestID(c), routeConfig.Timeout)
+			if err != nil {
+				// The cause is logged under the error ID rather than shown to the client
+				errorID := uuid.New().String()
+				logger.LogWithStats("error", "Service call failed", map[string]string{
+					"metric_name": "rpc_call_error",
+					"route":       routeConfig.Type + " " + routeConfig.Path,
+				}, map[string]interface{}{"error_id": errorID, "service": service, "method": method, "error": err.Error()})
+				callProblem := problem.New(http.StatusBadGateway, problem.UpstreamError, "the service call failed")
+				if errors.Is(err, rpc.ErrTimeout) {
+					callProblem = problem.New(http.StatusGatewayTimeout, problem.UpstreamTimeout, "the service did not answer in time")
+					retainUploads(c)
 				}
+				callProblem.ErrorID = errorID
+				problem.Write(c, callProblem)
+				return
+			}
 
-			case "integer":
-				// Handle int conversion for both string and numeric input
-				intValue, err := convertToInt(paramValue)
-				if err != nil {
-					return nil, fmt.Errorf("invalid parameter type for %s: expected int - %s", param.Name, generateDescription(param))
-				}
-				args[param.Name] = intValue
+			// Assuming `response` is of type map[string]interface{}
+			var ok bool
+			innerResponse, ok = response["response"].(map[string]interface{})
+			if !ok {
+				// Handle the case where "response" field is missing or not of expected type
+				problem.Abort(c, http.StatusBadGateway, problem.UpstreamInvalid, "unexpected response structure")
+				return
+			}
+		}
 
-			case "number":
-				// Handle float conversion for both string and numeric input
-				floatValue, err := convertToFloat(paramValue)
-				if err != nil {
-					return nil, fmt.Errorf("invalid parameter type for %s: expected float - %s", param.Name, generateDescription(param))
+		// Check the response against the declared contract before shaping it
+		if routeConfig.ContractMode != "off" && (len(routeConfig.ResponseStructure.Fields) > 0 || routeConfig.Pagination != nil) {
+			var violations []string
+			if routeConfig.Pagination != nil {
+				violations = checkPageContract(routeConfig, innerResponse)
+			} else {
+				violations = checkContract(routeConfig.ResponseStructure.Fields, innerResponse, "")
+			}
+			if len(violations) > 0 {
+				errorID := uuid.New().String()
+				level := "warn"
+				if routeConfig.ContractMode == "enforce" {
+					level = "error"
 				}
-				args[param.Name] = floatValue
-
-			case "boolean":
-				// Handle boolean conversion for both string and native bool
-				boolValue, err := convertToBool(paramValue)
-				if err != nil {
-					return nil, fmt.Errorf("invalid parameter type for %s: expected bool - %s", param.Name, generateDescription(param))
+				logger.LogWithStats(level, "Service response violates contract", map[string]string{
+					"metric_name": "response_contract_violation",
+					"route":       routeConfig.Type + " " + routeConfig.Path,
+					"mode":        routeConfig.ContractMode,
+				}, map[string]interface{}{
+					"error_id":   errorID,
+					"service":    service,
+					"method":     method,
+					"violations": violations,
+				})
+				if routeConfig.ContractMode == "enforce" {
+					contractProblem := problem.New(http.StatusBadGateway, problem.UpstreamInvalid, "unexpected response from upstream service")
+					contractProblem.ErrorID = errorID
+					problem.Write(c, contractProblem)
+					return
 				}
-				args[param.Name] = boolValue
 			}
 		}
-	}
-	// Filter out extra parameters (not allowed by the config)
-	for passedParamKey, _ := range args {
-		if _, allowedKey := allowedParams[passedParamKey]; !allowedKey {
-			log.Printf("Passed and extra param: %v", passedParamKey)
-			delete(args, passedParamKey)
-		}
-	}
-
-	return args, nil
-}
-
-// Helper function to convert to int
-func convertToInt(value interface{}) (int, error) {
-	switch v := value.(type) {
-	case float64:
-		return int(v), nil
-	case int:
-		return v, nil
-	case string:
-		return strconv.Atoi(v)
-	default:
-		return 0, fmt.Errorf("unsupported type for int conversion: %v", reflect.TypeOf(value))
-	}
-}
 
-// Helper function to convert to float
-func convertToFloat(value interface{}) (float64, error) {
-	switch v := value.(type) {
-	case float64:
-		return v, nil
-	case string:
-		return strconv.ParseFloat(v, 64)
-	default:
-		return 0, fmt.Errorf("unsupported type for float conversion: %v", reflect.TypeOf(value))
-	}
-}
+		// Answer conditional requests when the service response hasn't changed
+		if etag := responseETag(routeConfig, status, format, innerResponse); etag != "" {
+			c.Header("ETag", etag)
+			if etagMatches(c.GetHeader("If-None-Match"), etag) {
+				c.AbortWithStatus(http.StatusNotModified)
+				return
+			}
+		}
 
-// Helper function to convert to bool
-func convertToBool(value interface{}) (bool, error) {
-	switch v := value.(type) {
-	case bool:
-		return v, nil
-	case string:
-		return strconv.ParseBool(v)
-	default:
-		return false, fmt.Errorf("unsupported type for bool conversion: %v", reflect.TypeOf(value))
-	}
-}
+		writeResponse(c, routeConfig, status, format, shapeResponse(c, routeConfig, innerResponse))
 
-// generateDescription auto-generates a description for a parameter if not provided
-func generateDescription(param ParamConfig) string {
-	description := fmt.Sprintf("%s (%s)", param.Name, param.Type)
-	if param.Required {
-		description += ", required"
-	}
-	if param.Pattern != "" {
-		description += fmt.Sprintf(", pattern: %s", param.Pattern)
+		// Return the response to the client
+		//c.JSON(200, response.Response)
 	}
-	return description
 }
 
 // getServiceAndMethod determines the service and method either from the config or the path
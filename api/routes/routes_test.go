@@ -0,0 +1,176 @@
+package routes
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testLogger discards everything below panic
+var testLogger = logging.NewLogger("test", "test", "panic", false, nil, context.Background())
+
+// testConfig returns the default configuration
+func testConfig() *config.Config {
+	cfg := &config.Config{}
+	config.ApplyDefaults(cfg)
+	return cfg
+}
+
+// prepareTestRoute prepares a route against the default configuration
+func prepareTestRoute(t *testing.T, route RouteConfig) RouteConfig {
+	t.Helper()
+	if err := PrepareRoute(testConfig(), &route); err != nil {
+		t.Fatalf("PrepareRoute failed: %v", err)
+	}
+	return route
+}
+
+// serveRoute handles the request with the route's handler, after the given middleware
+func serveRoute(route RouteConfig, req *http.Request, middleware ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	engine := gin.New()
+	engine.Handle(route.Type, route.Path, append(middleware, createHandler(route, nil, testLogger))...)
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRouteMethods(t *testing.T) {
+	tests := []struct {
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{method: http.MethodPut, target: "/payments/pay_1", body: `{"amount":"10.00"}`, wantStatus: http.StatusOK, wantBody: `{"amount":"10.00","payment_id":"pay_1"}`},
+		{method: http.MethodPatch, target: "/payments/pay_1", body: `{"amount":"10.00"}`, wantStatus: http.StatusOK, wantBody: `{"amount":"10.00","payment_id":"pay_1"}`},
+		{method: http.MethodPatch, target: "/payments/pay_1", wantStatus: http.StatusBadRequest},
+		{method: http.MethodPatch, target: "/payments/pay_1?amount=99", body: `{}`, wantStatus: http.StatusOK, wantBody: `{"payment_id":"pay_1"}`},
+		{method: http.MethodDelete, target: "/payments/pay_1", body: `{"amount":"10.00"}`, wantStatus: http.StatusOK, wantBody: `{"amount":"10.00","payment_id":"pay_1"}`},
+		{method: http.MethodDelete, target: "/payments/pay_1", wantStatus: http.StatusOK, wantBody: `{"payment_id":"pay_1"}`},
+		{method: http.MethodHead, target: "/payments/pay_1", wantStatus: http.StatusOK},
+		{method: http.MethodOptions, target: "/payments/pay_1", wantStatus: http.StatusOK, wantBody: `{"payment_id":"pay_1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.target, func(t *testing.T) {
+			route := RouteConfig{
+				Path:   "/payments/:payment_id",
+				Type:   strings.ToLower(tt.method), // Types are case-insensitive
+				Params: []ParamConfig{{Name: "payment_id", Type: "string"}},
+				Mock:   &MockConfig{Enabled: true, Template: `{{json .Params}}`},
+			}
+			if tt.method != http.MethodHead && tt.method != http.MethodOptions {
+				route.Params = append(route.Params, ParamConfig{Name: "amount", Type: "string", In: "body"})
+			}
+			route = prepareTestRoute(t, route)
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req := httptest.NewRequest(tt.method, tt.target, body)
+			req.Header.Set("Content-Type", "application/json")
+			recorder := serveRoute(route, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("got %d %s, want %d", recorder.Code, recorder.Body, tt.wantStatus)
+			}
+			if tt.wantBody != "" && strings.TrimSpace(recorder.Body.String()) != tt.wantBody {
+				t.Errorf("body %s, want %s", recorder.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestPrepareRouteMethods(t *testing.T) {
+	tests := []struct {
+		route   RouteConfig
+		wantErr bool
+	}{
+		{route: RouteConfig{Path: "/payments", Type: " patch "}},
+		{route: RouteConfig{Path: "/payments", Type: "FETCH"}, wantErr: true},
+		{route: RouteConfig{Path: "/payments", Type: ""}, wantErr: true},
+		{route: RouteConfig{Path: "/payments", Type: "GET", Params: []ParamConfig{{Name: "amount", In: "body"}}}, wantErr: true},
+		{route: RouteConfig{Path: "/payments", Type: "DELETE", Params: []ParamConfig{{Name: "reason", In: "body"}}}},
+		{route: RouteConfig{Path: "/payments", Type: "PUT", ETag: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route.Type+" "+tt.route.Path, func(t *testing.T) {
+			err := PrepareRoute(testConfig(), &tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && tt.route.Type != strings.ToUpper(strings.TrimSpace(tt.route.Type)) {
+				t.Errorf("type %q was not normalised", tt.route.Type)
+			}
+		})
+	}
+}
+
+func TestParseSunset(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "2027-06-30", want: time.Date(2027, 6, 30, 23, 59, 59, 0, time.UTC)},
+		{value: "2027-06-30T12:00:00+02:00", want: time.Date(2027, 6, 30, 10, 0, 0, 0, time.UTC)},
+		{value: "30/06/2027", wantErr: true},
+		{value: "2027-06-31", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSunset(tt.value)
+		if (err != nil) != tt.wantErr || (err == nil && !got.Equal(tt.want)) {
+			t.Errorf("parseSunset(%q) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	tests := []struct {
+		name  string
+		route RouteConfig
+		want  map[string]string
+	}{
+		{
+			name:  "deprecated with sunset and successor",
+			route: RouteConfig{Version: "v1", Deprecated: true, Sunset: "2027-06-30", Successor: "/v2/payments"},
+			want:  map[string]string{"Deprecation": "true", "Sunset": "Wed, 30 Jun 2027 23:59:59 GMT", "Link": `</v2/payments>; rel="successor-version"`},
+		},
+		{
+			name:  "sunset only",
+			route: RouteConfig{Version: "v1", Sunset: "2027-06-30T12:00:00Z"},
+			want:  map[string]string{"Deprecation": "", "Sunset": "Wed, 30 Jun 2027 12:00:00 GMT", "Link": ""},
+		},
+		{
+			name:  "current version",
+			route: RouteConfig{Version: "v2"},
+			want:  map[string]string{"Deprecation": "", "Sunset": "", "Link": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.route.Path = "/payments"
+			tt.route.Type = http.MethodGet
+			tt.route.Mock = &MockConfig{Enabled: true, Response: map[string]interface{}{}}
+			route := prepareTestRoute(t, tt.route)
+			// Rejected requests carry the headers too
+			reject := func(c *gin.Context) { c.AbortWithStatus(http.StatusUnauthorized) }
+			for _, middleware := range [][]gin.HandlerFunc{nil, {reject}} {
+				recorder := serveRoute(route, httptest.NewRequest(http.MethodGet, "/payments", nil), append(buildMiddlewareStack(nil, route, testConfig(), testLogger), middleware...)...)
+				for name, value := range tt.want {
+					if got := recorder.Header().Get(name); got != value {
+						t.Errorf("%d response: %s = %q, want %q", recorder.Code, name, got, value)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package routes
+
+import (
+	"bytes"
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxFileSize = 10 << 20 // Per file, when max_size isn't set
+	multipartFields    = 1 << 20  // Allowance for the non-file fields of a multipart body
+	multipartMemory    = 1 << 20  // Larger parts are buffered on disk while the request is handled
+)
+
+// storageModes lists how an uploaded file reaches the service: base64 content in the args, or the
+// path of a temporary file under upload_dir, which the services must share with the gateway. Files
+// are not streamed to services in chunks, RPC messages carry a single args object.
+var storageModes = map[string]bool{
+	"base64": true,
+	"temp":   true,
+}
+
+// uploadsKey is the context key holding the temporary files of a request
+const uploadsKey = "uploaded_files"
+
+// uploadsRetainedKey is set when the temporary files of a request must outlive it
+const uploadsRetainedKey = "uploaded_files_retained"
+
+// prepareFileParams checks the file params of a route and sets up its multipart handling
+func prepareFileParams(cfg *config.Config, route *RouteConfig) error {
+	maxBodySize := int64(multipartFields)
+	for i := range route.Params {
+		param := &route.Params[i]
+		if err := checkNestedFiles(param.Name, param.Properties, param.Items); err != nil {
+			return err
+		}
+		if param.Type != "file" {
+			continue
+		}
+		if param.In != "body" || !AcceptsBody(route.Type) {
+			return fmt.Errorf("param %s: files are only accepted in the body of POST, PUT and PATCH routes", param.Name)
+		}
+		if param.Default != nil {
+			return fmt.Errorf("param %s: files can't have a default", param.Name)
+		}
+		if param.MaxSize < 0 {
+			return fmt.Errorf("param %s: max_size must be positive", param.Name)
+		}
+		if param.MaxSize == 0 {
+			param.MaxSize = defaultMaxFileSize
+		}
+		if param.Storage == "" {
+			param.Storage = "base64"
+		}
+		if !storageModes[param.Storage] {
+			return fmt.Errorf("param %s: invalid storage %q (expected base64 or temp)", param.Name, param.Storage)
+		}
+		for _, contentType := range param.ContentTypes {
+			if !strings.Contains(contentType, "/") {
+				return fmt.Errorf("param %s: invalid content type %q", param.Name, contentType)
+			}
+		}
+		maxBodySize += param.MaxSize
+		route.multipart = true
+	}
+	if route.multipart {
+		route.maxBodySize = maxBodySize
+		route.uploadDir = cfg.UploadDir
+		route.uploadRetention = cfg.UploadRetention
+	}
+	return nil
+}
+
+// checkNestedFiles rejects file params inside objects and arrays, multipart bodies are flat
+func checkNestedFiles(path string, properties []ParamConfig, items *ParamConfig) error {
+	for _, property := range properties {
+		if property.Type == "file" {
+			return fmt.Errorf("param %s.%s: files are only accepted as top-level params", path, property.Name)
+		}
+		if err := checkNestedFiles(path+"."+property.Name, property.Properties, property.Items); err != nil {
+			return err
+		}
+	}
+	if items != nil {
+		if items.Type == "file" {
+			return fmt.Errorf("param %s: files are only accepted as top-level params", path)
+		}
+		return checkNestedFiles(path+"[]", items.Properties, items.Items)
+	}
+	return nil
+}
+
+// readMultipart parses a multipart/form-data body within the route's max_bytes. Fields are
+// returned as strings and files as their *multipart.FileHeader.
+func readMultipart(c *gin.Context, routeConfig RouteConfig) (map[string]interface{}, error) {
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return nil, problem.New(http.StatusUnsupportedMediaType, problem.BodyInvalid, "expected a multipart/form-data body")
+	}
+
+	maxBytes := routeConfig.BodyLimits.MaxBytes
+	if c.Request.ContentLength > maxBytes {
+		return nil, tooLarge(maxBytes)
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return nil, tooLarge(maxBytes)
+		}
+		return nil, problem.New(http.StatusBadRequest, problem.BodyInvalid, "invalid multipart/form-data body")
+	}
+
+	body := make(map[string]interface{})
+	for key, values := range c.Request.MultipartForm.Value {
+		if len(values) > 0 {
+			body[key] = values[0]
+		}
+	}
+	for key, files := range c.Request.MultipartForm.File {
+		if len(files) > 0 {
+			body[key] = files[0]
+		}
+	}
+	return body, nil
+}
+
+// readUpload checks an uploaded file against its param and returns the metadata passed to the
+// service: name, size, content_type and sha256, plus the content or the path of a temporary copy.
+// The content type is detected from the file's magic bytes, the client's claim is ignored.
+func readUpload(c *gin.Context, routeConfig RouteConfig, param ParamConfig, value interface{}) (map[string]interface{}, error) {
+	header, ok := value.(*multipart.FileHeader)
+	if !ok {
+		return nil, fmt.Errorf("invalid parameter type for %s: expected a file upload - %s", param.Name, generateDescription(param))
+	}
+	if header.Size > param.MaxSize {
+		return nil, fmt.Errorf("invalid parameter value for %s: file larger than %d bytes - %s", param.Name, param.MaxSize, generateDescription(param))
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %v", param.Name, err)
+	}
+	defer file.Close()
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("unable to read file %s: %v", param.Name, err)
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(sniff[:n]))
+	if !allowedContentType(param.ContentTypes, contentType) {
+		return nil, fmt.Errorf("invalid parameter value for %s: file type %s is not allowed (expected %s)", param.Name, contentType, strings.Join(param.ContentTypes, ", "))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %v", param.Name, err)
+	}
+
+	metadata := map[string]interface{}{
+		"name":         header.Filename,
+		"size":         header.Size,
+		"content_type": contentType,
+	}
+	hash := sha256.New()
+	switch param.Storage {
+	case "temp":
+		temp, err := os.CreateTemp(routeConfig.uploadDir, "upload-*")
+		if err != nil {
+			return nil, fmt.Errorf("unable to store file %s: %v", param.Name, err)
+		}
+		c.Set(uploadsKey, append(c.GetStringSlice(uploadsKey), temp.Name()))
+		_, err = io.Copy(io.MultiWriter(temp, hash), file)
+		if closeErr := temp.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to store file %s: %v", param.Name, err)
+		}
+		metadata["path"] = temp.Name()
+	default:
+		var content bytes.Buffer
+		encoder := base64.NewEncoder(base64.StdEncoding, &content)
+		if _, err := io.Copy(io.MultiWriter(encoder, hash), file); err != nil {
+			return nil, fmt.Errorf("unable to read file %s: %v", param.Name, err)
+		}
+		encoder.Close()
+		metadata["content"] = content.String()
+	}
+	metadata["sha256"] = hex.EncodeToString(hash.Sum(nil))
+	return metadata, nil
+}
+
+// allowedContentType matches a detected content type against the allowed ones; "image/*" matches
+// any image and an empty list allows everything
+func allowedContentType(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, candidate := range allowed {
+		if candidate == contentType || (strings.HasSuffix(candidate, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(candidate, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// retainUploads keeps the temporary files of a request whose service call timed out, as the service
+// may still be reading them
+func retainUploads(c *gin.Context) {
+	c.Set(uploadsRetainedKey, true)
+}
+
+// cleanupUploads removes the temporary files of a request once it has been handled, or after the
+// upload_retention when they were retained
+func cleanupUploads(c *gin.Context, routeConfig RouteConfig) {
+	paths := c.GetStringSlice(uploadsKey)
+	remove := func() {
+		for _, path := range paths {
+			os.Remove(path)
+		}
+	}
+	if c.GetBool(uploadsRetainedKey) && len(paths) > 0 {
+		time.AfterFunc(routeConfig.uploadRetention, remove)
+	} else {
+		remove()
+	}
+	if c.Request.MultipartForm != nil {
+		c.Request.MultipartForm.RemoveAll()
+	}
+}
@@ -0,0 +1,207 @@
+package routes
+
+import (
+	"bytes"
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/problem"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pngFile is the start of a PNG image, enough for content type detection
+var pngFile = append([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), bytes.Repeat([]byte{0}, 64)...)
+
+// uploadRequest builds a multipart request with a file part, sent with the given client content type
+func uploadRequest(t *testing.T, field, filename, contentType string, content []byte) *http.Request {
+	t.Helper()
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	header := make(map[string][]string)
+	header["Content-Disposition"] = []string{`form-data; name="` + field + `"; filename="` + filename + `"`}
+	header["Content-Type"] = []string{contentType}
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	writer.WriteField("note", "passport")
+	writer.Close()
+	req := httptest.NewRequest(http.MethodPost, "/kyc/documents", &form)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+// uploadRoute prepares a POST route with a single file param
+func uploadRoute(t *testing.T, cfg *config.Config, param ParamConfig) RouteConfig {
+	t.Helper()
+	param.Name, param.Type, param.In = "document", "file", "body"
+	route := RouteConfig{Path: "/kyc/documents", Type: http.MethodPost, UnknownParams: "drop", Params: []ParamConfig{param, {Name: "note", Type: "string", In: "body"}}}
+	if err := prepareFileParams(cfg, &route); err != nil {
+		t.Fatalf("prepareFileParams failed: %v", err)
+	}
+	if err := prepareBodyLimits(cfg, &route); err != nil {
+		t.Fatalf("prepareBodyLimits failed: %v", err)
+	}
+	if err := prepareParams(route.Params, "drop"); err != nil {
+		t.Fatalf("prepareParams failed: %v", err)
+	}
+	return route
+}
+
+// handleUpload validates the request's params like the route handler, including the cleanup
+func handleUpload(route RouteConfig, req *http.Request, during func(c *gin.Context, args map[string]interface{})) (map[string]interface{}, error) {
+	var args map[string]interface{}
+	var err error
+	engine := gin.New()
+	engine.POST(route.Path, func(c *gin.Context) {
+		defer cleanupUploads(c, route)
+		args, err = validateAndExtractParams(c, route, testLogger)
+		if during != nil {
+			during(c, args)
+		}
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+	return args, err
+}
+
+func TestPrepareFileParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		route   RouteConfig
+		wantErr bool
+	}{
+		{name: "file", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "document", Type: "file", In: "body"}}}},
+		{name: "file on GET", route: RouteConfig{Type: http.MethodGet, Params: []ParamConfig{{Name: "document", Type: "file", In: "body"}}}, wantErr: true},
+		{name: "file in the query", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "document", Type: "file", In: "query"}}}, wantErr: true},
+		{name: "nested file", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "kyc", Type: "object", In: "body", Properties: []ParamConfig{{Name: "document", Type: "file"}}}}}, wantErr: true},
+		{name: "file items", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "documents", Type: "array", In: "body", Items: &ParamConfig{Type: "file"}}}}, wantErr: true},
+		{name: "default", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "document", Type: "file", In: "body", Default: "x"}}}, wantErr: true},
+		{name: "unknown storage", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "document", Type: "file", In: "body", Storage: "s3"}}}, wantErr: true},
+		{name: "invalid content type", route: RouteConfig{Type: http.MethodPost, Params: []ParamConfig{{Name: "document", Type: "file", In: "body", ContentTypes: []string{"pdf"}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := prepareFileParams(&config.Config{}, &tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil {
+				param := tt.route.Params[0]
+				if !tt.route.multipart || param.MaxSize != defaultMaxFileSize || param.Storage != "base64" || tt.route.maxBodySize != multipartFields+defaultMaxFileSize {
+					t.Errorf("got multipart %v, max_size %d, storage %q, body size %d, want the defaults", tt.route.multipart, param.MaxSize, param.Storage, tt.route.maxBodySize)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadContentTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowed     []string
+		filename    string
+		contentType string // Claimed by the client, never trusted
+		content     []byte
+		maxSize     int64
+		wantType    string
+		wantErr     bool
+	}{
+		{name: "png", allowed: []string{"image/png"}, filename: "a.png", contentType: "image/png", content: pngFile, wantType: "image/png"},
+		{name: "any image", allowed: []string{"image/*"}, filename: "a.png", contentType: "application/octet-stream", content: pngFile, wantType: "image/png"},
+		{name: "pdf", allowed: []string{"application/pdf", "image/*"}, filename: "a.pdf", contentType: "application/pdf", content: []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"), wantType: "application/pdf"},
+		{name: "claimed png", allowed: []string{"image/png"}, filename: "a.png", contentType: "image/png", content: []byte("just text"), wantErr: true},
+		{name: "html in a pdf", allowed: []string{"application/pdf"}, filename: "a.pdf", contentType: "application/pdf", content: []byte("<html><script>alert(1)</script></html>"), wantErr: true},
+		{name: "anything allowed", filename: "a.txt", contentType: "text/plain", content: []byte("hello"), wantType: "text/plain"},
+		{name: "too large", filename: "a.png", contentType: "image/png", content: pngFile, maxSize: 16, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := uploadRoute(t, &config.Config{}, ParamConfig{ContentTypes: tt.allowed, MaxSize: tt.maxSize})
+			args, err := handleUpload(route, uploadRequest(t, "document", tt.filename, tt.contentType, tt.content), nil)
+			if tt.wantErr {
+				var uploadProblem *problem.Problem
+				if !errors.As(err, &uploadProblem) || uploadProblem.Code != problem.ParamInvalid || uploadProblem.Errors[0].Field != "document" {
+					t.Fatalf("got %v, %v, want a PARAM_INVALID problem for document", args, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validateAndExtractParams failed: %v", err)
+			}
+			sum := sha256.Sum256(tt.content)
+			document := args["document"].(map[string]interface{})
+			if document["content_type"] != tt.wantType || document["name"] != tt.filename || document["size"] != int64(len(tt.content)) ||
+				document["sha256"] != hex.EncodeToString(sum[:]) || document["content"] != base64.StdEncoding.EncodeToString(tt.content) {
+				t.Errorf("document %v, want %s metadata and base64 content", document, tt.wantType)
+			}
+			if args["note"] != "passport" {
+				t.Errorf("note %v, want the form field", args["note"])
+			}
+		})
+	}
+}
+
+func TestTempUploads(t *testing.T) {
+	for _, retained := range []bool{false, true} {
+		cfg := &config.Config{UploadDir: t.TempDir(), UploadRetention: 50 * time.Millisecond}
+		route := uploadRoute(t, cfg, ParamConfig{Storage: "temp"})
+		var path string
+		_, err := handleUpload(route, uploadRequest(t, "document", "a.png", "image/png", pngFile), func(c *gin.Context, args map[string]interface{}) {
+			path, _ = args["document"].(map[string]interface{})["path"].(string)
+			if data, err := os.ReadFile(path); err != nil || !bytes.Equal(data, pngFile) {
+				t.Errorf("temporary file %s holds %q, %v, want the upload", path, data, err)
+			}
+			if retained {
+				retainUploads(c)
+			}
+		})
+		if err != nil {
+			t.Fatalf("validateAndExtractParams failed: %v", err)
+		}
+
+		_, statErr := os.Stat(path)
+		if retained != (statErr == nil) {
+			t.Errorf("retained %v: temporary file exists after the request: %v", retained, statErr == nil)
+		}
+		if retained {
+			time.Sleep(150 * time.Millisecond)
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("retained temporary file still exists after upload_retention")
+			}
+		}
+	}
+}
+
+func TestUploadBodyType(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+		wantCode   problem.Code
+	}{
+		{name: "not multipart", header: "application/json", wantStatus: http.StatusUnsupportedMediaType, wantCode: problem.BodyInvalid},
+		{name: "broken multipart", header: "multipart/form-data; boundary=x", wantStatus: http.StatusBadRequest, wantCode: problem.BodyInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := uploadRoute(t, &config.Config{}, ParamConfig{})
+			req := httptest.NewRequest(http.MethodPost, "/kyc/documents", bytes.NewReader([]byte(`{"document":"x"}`)))
+			req.Header.Set("Content-Type", tt.header)
+			_, err := handleUpload(route, req, nil)
+			var bodyProblem *problem.Problem
+			if !errors.As(err, &bodyProblem) || bodyProblem.Status != tt.wantStatus || bodyProblem.Code != tt.wantCode {
+				t.Errorf("got %v, want a %d %s problem", err, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
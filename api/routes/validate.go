@@ -0,0 +1,177 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RouteProblem is a mistake found in a route definition. Field is the dotted path of the offending
+// key within the route (e.g. "params.2.pattern"), or empty when the problem concerns the whole route.
+type RouteProblem struct {
+	Field   string
+	Message string
+}
+
+// paramTypes lists the valid values of a parameter's type; an empty type accepts any value
+var paramTypes = map[string]bool{
+	"string":  true,
+	"integer": true,
+	"number":  true,
+	"decimal": true,
+	"money":   true,
+	"boolean": true,
+	"object":  true,
+	"array":   true,
+	"file":    true,
+}
+
+// rolePattern matches well-formed role names
+var rolePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.:-]*$`)
+
+// ValidateRoute checks a route definition as written in routes.yaml and reports every problem found,
+// so they can all be fixed at once instead of one per restart.
+func ValidateRoute(route RouteConfig) []RouteProblem {
+	var problems []RouteProblem
+	add := func(field, format string, args ...interface{}) {
+		problems = append(problems, RouteProblem{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !strings.HasPrefix(route.Path, "/") {
+		add("path", "path %q must start with /", route.Path)
+	}
+	method := strings.ToUpper(strings.TrimSpace(route.Type))
+	if !supportedMethods[method] {
+		add("type", "unsupported route type %q", route.Type)
+	}
+
+	switch {
+	case route.AuthType != "" && !authTypes[route.AuthType]:
+		add("auth_type", "unknown auth_type %q (expected jwt, oauth or cloudflare_jwt)", route.AuthType)
+	case route.Authorization && route.AuthType == "":
+		add("authorization", "authorization is enabled but auth_type is not set, so no authentication is applied")
+	case !route.Authorization && route.AuthType != "":
+		add("auth_type", "auth_type %q is ignored because authorization is false", route.AuthType)
+	}
+
+	if route.Role != "" {
+		if !rolePattern.MatchString(route.Role) {
+			add("role", "invalid role name %q", route.Role)
+		}
+		if !route.Authorization {
+			add("role", "role %q requires authorization, the role is read from the authenticated token", route.Role)
+		}
+	}
+
+	if route.UnknownParams != "" && !unknownParamModes[route.UnknownParams] {
+		add("unknown_params", "invalid unknown_params %q (expected reject, drop or passthrough)", route.UnknownParams)
+	}
+	if route.ContractMode != "" && !contractModes[route.ContractMode] {
+		add("contract_mode", "invalid contract_mode %q (expected enforce, warn or off)", route.ContractMode)
+	}
+
+	if route.Backend != "" && !backends[route.Backend] {
+		add("backend", "invalid backend %q (expected rpc or http)", route.Backend)
+	}
+	if route.Backend == "http" && route.Proxy == nil {
+		add("backend", "backend http requires a proxy block with the upstreams")
+	}
+	if route.Backend == "rpc" && route.Proxy != nil {
+		add("proxy", "proxy is ignored because backend is rpc")
+	}
+
+	if route.Pagination != nil {
+		if route.Pagination.Mode != "" && !paginationModes[route.Pagination.Mode] {
+			add("pagination.mode", "invalid pagination mode %q (expected cursor or offset)", route.Pagination.Mode)
+		}
+		if envelope := route.ResponseStructure.Envelope; envelope != nil && !*envelope {
+			add("response_structure.envelope", "pagination requires the response envelope, meta.pagination is part of it")
+		}
+	}
+
+	csvEnabled := false
+	for i, format := range route.Formats {
+		if _, ok := formatTypes[format]; !ok {
+			add(fmt.Sprintf("formats.%d", i), "invalid format %q (expected json, msgpack or csv)", format)
+		}
+		csvEnabled = csvEnabled || format == "csv"
+	}
+	if csvEnabled && route.Pagination == nil && (route.CSV == nil || route.CSV.Field == "") {
+		add("csv.field", "csv needs pagination or csv.field naming the array of rows")
+	}
+	if route.CSV != nil && !csvEnabled {
+		add("csv", "csv is ignored because formats doesn't include csv")
+	}
+
+	if limits := route.BodyLimits; limits.MaxBytes < 0 || limits.MaxDepth < 0 || limits.MaxKeys < 0 || limits.MaxStringLength < 0 {
+		add("body_limits", "body_limits must be positive")
+	}
+
+	if route.ETag && method != http.MethodGet {
+		add("etag", "etag is only supported on GET routes")
+	}
+
+	if route.Sunset != "" {
+		if _, err := parseSunset(route.Sunset); err != nil {
+			add("sunset", "invalid sunset %q (expected a date such as 2026-12-31 or an RFC 3339 timestamp)", route.Sunset)
+		}
+	}
+	if route.Successor != "" && !strings.HasPrefix(route.Successor, "/") && !strings.HasPrefix(route.Successor, "https://") && !strings.HasPrefix(route.Successor, "http://") {
+		add("successor", "successor %q must be a path starting with / or an http(s) URL", route.Successor)
+	}
+
+	for i, param := range route.Params {
+		problems = append(problems, validateParamDefinition(fmt.Sprintf("params.%d", i), param)...)
+		if param.In != "" && !paramLocations[strings.ToLower(param.In)] {
+			add(fmt.Sprintf("params.%d.in", i), "param %s: unknown location %q", param.Name, param.In)
+		}
+		if param.Style != "" && !queryStyles[param.Style] {
+			add(fmt.Sprintf("params.%d.style", i), "param %s: invalid style %q (expected repeated or comma)", param.Name, param.Style)
+		}
+	}
+	for i, field := range route.ResponseStructure.Fields {
+		problems = append(problems, validateParamDefinition(fmt.Sprintf("response_structure.fields.%d", i), field)...)
+	}
+	for i, mapping := range route.Args {
+		if mapping.From != "" && !argSources[mapping.From] {
+			add(fmt.Sprintf("args.%d.from", i), "arg %s: unknown source %q", mapping.Name, mapping.From)
+		}
+	}
+
+	return problems
+}
+
+// validateParamDefinition checks the type, pattern and format of a parameter and its nested definitions
+func validateParamDefinition(field string, param ParamConfig) []RouteProblem {
+	var problems []RouteProblem
+	if param.Name == "" && !strings.HasSuffix(field, ".items") {
+		problems = append(problems, RouteProblem{Field: field, Message: "param without a name"})
+	}
+	if param.Type != "" && !paramTypes[param.Type] {
+		problems = append(problems, RouteProblem{Field: field + ".type", Message: fmt.Sprintf("param %s: unknown type %q", param.Name, param.Type)})
+	}
+	if param.Type == "file" && (!strings.HasPrefix(field, "params.") || strings.Count(field, ".") > 1) {
+		problems = append(problems, RouteProblem{Field: field + ".type", Message: fmt.Sprintf("param %s: files are only accepted as top-level params", param.Name)})
+	}
+	if param.Storage != "" && !storageModes[param.Storage] {
+		problems = append(problems, RouteProblem{Field: field + ".storage", Message: fmt.Sprintf("param %s: invalid storage %q (expected base64 or temp)", param.Name, param.Storage)})
+	}
+	if param.Pattern != "" {
+		if _, err := regexp.Compile(param.Pattern); err != nil {
+			problems = append(problems, RouteProblem{Field: field + ".pattern", Message: fmt.Sprintf("param %s: invalid pattern: %v", param.Name, err)})
+		}
+	}
+	if param.Format != "" {
+		if _, ok := formatValidators[param.Format]; !ok {
+			problems = append(problems, RouteProblem{Field: field + ".format", Message: fmt.Sprintf("param %s: unknown format %q", param.Name, param.Format)})
+		}
+	}
+	for i, property := range param.Properties {
+		problems = append(problems, validateParamDefinition(fmt.Sprintf("%s.properties.%d", field, i), property)...)
+	}
+	if param.Items != nil {
+		problems = append(problems, validateParamDefinition(field+".items", *param.Items)...)
+	}
+	return problems
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/routes"
+	"caaspay-api-go/api/validate"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDebounce groups the burst of events editors produce when saving a file
+const reloadDebounce = 500 * time.Millisecond
+
+// watchedExtensions are the extensions of the config files that trigger a reload when changed
+var watchedExtensions = map[string]bool{
+	".yaml": true,
+	".yml":  true,
+}
+
+// restartSettings are the api.yaml settings used by components created once at startup.
+// Changes to them are reported but only take effect after a restart.
+var restartSettings = map[string]bool{
+	"app_name":        true,
+	"env":             true,
+	"log_level":       true,
+	"host":            true,
+	"port":            true,
+	"metrics_enabled": true,
+	"datadog_addr":    true,
+	"redis":           true,
+	"rpc_pool":        true,
+	"webhooks":        true,
+	"mock_mode":       true,
+	"shutdown":        true,
+}
+
+// Reloader re-reads the configuration and swaps in a new router when it is valid
+type Reloader struct {
+	mu           sync.Mutex
+	configDir    string
+	router       *Router
+	deps         Dependencies
+	cfg          *config.Config
+	routeConfigs []routes.RouteConfig
+}
+
+// NewReloader creates a reloader for a router built from the configuration in configDir
+func NewReloader(configDir string, router *Router, deps Dependencies, cfg *config.Config, routeConfigs []routes.RouteConfig) *Reloader {
+	return &Reloader{
+		configDir:    configDir,
+		router:       router,
+		deps:         deps,
+		cfg:          cfg,
+		routeConfigs: routeConfigs,
+	}
+}
+
+// Reload parses and validates the config files and swaps in a router built from them.
+// On any error the current configuration stays active.
+func (rl *Reloader) Reload(trigger string) error {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	err := rl.reload(trigger)
+	if err != nil {
+		rl.deps.Logger.LogWithStats("error", "Config reload failed, keeping current config", map[string]string{"metric_name": "config_reload_error", "trigger": trigger}, map[string]interface{}{"error": err.Error()})
+	}
+	return err
+}
+
+func (rl *Reloader) reload(trigger string) error {
+	if err := validate.Error(validate.Check(rl.configDir)); err != nil {
+		return err
+	}
+	cfg, err := config.LoadAPIConfigFrom(rl.configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	settings, pending := configDiff(rl.cfg, cfg)
+	keepRestartSettings(rl.cfg, cfg)
+
+	routeConfigs, err := routes.LoadRouteConfigsFrom(cfg, rl.configDir)
+	if err != nil {
+		return fmt.Errorf("failed to load route configurations: %w", err)
+	}
+
+	engine, err := BuildRouter(cfg, routeConfigs, rl.deps)
+	if err != nil {
+		return err
+	}
+	rl.router.Swap(engine)
+
+	added, removed, changed := routeDiff(rl.routeConfigs, routeConfigs)
+	rl.cfg, rl.routeConfigs = cfg, routeConfigs
+
+	rl.deps.Logger.LogWithStats("info", "Config reloaded", map[string]string{"metric_name": "config_reload", "trigger": trigger}, map[string]interface{}{
+		"settings_changed": settings,
+		"routes_added":     added,
+		"routes_removed":   removed,
+		"routes_changed":   changed,
+	})
+	if len(pending) > 0 {
+		rl.deps.Logger.LogWithStats("warn", "Changed settings require a restart", map[string]string{"metric_name": "config_reload_restart_required"}, map[string]interface{}{"settings": pending})
+	}
+	return nil
+}
+
+// Watch reloads the configuration when a YAML file in the config directory or routes.d/ changes,
+// or the process receives SIGHUP, until the context is cancelled
+func (rl *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	// Watch the directories rather than the files, editors often replace files on save
+	if err := watcher.Add(rl.configDir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", rl.configDir, err)
+	}
+	routesDir := filepath.Join(rl.configDir, "routes.d")
+	if info, err := os.Stat(routesDir); err == nil && info.IsDir() {
+		if err := watcher.Add(routesDir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %s: %w", routesDir, err)
+		}
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		defer watcher.Close()
+		defer signal.Stop(hangup)
+
+		var debounce *time.Timer
+		for {
+			select {
+			case <-ctx.Done():
+				if debounce != nil {
+					debounce.Stop()
+				}
+				return
+			case <-hangup:
+				rl.Reload("sighup")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !watchedExtensions[filepath.Ext(event.Name)] || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename|fsnotify.Remove) {
+					continue
+				}
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(reloadDebounce, func() {
+					rl.Reload("file_change")
+				})
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				rl.deps.Logger.LogWithStats("error", "Config watcher error", map[string]string{"metric_name": "config_watch_error"}, map[string]interface{}{"error": err.Error()})
+			}
+		}
+	}()
+	return nil
+}
+
+// configDiff returns the top-level settings that differ between two configs, and the subset
+// of those that need a restart. Only setting names are returned so secrets never reach the logs.
+func configDiff(current, next *config.Config) (changed []string, pending []string) {
+	currentValue, nextValue := reflect.ValueOf(*current), reflect.ValueOf(*next)
+	for i := 0; i < currentValue.NumField(); i++ {
+		if reflect.DeepEqual(currentValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			continue
+		}
+		name := currentValue.Type().Field(i).Tag.Get("mapstructure")
+		changed = append(changed, name)
+		if restartSettings[name] {
+			pending = append(pending, name)
+		}
+	}
+	return changed, pending
+}
+
+// keepRestartSettings copies the settings that need a restart from the running config,
+// so the new router stays consistent with the components created at startup
+func keepRestartSettings(current, next *config.Config) {
+	currentValue, nextValue := reflect.ValueOf(current).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < currentValue.NumField(); i++ {
+		if restartSettings[currentValue.Type().Field(i).Tag.Get("mapstructure")] {
+			nextValue.Field(i).Set(currentValue.Field(i))
+		}
+	}
+}
+
+// routeDiff compares two route sets by method and path
+func routeDiff(current, next []routes.RouteConfig) (added, removed, changed []string) {
+	index := func(routeConfigs []routes.RouteConfig) map[string]routes.RouteConfig {
+		byKey := make(map[string]routes.RouteConfig, len(routeConfigs))
+		for _, route := range routeConfigs {
+			byKey[route.Type+" "+route.Path] = route
+		}
+		return byKey
+	}
+	currentRoutes, nextRoutes := index(current), index(next)
+
+	for key, route := range nextRoutes {
+		previous, exists := currentRoutes[key]
+		switch {
+		case !exists:
+			added = append(added, key)
+		case !reflect.DeepEqual(previous, route):
+			changed = append(changed, key)
+		}
+	}
+	for key := range currentRoutes {
+		if _, exists := nextRoutes[key]; !exists {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
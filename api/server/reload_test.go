@@ -0,0 +1,204 @@
+package server
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/routes"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeConfigFile writes a config file into dir
+func writeConfigFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// get serves a GET request through the router
+func get(router *Router, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigFile(t, dir, "api.yaml", "app_name: \"test\"\nmock_mode: true\n")
+	writeConfigFile(t, dir, "routes.yaml", `routes:
+  - path: "/v1/slow"
+    type: "GET"
+    mock:
+      latency: 300ms
+      response: {engine: "old"}
+  - path: "/v1/old"
+    type: "GET"
+    mock:
+      response: {engine: "old"}
+`)
+
+	cfg, err := config.LoadAPIConfigFrom(dir)
+	if err != nil {
+		t.Fatalf("LoadAPIConfigFrom failed: %v", err)
+	}
+	routeConfigs, err := routes.LoadRouteConfigsFrom(cfg, dir)
+	if err != nil {
+		t.Fatalf("LoadRouteConfigsFrom failed: %v", err)
+	}
+	deps := Dependencies{Logger: logging.NewLogger("test", "test", "panic", false, nil, context.Background())}
+	engine, err := BuildRouter(cfg, routeConfigs, deps)
+	if err != nil {
+		t.Fatalf("BuildRouter failed: %v", err)
+	}
+	router := &Router{}
+	router.Swap(engine)
+	reloader := NewReloader(dir, router, deps, cfg, routeConfigs)
+
+	// A request started before the reload finishes on the engine it started with
+	inFlight := make(chan *httptest.ResponseRecorder)
+	go func() { inFlight <- get(router, "/v1/slow") }()
+	time.Sleep(100 * time.Millisecond)
+
+	// mock_mode needs a restart, so the new routes are still mocked without enabling their mocks
+	writeConfigFile(t, dir, "api.yaml", "app_name: \"test\"\nmock_mode: false\nunknown_params: \"reject\"\n")
+	writeConfigFile(t, dir, "routes.yaml", `routes:
+  - path: "/v1/slow"
+    type: "GET"
+    mock:
+      latency: 300ms
+      response: {engine: "new"}
+  - path: "/v1/new"
+    type: "GET"
+    mock:
+      response: {engine: "new"}
+`)
+	if err := reloader.Reload("test"); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if recorder := <-inFlight; recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"engine":"old"`) {
+		t.Errorf("in-flight request got %d %s, want the old engine's response", recorder.Code, recorder.Body)
+	}
+	for path, want := range map[string]int{"/v1/slow": http.StatusOK, "/v1/new": http.StatusOK, "/v1/old": http.StatusNotFound} {
+		recorder := get(router, path)
+		if recorder.Code != want {
+			t.Errorf("GET %s got %d, want %d", path, recorder.Code, want)
+		}
+		if want == http.StatusOK && !strings.Contains(recorder.Body.String(), `"engine":"new"`) {
+			t.Errorf("GET %s got %s, want the new engine's response", path, recorder.Body)
+		}
+	}
+
+	if !reloader.cfg.MockMode || reloader.cfg.UnknownParams != "reject" {
+		t.Errorf("reloaded mock_mode %v and unknown_params %q, want mock_mode kept and unknown_params applied", reloader.cfg.MockMode, reloader.cfg.UnknownParams)
+	}
+	added, removed, changed := routeDiff(routeConfigs, reloader.routeConfigs)
+	if !reflect.DeepEqual(added, []string{"GET /v1/new"}) || !reflect.DeepEqual(removed, []string{"GET /v1/old"}) || !reflect.DeepEqual(changed, []string{"GET /v1/slow"}) {
+		t.Errorf("route diff added %v, removed %v, changed %v", added, removed, changed)
+	}
+
+	// An invalid config keeps the current engine
+	writeConfigFile(t, dir, "routes.yaml", "routes:\n  - path: \"/v1/new\"\n    type: \"FETCH\"\n")
+	if err := reloader.Reload("test"); err == nil {
+		t.Fatal("Reload accepted an invalid route")
+	}
+	if recorder := get(router, "/v1/new"); recorder.Code != http.StatusOK {
+		t.Errorf("GET /v1/new got %d after a failed reload, want 200", recorder.Code)
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	current := &config.Config{AppName: "test", Port: 8080, UnknownParams: "drop"}
+	next := &config.Config{AppName: "test", Port: 9090, UnknownParams: "reject", DatadogAddr: "dd:8125"}
+
+	changed, pending := configDiff(current, next)
+	if want := []string{"datadog_addr", "port", "unknown_params"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %v, want %v", changed, want)
+	}
+	if want := []string{"datadog_addr", "port"}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("pending %v, want %v", pending, want)
+	}
+
+	keepRestartSettings(current, next)
+	if next.Port != 8080 || next.DatadogAddr != "" || next.UnknownParams != "reject" {
+		t.Errorf("after keepRestartSettings port %d, datadog_addr %q, unknown_params %q", next.Port, next.DatadogAddr, next.UnknownParams)
+	}
+}
+
+func TestBuildRouterRecoversPanics(t *testing.T) {
+	cfg := &config.Config{AppName: "test"}
+	config.ApplyDefaults(cfg)
+	engine, err := BuildRouter(cfg, nil, Dependencies{Logger: logging.NewLogger("test", "test", "panic", false, nil, context.Background())})
+	if err != nil {
+		t.Fatalf("BuildRouter failed: %v", err)
+	}
+	engine.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	recorder := httptest.NewRecorder()
+	engine.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/panic", nil))
+	if recorder.Code != http.StatusInternalServerError || recorder.Header().Get("Content-Type") != "application/problem+json" || !strings.Contains(recorder.Body.String(), `"error_id"`) {
+		t.Errorf("got %d %q %s, want a 500 problem with an error ID", recorder.Code, recorder.Header().Get("Content-Type"), recorder.Body)
+	}
+}
+
+func TestBuildRouterProblems(t *testing.T) {
+	cfg := &config.Config{AppName: "test", ErrorDocsURL: "https://docs.example.com/errors"}
+	config.ApplyDefaults(cfg)
+	engine, err := BuildRouter(cfg, nil, Dependencies{Logger: logging.NewLogger("test", "test", "panic", false, nil, context.Background())})
+	if err != nil {
+		t.Fatalf("BuildRouter failed: %v", err)
+	}
+	engine.GET("/panic", func(c *gin.Context) { panic("boom") })
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		status int
+		want   map[string]interface{}
+	}{
+		{"no route", http.MethodGet, "/v1/missing", http.StatusNotFound, map[string]interface{}{
+			"type": "https://docs.example.com/errors/not-found", "title": "Not found", "code": "NOT_FOUND",
+			"detail": "no route matches GET /v1/missing", "instance": "/v1/missing", "request_id": "req-1",
+		}},
+		{"panic", http.MethodGet, "/panic", http.StatusInternalServerError, map[string]interface{}{
+			"type": "https://docs.example.com/errors/internal-error", "title": "Internal error", "code": "INTERNAL_ERROR",
+			"instance": "/panic", "request_id": "req-1",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Request-ID", "req-1")
+			recorder := httptest.NewRecorder()
+			engine.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.status || recorder.Header().Get("Content-Type") != "application/problem+json" {
+				t.Fatalf("got %d %q, want %d application/problem+json", recorder.Code, recorder.Header().Get("Content-Type"), tt.status)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid body %s: %v", recorder.Body, err)
+			}
+			if body["status"] != float64(tt.status) {
+				t.Errorf("status field %v, want %d", body["status"], tt.status)
+			}
+			for key, want := range tt.want {
+				if body[key] != want {
+					t.Errorf("%s = %v, want %v", key, body[key], want)
+				}
+			}
+		})
+	}
+}
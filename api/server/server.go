@@ -0,0 +1,99 @@
+package server
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/handlers"
+	"caaspay-api-go/api/middleware"
+	"caaspay-api-go/api/problem"
+	"caaspay-api-go/api/routes"
+	"caaspay-api-go/internal/logging"
+	"caaspay-api-go/internal/openapi"
+	"caaspay-api-go/internal/rpc"
+	"caaspay-api-go/internal/webhook"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	swaggerFiles "github.com/swaggo/files"
+	"github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// Router serves requests with the current gin engine, which can be swapped at any time.
+// Requests already running keep the engine they started with.
+type Router struct {
+	engine atomic.Pointer[gin.Engine]
+}
+
+// ServeHTTP dispatches the request to the current engine
+func (rt *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	rt.engine.Load().ServeHTTP(w, req)
+}
+
+// Swap replaces the engine used for new requests
+func (rt *Router) Swap(engine *gin.Engine) {
+	rt.engine.Store(engine)
+}
+
+// Dependencies holds the long-lived components shared by every router build
+type Dependencies struct {
+	RPCClientPool *rpc.RPCClientPool
+	Dispatcher    *webhook.Dispatcher // nil when webhooks are disabled
+	Logger        *logging.Logger
+	Readiness     *handlers.Readiness // Failed on shutdown, reported by /health and /status
+}
+
+// BuildRouter creates a gin engine with all routes of the given configuration.
+// Gin panics on conflicting routes, so those are returned as errors instead.
+func BuildRouter(cfg *config.Config, routeConfigs []routes.RouteConfig, deps Dependencies) (r *gin.Engine, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			r, err = nil, fmt.Errorf("failed to register routes: %v", recovered)
+		}
+	}()
+
+	// Set up Gin with logger middleware
+	if cfg.Env == "production" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r = gin.New()
+	r.Use(gin.Logger())
+	r.Use(func(c *gin.Context) {
+		deps.Logger.Middleware()(c)
+	})
+	r.Use(otelgin.Middleware(cfg.AppName))
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(problem.Docs(cfg.ErrorDocsURL))
+	// After the request ID and docs, so panics get a complete problem response
+	r.Use(middleware.RecoveryMiddleware(deps.Logger))
+	r.NoRoute(func(c *gin.Context) {
+		problem.Abort(c, http.StatusNotFound, problem.NotFound, "no route matches "+c.Request.Method+" "+c.Request.URL.Path)
+	})
+
+	// Initialize the routes with the route configuration
+	if err := routes.SetupRoutes(r, deps.RPCClientPool, deps.Readiness, cfg, routeConfigs, deps.Logger); err != nil {
+		return nil, err
+	}
+
+	// Expose the webhook admin endpoints
+	if deps.Dispatcher != nil {
+		routes.SetupWebhookRoutes(r, deps.Dispatcher, cfg)
+	}
+
+	if cfg.EnableOpenapiSwagger {
+		// Generate OpenAPI spec from routeConfigs and additional static routes
+		openAPISpec, err := openapi.GenerateOpenAPISpec(routeConfigs, cfg)
+		if err != nil {
+			deps.Logger.LogWithStats("error", "Failed to generate OpenAPI spec", map[string]string{"error": err.Error()}, nil)
+		} else {
+			r.GET("/openapi.json", func(c *gin.Context) {
+				c.JSON(http.StatusOK, openAPISpec)
+			})
+		}
+
+		r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
+	}
+
+	return r, nil
+}
@@ -0,0 +1,341 @@
+package validate
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/routes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a configuration mistake, located by file and line when possible
+type Problem struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// String formats the problem as file:line: message
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.File, p.Message)
+}
+
+// Check validates api.yaml, credentials.yaml and the route files in the given directory and returns
+// every problem found, ordered by file and line
+func Check(dir string) []Problem {
+	var problems []Problem
+
+	// Unknown keys are settings that would be silently ignored
+	apiFile := filepath.Join(dir, "api.yaml")
+	apiRoot, err := readYAML(apiFile)
+	if err != nil {
+		problems = append(problems, Problem{File: apiFile, Message: err.Error()})
+	} else {
+		problems = append(problems, unknownKeys(apiFile, apiRoot, reflect.TypeOf(config.Config{}), "")...)
+	}
+	credentialsFile := filepath.Join(dir, "credentials.yaml")
+	if _, err := os.Stat(credentialsFile); err == nil {
+		credentialsRoot, err := readYAML(credentialsFile)
+		if err != nil {
+			problems = append(problems, Problem{File: credentialsFile, Message: err.Error()})
+		} else {
+			problems = append(problems, unknownKeys(credentialsFile, credentialsRoot, reflect.TypeOf(config.Config{}), "")...)
+		}
+	}
+
+	// Decode leniently, unknown keys are already reported above
+	cfg := &config.Config{}
+	v := viper.New()
+	v.SetConfigFile(apiFile)
+	if err := v.ReadInConfig(); err == nil {
+		if _, err := os.Stat(credentialsFile); err == nil {
+			v.SetConfigFile(credentialsFile)
+			v.MergeInConfig()
+		}
+		if err := v.Unmarshal(cfg); err != nil {
+			problems = append(problems, Problem{File: apiFile, Message: err.Error()})
+		}
+	}
+	config.ApplyDefaults(cfg)
+	problems = append(problems, checkSettings(apiFile, apiRoot, cfg)...)
+
+	problems = append(problems, checkRoutes(dir, cfg)...)
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+// Error joins the problems into a single error, or returns nil when there are none
+func Error(problems []Problem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.String()
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// checkSettings checks the global settings whose values are restricted
+func checkSettings(file string, root *yaml.Node, cfg *config.Config) []Problem {
+	var problems []Problem
+	if !map[string]bool{"reject": true, "drop": true, "passthrough": true}[cfg.UnknownParams] {
+		problems = append(problems, Problem{File: file, Line: locate(root, "unknown_params"), Message: fmt.Sprintf("invalid unknown_params %q (expected reject, drop or passthrough)", cfg.UnknownParams)})
+	}
+	if !map[string]bool{"enforce": true, "warn": true, "off": true}[cfg.ContractMode] {
+		problems = append(problems, Problem{File: file, Line: locate(root, "contract_mode"), Message: fmt.Sprintf("invalid contract_mode %q (expected enforce, warn or off)", cfg.ContractMode)})
+	}
+	if cfg.Compression.Level < 1 || cfg.Compression.Level > 9 {
+		problems = append(problems, Problem{File: file, Line: locate(root, "compression.level"), Message: fmt.Sprintf("invalid compression level %d (expected 1 to 9)", cfg.Compression.Level)})
+	}
+	if cfg.Compression.MinSize < 0 {
+		problems = append(problems, Problem{File: file, Line: locate(root, "compression.min_size"), Message: "compression min_size must be positive"})
+	}
+	if limits := cfg.BodyLimits; limits.MaxBytes < 0 || limits.MaxDepth < 0 || limits.MaxKeys < 0 || limits.MaxStringLength < 0 {
+		problems = append(problems, Problem{File: file, Line: locate(root, "body_limits"), Message: "body_limits must be positive"})
+	}
+	if cfg.Webhooks.ClaimIdle < 2*cfg.Webhooks.Timeout {
+		problems = append(problems, Problem{File: file, Line: locate(root, "webhooks.claim_idle"), Message: fmt.Sprintf("webhooks claim_idle %s must be at least twice the timeout (%s)", cfg.Webhooks.ClaimIdle, cfg.Webhooks.Timeout)})
+	}
+	for i, secret := range cfg.Webhooks.Secrets {
+		if secret.MerchantID == "" || secret.Secret == "" {
+			problems = append(problems, Problem{File: file, Line: locate(root, fmt.Sprintf("webhooks.secrets.%d", i)), Message: "webhook secrets need a merchant_id and a secret"})
+		}
+	}
+	for i, user := range cfg.JWT.AllowedUsers {
+		if user.Role == "" {
+			problems = append(problems, Problem{File: file, Line: locate(root, fmt.Sprintf("jwt.allowed_users.%d", i)), Message: fmt.Sprintf("allowed user %s has no role", user.Username)})
+		}
+	}
+	return problems
+}
+
+// checkRoutes checks every route of every route file, including duplicates and roles no user can hold
+func checkRoutes(dir string, cfg *config.Config) []Problem {
+	files, err := routes.RouteFiles(dir)
+	if err != nil {
+		return []Problem{{File: filepath.Join(dir, "routes.yaml"), Message: err.Error()}}
+	}
+
+	var problems []Problem
+	roots := map[string]*yaml.Node{}
+	for _, file := range files {
+		root, err := readYAML(file)
+		if err != nil {
+			problems = append(problems, Problem{File: file, Message: err.Error()})
+			continue
+		}
+		roots[file] = root
+		problems = append(problems, unknownKeys(file, root, reflect.TypeOf(routes.RouteFile{}), "")...)
+	}
+
+	// Unknown keys are reported above with their line, so decode leniently
+	definitions, definitionProblems := routes.ReadRouteDefinitions(dir, false)
+	for _, problem := range append(definitionProblems, routes.CheckRouteConflicts(definitions)...) {
+		problems = append(problems, Problem{File: problem.File, Line: locate(roots[problem.File], problem.Field), Message: problem.Err.Error()})
+	}
+
+	// Roles that self-issued JWTs can carry
+	jwtRoles := map[string]bool{}
+	for _, user := range cfg.JWT.AllowedUsers {
+		jwtRoles[user.Role] = true
+	}
+
+	for _, definition := range definitions {
+		route, file := definition.Route, definition.File
+		at := func(field string) int {
+			if field == "" {
+				return locate(roots[file], definition.Field)
+			}
+			return locate(roots[file], definition.Field+"."+field)
+		}
+
+		key := strings.ToUpper(strings.TrimSpace(route.Type)) + " " + route.Path
+		routeProblems := routes.ValidateRoute(route)
+		for _, problem := range routeProblems {
+			problems = append(problems, Problem{File: file, Line: at(problem.Field), Message: fmt.Sprintf("%s: %s", key, problem.Message)})
+		}
+
+		if route.Role != "" && route.AuthType == "jwt" && cfg.SelfJWTEnabled && len(jwtRoles) > 0 && !jwtRoles[route.Role] {
+			problems = append(problems, Problem{File: file, Line: at("role"), Message: fmt.Sprintf("%s: role %q is not held by any jwt.allowed_users entry", key, route.Role)})
+		}
+
+		// Remaining checks (defaults, args, money currencies...) are those applied at load time
+		if len(routeProblems) == 0 {
+			if err := routes.PrepareRoute(cfg, &route); err != nil {
+				problems = append(problems, Problem{File: file, Line: at(""), Message: err.Error()})
+			}
+		}
+	}
+	return problems
+}
+
+// readYAML parses a YAML file and returns its root node
+func readYAML(file string) (*yaml.Node, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	return document.Content[0], nil
+}
+
+// locate returns the line of the node at a dotted path such as "routes.3.params.1.pattern".
+// When the path doesn't exist the line of its deepest existing parent is returned.
+func locate(node *yaml.Node, path string) int {
+	if node == nil {
+		return 0
+	}
+	line := node.Line
+	for _, segment := range strings.Split(path, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if strings.EqualFold(node.Content[i].Value, segment) {
+					line, next = node.Content[i].Line, node.Content[i+1]
+					break
+				}
+			}
+			if next == nil {
+				return line
+			}
+			node = next
+		case yaml.SequenceNode:
+			var index int
+			if _, err := fmt.Sscanf(segment, "%d", &index); err != nil || index < 0 || index >= len(node.Content) {
+				return line
+			}
+			node = node.Content[index]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// unknownKeys walks a YAML node alongside the Go type it is decoded into and reports every
+// mapping key that matches no mapstructure field
+func unknownKeys(file string, node *yaml.Node, t reflect.Type, path string) []Problem {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var problems []Problem
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		// The flat response_structure form is decoded as its fields, its keys are field names
+		var raw map[string]interface{}
+		if t == reflect.TypeOf(routes.ResponseConfig{}) && node.Decode(&raw) == nil && routes.IsFlatResponseStructure(raw) {
+			return nil
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			fields[strings.ToLower(name)] = field.Type
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			fieldType, ok := fields[strings.ToLower(key.Value)]
+			if !ok {
+				message := fmt.Sprintf("unknown key %s", keyPath)
+				if suggestion := suggestKey(strings.ToLower(key.Value), fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", suggestion)
+				}
+				problems = append(problems, Problem{File: file, Line: key.Line, Message: message})
+				continue
+			}
+			problems = append(problems, unknownKeys(file, value, fieldType, keyPath)...)
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return nil
+		}
+		for i, item := range node.Content {
+			problems = append(problems, unknownKeys(file, item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			problems = append(problems, unknownKeys(file, node.Content[i+1], t.Elem(), path+"."+node.Content[i].Value)...)
+		}
+	}
+	return problems
+}
+
+// suggestKey returns the known key an unknown one was most likely meant to be, if any
+func suggestKey(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		if strings.HasSuffix(name, "_"+key) || strings.HasPrefix(name, key+"_") {
+			return name
+		}
+		if distance := editDistance(key, name); distance < bestDistance || (distance == bestDistance && name < best) {
+			best, bestDistance = name, distance
+		}
+	}
+	if bestDistance > 2 {
+		return ""
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
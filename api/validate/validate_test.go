@@ -0,0 +1,110 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeConfig writes the given files into a new config directory and returns it
+func writeConfig(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+const validRoutes = `routes:
+  - path: "/v1/payments"
+    type: "GET"
+`
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // Problems as file:line: message, relative to the config directory
+	}{
+		{
+			name:  "valid",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\n", "routes.yaml": validRoutes},
+		},
+		{
+			name:  "unknown setting with a suggestion",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\nmock_mod: true\n", "routes.yaml": validRoutes},
+			want:  []string{"api.yaml:2: unknown key mock_mod (did you mean mock_mode?)"},
+		},
+		{
+			name:  "unknown nested setting",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\ncompression:\n  enabled: true\n  levle: 5\n", "routes.yaml": validRoutes},
+			want:  []string{"api.yaml:4: unknown key compression.levle (did you mean level?)"},
+		},
+		{
+			name:  "unknown setting in credentials",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\n", "credentials.yaml": "jwt:\n  jwt_secert: \"x\"\n", "routes.yaml": validRoutes},
+			want:  []string{"credentials.yaml:2: unknown key jwt.jwt_secert (did you mean jwt_secret?)"},
+		},
+		{
+			name:  "invalid setting value",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\nunknown_params: \"ignore\"\n", "routes.yaml": validRoutes},
+			want: []string{
+				`api.yaml:2: invalid unknown_params "ignore" (expected reject, drop or passthrough)`,
+				`routes.yaml:2: invalid unknown_params "ignore" for GET /v1/payments`,
+			},
+		},
+		{
+			name: "unknown route key",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\n", "routes.yaml": `routes:
+  - path: "/v1/payments"
+    type: "GET"
+    params:
+      - name: "status"
+        typ: "string"
+`},
+			want: []string{"routes.yaml:6: unknown key routes[0].params[0].typ (did you mean type?)"},
+		},
+		{
+			name: "invalid route at its line",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\n", "routes.yaml": `routes:
+  - path: "/v1/payments"
+    type: "GET"
+  - path: "/v1/refunds"
+    type: "FETCH"
+`},
+			want: []string{`routes.yaml:5: FETCH /v1/refunds: unsupported route type "FETCH"`},
+		},
+		{
+			name: "flat response_structure",
+			files: map[string]string{"api.yaml": "app_name: \"test\"\n", "routes.yaml": `routes:
+  - path: "/v1/payments"
+    type: "GET"
+    response_structure:
+      id: "string"
+      amount: "decimal"
+`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeConfig(t, tt.files)
+			var got []string
+			for _, problem := range Check(dir) {
+				rel, _ := filepath.Rel(dir, problem.File)
+				problem.File = rel
+				got = append(got, problem.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problems %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
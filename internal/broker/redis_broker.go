@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -75,8 +77,10 @@ func (r *RedisBroker) Subscribe(ctx context.Context, channel string, onMessage f
 		for msg := range ch {
 			var response map[string]interface{}
 
-			// Parse the message payload as JSON
-			if err := json.Unmarshal([]byte(msg.Payload), &response); err == nil {
+			// Parse the message payload as JSON, keeping numbers exact
+			decoder := json.NewDecoder(strings.NewReader(msg.Payload))
+			decoder.UseNumber()
+			if err := decoder.Decode(&response); err == nil {
 				onMessage(response)
 			}
 		}
@@ -154,11 +158,61 @@ func (r *RedisBroker) XAck(ctx context.Context, stream, group string, messageIDs
 	return count, nil
 }
 
+// XAutoClaim transfers to consumer up to count pending messages idle for at least minIdle, scanning
+// from start, and returns them with the ID to continue the scan from ("0-0" once done)
+func (r *RedisBroker) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error) {
+	return r.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   r.applyPrefix(stream),
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    start,
+		Count:    count,
+	}).Result()
+}
+
 // XTrim trims the stream to a specified length
 func (r *RedisBroker) XTrim(ctx context.Context, stream string, maxLen int64) error {
 	return r.client.XTrimMaxLen(ctx, r.applyPrefix(stream), maxLen).Err()
 }
 
+// XGroupCreate creates a consumer group on a stream, creating the stream if needed.
+// An already existing group is not treated as an error.
+func (r *RedisBroker) XGroupCreate(ctx context.Context, stream, group, startID string) error {
+	err := r.client.XGroupCreateMkStream(ctx, r.applyPrefix(stream), group, startID).Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create group %s on stream %s: %v", group, stream, err)
+	}
+	return nil
+}
+
+// XRevRange returns up to count messages from a stream, newest first
+func (r *RedisBroker) XRevRange(ctx context.Context, stream, end, start string, count int64) ([]redis.XMessage, error) {
+	messages, err := r.client.XRevRangeN(ctx, r.applyPrefix(stream), end, start, count).Result()
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// XRange returns up to count messages from a stream between start and end IDs
+func (r *RedisBroker) XRange(ctx context.Context, stream, start, end string, count int64) ([]redis.XMessage, error) {
+	messages, err := r.client.XRangeN(ctx, r.applyPrefix(stream), start, end, count).Result()
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// XDel removes messages from a stream
+func (r *RedisBroker) XDel(ctx context.Context, stream string, messageIDs ...string) (int64, error) {
+	count, err := r.client.XDel(ctx, r.applyPrefix(stream), messageIDs...).Result()
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 // --------- Other Redis Data Structures ---------
 
 // Set adds a key-value pair to Redis with an optional expiration time
@@ -203,6 +257,26 @@ func (r *RedisBroker) SMembers(ctx context.Context, key string) ([]string, error
 	return result, nil
 }
 
+// ZAdd adds a member to a Redis sorted set with the given score
+func (r *RedisBroker) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	return r.client.ZAdd(ctx, r.applyPrefix(key), redis.Z{Score: score, Member: member}).Err()
+}
+
+// ZRangeByScore returns up to count members of a sorted set with a score of at most max, lowest first
+func (r *RedisBroker) ZRangeByScore(ctx context.Context, key string, max float64, count int64) ([]string, error) {
+	return r.client.ZRangeByScore(ctx, r.applyPrefix(key), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatFloat(max, 'f', -1, 64),
+		Count: count,
+	}).Result()
+}
+
+// ZRem removes a member from a sorted set and reports whether it was there
+func (r *RedisBroker) ZRem(ctx context.Context, key, member string) (bool, error) {
+	removed, err := r.client.ZRem(ctx, r.applyPrefix(key), member).Result()
+	return removed > 0, err
+}
+
 // LPush adds a value to a Redis list (left push)
 func (r *RedisBroker) LPush(ctx context.Context, key string, values ...interface{}) error {
 	return r.client.LPush(ctx, r.applyPrefix(key), values...).Err()
@@ -18,6 +18,7 @@ type Logger struct {
 	metricsEnabled bool
 	metrics        Metrics
 	ctx            context.Context
+	fields         logrus.Fields // Added to every line, e.g. the request ID
 }
 
 type Metrics interface {
@@ -47,6 +48,26 @@ func NewLogger(owner, env, logLevel string, metricsEnabled bool, metrics Metrics
 	}
 }
 
+// ForRequest returns a logger adding the request ID of the given request to every line
+func (l *Logger) ForRequest(c *gin.Context) *Logger {
+	id := c.GetString("request_id")
+	if id == "" {
+		return l
+	}
+	return l.WithField("request_id", id)
+}
+
+// WithField returns a logger adding the given field to every line
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	scoped := *l
+	scoped.fields = make(logrus.Fields, len(l.fields)+1)
+	for k, v := range l.fields {
+		scoped.fields[k] = v
+	}
+	scoped.fields[key] = value
+	return &scoped
+}
+
 // LogWithStats logs the message and records the metric if enabled
 func (l *Logger) LogWithStats(logLevel, msg string, metric map[string]string, extra map[string]interface{}) {
 	level, err := logrus.ParseLevel(logLevel)
@@ -56,7 +77,7 @@ func (l *Logger) LogWithStats(logLevel, msg string, metric map[string]string, ex
 	entry := l.logger.WithFields(logrus.Fields{
 		"owner": l.owner,
 		"env":   l.env,
-	})
+	}).WithFields(l.fields)
 
 	for key, value := range metric {
 		entry = entry.WithField(key, value)
@@ -145,12 +166,20 @@ func (l *Logger) Middleware() gin.HandlerFunc {
 			"method":      c.Request.Method,
 			"path":        c.Request.URL.Path,
 		})
+		if id := c.GetString("request_id"); id != "" {
+			logEntry = logEntry.WithField("request_id", id)
+		}
 
 		// Add Cloudflare header fields if present
 		for key, value := range cfHeaderData {
 			logEntry = logEntry.WithField(key, value)
 		}
 
+		// Tag requests that forwarded params the route doesn't declare
+		if unvalidated, exists := c.Get("unvalidated_params"); exists {
+			logEntry = logEntry.WithField("unvalidated_params", unvalidated)
+		}
+
 		logEntry.Info("request handled")
 	}
 }
@@ -0,0 +1,55 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestForRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+	}{
+		{"with request ID", "req-1"},
+		{"without request ID", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := NewLogger("test", "test", "info", false, nil, context.Background())
+			logger.logger.SetOutput(&out)
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/payments", nil)
+			if tt.requestID != "" {
+				c.Set("request_id", tt.requestID)
+			}
+			logger.ForRequest(c).LogWithStats("info", "Incoming request", map[string]string{"path": "/payments"}, nil)
+			logger.LogWithStats("info", "Unscoped", nil, nil)
+
+			lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2: %s", len(lines), out.String())
+			}
+			var scoped, unscoped map[string]interface{}
+			if err := json.Unmarshal(lines[0], &scoped); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal(lines[1], &unscoped); err != nil {
+				t.Fatal(err)
+			}
+			if id, _ := scoped["request_id"].(string); id != tt.requestID {
+				t.Errorf("request_id %q, want %q", id, tt.requestID)
+			}
+			if _, ok := unscoped["request_id"]; ok {
+				t.Error("the request ID leaked into the parent logger")
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"caaspay-api-go/api/config"
 	"caaspay-api-go/api/routes"
 	"fmt"
+	"strings"
 )
 
 type OpenAPISpec struct {
@@ -20,13 +21,40 @@ type Info struct {
 }
 
 type PathItem struct {
-	Get  *Operation `json:"get,omitempty"`
-	Post *Operation `json:"post,omitempty"`
+	Get     *Operation `json:"get,omitempty"`
+	Post    *Operation `json:"post,omitempty"`
+	Put     *Operation `json:"put,omitempty"`
+	Patch   *Operation `json:"patch,omitempty"`
+	Delete  *Operation `json:"delete,omitempty"`
+	Head    *Operation `json:"head,omitempty"`
+	Options *Operation `json:"options,omitempty"`
+}
+
+// setOperation assigns the operation to the field matching the HTTP method
+func (p *PathItem) setOperation(method string, operation *Operation) {
+	switch method {
+	case "GET":
+		p.Get = operation
+	case "POST":
+		p.Post = operation
+	case "PUT":
+		p.Put = operation
+	case "PATCH":
+		p.Patch = operation
+	case "DELETE":
+		p.Delete = operation
+	case "HEAD":
+		p.Head = operation
+	case "OPTIONS":
+		p.Options = operation
+	}
 }
 
 type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
 	Summary     string                `json:"summary"`
 	Description string                `json:"description"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
 	Parameters  []Parameter           `json:"parameters,omitempty"`
 	RequestBody *RequestBody          `json:"requestBody,omitempty"`
 	Responses   map[string]Response   `json:"responses"`
@@ -38,6 +66,8 @@ type Parameter struct {
 	In          string `json:"in"`
 	Description string `json:"description,omitempty"`
 	Required    bool   `json:"required"`
+	Style       string `json:"style,omitempty"`
+	Explode     *bool  `json:"explode,omitempty"`
 	Schema      Schema `json:"schema"`
 }
 
@@ -48,17 +78,36 @@ type RequestBody struct {
 }
 
 type MediaType struct {
-	Schema Schema `json:"schema"`
+	Schema  Schema      `json:"schema"`
+	Example interface{} `json:"example,omitempty"`
 }
 
 type Schema struct {
-	Type       string            `json:"type"`
-	Properties map[string]Schema `json:"properties,omitempty"`
+	Ref         string            `json:"$ref,omitempty"`
+	Type        string            `json:"type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Pattern     string            `json:"pattern,omitempty"`
+	Format      string            `json:"format,omitempty"`
+	Enum        []interface{}     `json:"enum,omitempty"`
+	Minimum     *float64          `json:"minimum,omitempty"`
+	Maximum     *float64          `json:"maximum,omitempty"`
+	MinLength   *int              `json:"minLength,omitempty"`
+	MaxLength   *int              `json:"maxLength,omitempty"`
+	Default     interface{}       `json:"default,omitempty"`
+	Properties  map[string]Schema `json:"properties,omitempty"`
+	Required    []string          `json:"required,omitempty"`
+	Items       *Schema           `json:"items,omitempty"`
 }
 
 type Response struct {
-	Description string      `json:"description"`
-	Content     interface{} `json:"content,omitempty"`
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema"`
 }
 
 type Components struct {
@@ -83,7 +132,7 @@ func GenerateOpenAPISpec(routeConfigs []routes.RouteConfig, cfg *config.Config)
 		},
 		Paths: make(map[string]PathItem),
 		Components: Components{
-			Schemas: make(map[string]interface{}),
+			Schemas: map[string]interface{}{"Problem": problemSchema()},
 			SecuritySchemes: map[string]SecurityScheme{
 				"BearerAuth": {
 					Type:         "http",
@@ -96,56 +145,97 @@ func GenerateOpenAPISpec(routeConfigs []routes.RouteConfig, cfg *config.Config)
 
 	// Process each route configuration
 	for _, route := range routeConfigs {
-		pathItem := PathItem{}
+		// Several methods may share a path, so extend the existing item
+		path := openAPIPath(route.Path)
+		pathItem := openAPISpec.Paths[path]
 		operation := Operation{
-			Summary:     fmt.Sprintf("Operation for %s", route.Path),
+			Summary:     fmt.Sprintf("%s %s", route.Type, path),
 			Description: route.Description,
 			Responses: map[string]Response{
 				"200": {
 					Description: "Successful response",
+					Headers:     responseHeaders(route),
+					Content:     responseContent(route),
+				},
+				"default": {
+					Description: "Error, as RFC 7807 problem details with a stable code",
+					Content: map[string]MediaType{
+						"application/problem+json": {Schema: Schema{Ref: "#/components/schemas/Problem"}},
+					},
 				},
 			},
 		}
 
-		// Add requestBody for POST with parameters
-		if route.Type == "POST" && len(route.Params) > 0 {
-			properties := make(map[string]Schema)
-			for _, param := range route.Params {
-				properties[param.Name] = Schema{Type: param.Type}
+		if route.ETag {
+			operation.Responses["304"] = Response{Description: "Not modified, the If-None-Match ETag is still current"}
+		}
+
+		// Versioned routes are grouped by version, retiring ones say when and what replaces them
+		if route.Version != "" {
+			operation.Tags = []string{route.Version}
+		}
+		operation.Deprecated = route.Deprecated
+		if route.Sunset != "" {
+			operation.Description = strings.TrimSpace(fmt.Sprintf("%s\n\nThis endpoint will be removed on %s.", operation.Description, route.Sunset))
+		}
+		if route.Successor != "" {
+			operation.Description = strings.TrimSpace(fmt.Sprintf("%s\n\nUse %s instead.", operation.Description, route.Successor))
+		}
+
+		// Body parameters form the requestBody, the others are documented where they are read from
+		var bodyParams []routes.ParamConfig
+		declared := map[string]bool{}
+		for _, param := range route.Params {
+			if param.In == "body" {
+				bodyParams = append(bodyParams, param)
+				continue
+			}
+			declared[param.Name] = true
+			parameter := Parameter{
+				Name:        param.Name,
+				In:          param.In,
+				Description: param.Description,
+				Required:    param.Required || param.In == "path",
+				Schema:      paramSchema(param),
 			}
+			// Arrays are documented as repeated keys unless only comma-separated values are accepted
+			if param.Type == "array" && param.In == "query" {
+				explode := param.Style != "comma"
+				parameter.Style, parameter.Explode = "form", &explode
+			}
+			operation.Parameters = append(operation.Parameters, parameter)
+		}
 
+		// Path segments without a declaration are still documented, as OpenAPI requires
+		for _, name := range routes.PathParams(route.Path) {
+			if !declared[name] {
+				operation.Parameters = append(operation.Parameters, Parameter{
+					Name:     name,
+					In:       "path",
+					Required: true,
+					Schema:   Schema{Type: "string"},
+				})
+			}
+		}
+
+		if len(bodyParams) > 0 {
+			// Routes with file params take a multipart form
+			mediaType := "application/json"
+			for _, param := range bodyParams {
+				if param.Type == "file" {
+					mediaType = "multipart/form-data"
+				}
+			}
 			requestBody := RequestBody{
 				Description: "Request body parameters",
 				Required:    true,
 				Content: map[string]MediaType{
-					"application/json": {
-						Schema: Schema{
-							Type:       "object",
-							Properties: properties,
-						},
+					mediaType: {
+						Schema: objectSchema(bodyParams),
 					},
 				},
 			}
 			operation.RequestBody = &requestBody
-		} else {
-			// For GET requests, use URL parameters
-			for _, param := range route.Params {
-				operation.Parameters = append(operation.Parameters, Parameter{
-					Name:        param.Name,
-					In:          "query",
-					Description: param.Description,
-					Required:    param.Required,
-					Schema:      Schema{Type: param.Type},
-				})
-			}
-		}
-
-		// Assign to correct HTTP method
-		switch route.Type {
-		case "GET":
-			pathItem.Get = &operation
-		case "POST":
-			pathItem.Post = &operation
 		}
 
 		// Apply security for routes requiring authorization
@@ -155,13 +245,244 @@ func GenerateOpenAPISpec(routeConfigs []routes.RouteConfig, cfg *config.Config)
 			}
 		}
 
-		openAPISpec.Paths[route.Path] = pathItem
+		// Assign to correct HTTP method
+		pathItem.setOperation(route.Type, &operation)
+
+		openAPISpec.Paths[path] = pathItem
 	}
 
 	addStaticRouteDocs(openAPISpec, cfg)
 	return openAPISpec, nil
 }
 
+// responseContent documents the response of a route in each of its formats. JSON is documented when
+// the response is projected, enveloped or mocked, with a static mock response as the example.
+func responseContent(route routes.RouteConfig) map[string]MediaType {
+	formats := route.Formats
+	if len(formats) == 0 {
+		formats = []string{"json"}
+	}
+	content := map[string]MediaType{}
+	for _, format := range formats {
+		switch format {
+		case "json":
+			if schema, ok := responseSchema(route); ok {
+				content["application/json"] = MediaType{Schema: schema, Example: routes.MockExample(route)}
+			}
+		case "msgpack":
+			schema, _ := responseSchema(route)
+			content["application/msgpack"] = MediaType{Schema: schema}
+		case "csv":
+			content["text/csv"] = MediaType{Schema: Schema{Type: "string", Description: csvDescription(route)}}
+		}
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	return content
+}
+
+// responseSchema documents the shaped response of a route, or reports that it is neither projected,
+// enveloped nor mocked
+func responseSchema(route routes.RouteConfig) (Schema, bool) {
+	response := route.ResponseStructure
+	enveloped := response.Envelope != nil && *response.Envelope
+	if len(response.Fields) == 0 && !enveloped && routes.MockExample(route) == nil {
+		return Schema{Type: "object"}, false
+	}
+
+	data := Schema{Type: "object"}
+	if len(response.Fields) > 0 {
+		data = objectSchema(response.Fields)
+	}
+	meta := Schema{Type: "object"}
+	if route.Pagination != nil {
+		item := data
+		data = Schema{Type: "array", Items: &item}
+		meta = Schema{
+			Type:       "object",
+			Properties: map[string]Schema{"pagination": paginationSchema(route.Pagination.Mode)},
+			Required:   []string{"pagination"},
+		}
+	}
+	if enveloped {
+		data = Schema{
+			Type: "object",
+			Properties: map[string]Schema{
+				"data":       data,
+				"request_id": {Type: "string"},
+				"meta":       meta,
+			},
+			Required: []string{"data", "request_id", "meta"},
+		}
+	}
+	return data, true
+}
+
+// csvDescription documents the columns of a CSV response
+func csvDescription(route routes.RouteConfig) string {
+	if route.CSV == nil || len(route.CSV.Columns) == 0 {
+		return "CSV with a header row; the columns are the fields of the rows"
+	}
+	headers := make([]string, len(route.CSV.Columns))
+	for i, column := range route.CSV.Columns {
+		headers[i] = column.Header
+		if headers[i] == "" {
+			headers[i] = column.Field
+		}
+	}
+	return "CSV with the header row: " + strings.Join(headers, ",")
+}
+
+// problemSchema documents the problem details of error responses
+func problemSchema() Schema {
+	return Schema{
+		Type: "object",
+		Properties: map[string]Schema{
+			"type":       {Type: "string", Description: "Link to the documentation of the error code"},
+			"title":      {Type: "string"},
+			"status":     {Type: "integer"},
+			"detail":     {Type: "string"},
+			"instance":   {Type: "string"},
+			"code":       {Type: "string", Description: "Stable machine-readable code, e.g. PARAM_MISSING or RATE_LIMITED"},
+			"request_id": {Type: "string"},
+			"error_id":   {Type: "string", Description: "Reference of the failure in the gateway logs"},
+			"errors": {
+				Type: "array",
+				Items: &Schema{
+					Type: "object",
+					Properties: map[string]Schema{
+						"field":   {Type: "string"},
+						"code":    {Type: "string"},
+						"message": {Type: "string"},
+					},
+				},
+			},
+		},
+		Required: []string{"type", "title", "status", "code"},
+	}
+}
+
+// responseHeaders documents the headers of a successful response, such as the Link header of pages
+func responseHeaders(route routes.RouteConfig) map[string]Header {
+	headers := map[string]Header{}
+	if route.Pagination != nil {
+		headers["Link"] = Header{Description: "RFC 8288 links to the next, previous, first and last pages", Schema: Schema{Type: "string"}}
+	}
+	if route.ETag {
+		headers["ETag"] = Header{Description: "Weak validator of the response content, to send back in If-None-Match", Schema: Schema{Type: "string"}}
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	return headers
+}
+
+// paginationSchema documents meta.pagination of a paginated route
+func paginationSchema(mode string) Schema {
+	schema := Schema{
+		Type: "object",
+		Properties: map[string]Schema{
+			"limit":    {Type: "integer"},
+			"has_more": {Type: "boolean"},
+			"total":    {Type: "integer", Description: "Present when the service reports it"},
+		},
+		Required: []string{"limit", "has_more"},
+	}
+	if mode == "cursor" {
+		schema.Properties["next_cursor"] = Schema{Type: "string", Description: "Cursor of the next page, null on the last page"}
+		schema.Required = append(schema.Required, "next_cursor")
+	} else {
+		schema.Properties["offset"] = Schema{Type: "integer"}
+		schema.Required = append(schema.Required, "offset")
+	}
+	return schema
+}
+
+// openAPIPath converts a Gin path (/users/:id, /files/*name) to OpenAPI form (/users/{id}, /files/{name})
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// openAPIFormats maps route param formats to their OpenAPI format names where they differ
+var openAPIFormats = map[string]string{
+	"currency": "iso-4217",
+	"country":  "iso-3166-alpha-2",
+}
+
+// paramSchema builds the schema for a route parameter, recursing into objects and arrays
+func paramSchema(param routes.ParamConfig) Schema {
+	schema := Schema{
+		Type:      param.Type,
+		Pattern:   param.Pattern,
+		Format:    param.Format,
+		Enum:      param.Enum,
+		Minimum:   param.Minimum,
+		Maximum:   param.Maximum,
+		MinLength: param.MinLength,
+		MaxLength: param.MaxLength,
+		Default:   param.Default,
+	}
+	if format, ok := openAPIFormats[param.Format]; ok {
+		schema.Format = format
+	}
+	switch param.Type {
+	case "decimal", "money":
+		// Exact decimals are exchanged as strings (JSON numbers are accepted on input)
+		schema.Type = "string"
+		schema.Format = param.Type
+		schema.Pattern = `^-?[0-9]+(\.[0-9]+)?$`
+		schema.Minimum, schema.Maximum = nil, nil
+		if param.Output == "minor_units" {
+			schema.Description = "Forwarded to the service as integer minor units"
+		}
+	case "file":
+		schema.Type = "string"
+		schema.Format = "binary"
+		schema.Description = fmt.Sprintf("Up to %d bytes", param.MaxSize)
+		if len(param.ContentTypes) > 0 {
+			schema.Description += ", of type " + strings.Join(param.ContentTypes, ", ")
+		}
+	case "object":
+		if len(param.Properties) > 0 {
+			schema = objectSchema(param.Properties)
+		}
+	case "array":
+		if param.Items != nil {
+			items := paramSchema(*param.Items)
+			schema.Items = &items
+		} else {
+			schema.Items = &Schema{}
+		}
+	}
+	return schema
+}
+
+// objectSchema builds an object schema from a list of parameters
+func objectSchema(params []routes.ParamConfig) Schema {
+	schema := Schema{
+		Type:       "object",
+		Properties: make(map[string]Schema, len(params)),
+	}
+	for _, param := range params {
+		property := paramSchema(param)
+		if param.Description != "" {
+			property.Description = param.Description
+		}
+		schema.Properties[param.Name] = property
+		if param.Required {
+			schema.Required = append(schema.Required, param.Name)
+		}
+	}
+	return schema
+}
+
 // Add documentation for static routes (health, status, JWT) if enabled in config.
 func addStaticRouteDocs(openAPISpec *OpenAPISpec, cfg *config.Config) {
 	if cfg.HealthRouteEnabled {
@@ -188,6 +509,67 @@ func addStaticRouteDocs(openAPISpec *OpenAPISpec, cfg *config.Config) {
 		}
 	}
 
+	if cfg.Webhooks.Enabled {
+		security := []map[string][]string{{"BearerAuth": {}}}
+		countParam := []Parameter{{
+			Name:        "count",
+			In:          "query",
+			Description: "Maximum number of entries to return (default 50, max 1000)",
+			Schema:      Schema{Type: "integer"},
+		}}
+
+		openAPISpec.Paths["/admin/webhooks/failed"] = PathItem{
+			Get: &Operation{
+				Summary:     "List failed webhook deliveries",
+				Description: "Deliveries that exhausted their retries, most recent first",
+				Parameters:  countParam,
+				Responses: map[string]Response{
+					"200": {Description: "Failed deliveries"},
+				},
+				Security: security,
+			},
+		}
+		openAPISpec.Paths["/admin/webhooks/attempts"] = PathItem{
+			Get: &Operation{
+				Summary:     "List webhook delivery attempts",
+				Description: "Recorded delivery attempts, most recent first",
+				Parameters:  countParam,
+				Responses: map[string]Response{
+					"200": {Description: "Delivery attempts"},
+				},
+				Security: security,
+			},
+		}
+		openAPISpec.Paths["/admin/webhooks/failed/{id}/replay"] = PathItem{
+			Post: &Operation{
+				Summary:     "Replay a failed webhook delivery",
+				Description: "Move a dead-lettered delivery back onto the events stream",
+				Parameters: []Parameter{{
+					Name:     "id",
+					In:       "path",
+					Required: true,
+					Schema:   Schema{Type: "string"},
+				}},
+				Responses: map[string]Response{
+					"202": {Description: "Delivery replayed"},
+					"404": {Description: "Delivery not found"},
+				},
+				Security: security,
+			},
+		}
+		openAPISpec.Paths["/admin/webhooks/replay"] = PathItem{
+			Post: &Operation{
+				Summary:     "Replay failed webhook deliveries",
+				Description: "Move up to `count` dead-lettered deliveries back onto the events stream, oldest first",
+				Parameters:  countParam,
+				Responses: map[string]Response{
+					"202": {Description: "Deliveries replayed"},
+				},
+				Security: security,
+			},
+		}
+	}
+
 	if cfg.SelfJWTEnabled {
 		openAPISpec.Paths["/jwt/login"] = PathItem{
 			Post: &Operation{
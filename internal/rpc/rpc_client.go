@@ -3,10 +3,14 @@ package rpc
 import (
 	"caaspay-api-go/internal/broker"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 )
 
+// ErrTimeout is returned when the service doesn't answer an RPC call in time
+var ErrTimeout = errors.New("rpc call timeout")
+
 // RPCClient handles sending and receiving RPC messages using a broker
 type RPCClient struct {
 	broker     broker.Broker
@@ -44,6 +48,11 @@ func (c *RPCClient) Start() error {
 // CallRPC sends an RPC message and waits for the response
 // func (c *RPCClient) CallRPC(service, method string, args map[string]interface{}, timeout time.Duration) (*RPCMessage, error) {
 func (c *RPCClient) CallRPC(service, method string, args map[string]interface{}, timeout ...time.Duration) (map[string]interface{}, error) {
+	return c.CallRPCWithRequestID(service, method, args, "", timeout...)
+}
+
+// CallRPCWithRequestID sends an RPC message carrying the gateway request ID and waits for the response
+func (c *RPCClient) CallRPCWithRequestID(service, method string, args map[string]interface{}, requestID string, timeout ...time.Duration) (map[string]interface{}, error) {
 	if !c.Subscribed {
 		return nil, fmt.Errorf("client is not subscribed to channel")
 	}
@@ -55,6 +64,9 @@ func (c *RPCClient) CallRPC(service, method string, args map[string]interface{},
 	}
 
 	request := NewRPCMessage(method, c.Whoami, args, effectiveTimeout)
+	if requestID != "" {
+		request.SetRequestID(requestID)
+	}
 	messageID := request.MessageID
 	respChan := make(chan *RPCMessage, 1)
 	c.pending[messageID] = respChan
@@ -72,7 +84,7 @@ func (c *RPCClient) CallRPC(service, method string, args map[string]interface{},
 		return resp.Response, nil // Return only the response field
 	case <-time.After(effectiveTimeout):
 		delete(c.pending, messageID)
-		return nil, fmt.Errorf("rpc call timeout")
+		return nil, ErrTimeout
 	}
 }
 
@@ -128,13 +128,28 @@ func (p *RPCClientPool) scaleDownClients() {
 }
 
 func (p *RPCClientPool) GetClient(timeout time.Duration) (*RPCClient, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if client := p.acquire(); client != nil {
+			return client, nil
+		}
+		// The lock is released while waiting, so calls in progress can return their clients
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timeout: no available clients")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// acquire returns a client with spare capacity, adding one when the pool can grow, or nil
+func (p *RPCClientPool) acquire() *RPCClient {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
 
 	for _, client := range p.clients {
 		if p.activeRequests[client] < p.maxRequestsPerClient {
 			p.activeRequests[client]++
-			return client, nil
+			return client
 		}
 	}
 
@@ -147,33 +162,10 @@ func (p *RPCClientPool) GetClient(timeout time.Duration) (*RPCClient, error) {
 				"metric_name":  "client_pool_scale_up",
 				"metric_value": fmt.Sprintf("%d", 1),
 			}, nil)
-			return newClient, nil
-		}
-	}
-
-	waitChan := make(chan *RPCClient)
-	go func() {
-		for {
-			time.Sleep(10 * time.Millisecond)
-			p.mutex.Lock()
-			for _, client := range p.clients {
-				if p.activeRequests[client] < p.maxRequestsPerClient {
-					p.activeRequests[client]++
-					p.mutex.Unlock()
-					waitChan <- client
-					return
-				}
-			}
-			p.mutex.Unlock()
+			return newClient
 		}
-	}()
-
-	select {
-	case client := <-waitChan:
-		return client, nil
-	case <-time.After(timeout):
-		return nil, fmt.Errorf("timeout: no available clients")
 	}
+	return nil
 }
 
 func (p *RPCClientPool) ReturnClient(client *RPCClient) {
@@ -185,6 +177,35 @@ func (p *RPCClientPool) ReturnClient(client *RPCClient) {
 	}
 }
 
+// ActiveRequests returns the number of calls holding a client
+func (p *RPCClientPool) ActiveRequests() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	active := 0
+	for _, requests := range p.activeRequests {
+		active += requests
+	}
+	return active
+}
+
+// Drain waits until every call in progress has returned its client, or the context is done.
+// It returns the number of calls still running.
+func (p *RPCClientPool) Drain(ctx context.Context) int {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		active := p.ActiveRequests()
+		if active == 0 {
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return active
+		}
+	}
+}
+
 func (p *RPCClientPool) ActiveClientCount() int {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	tests := []struct {
+		name        string
+		active      int
+		returnAfter time.Duration // 0 keeps the clients
+		timeout     time.Duration
+		want        int
+	}{
+		{name: "idle", timeout: time.Second},
+		{name: "calls finish", active: 2, returnAfter: 50 * time.Millisecond, timeout: time.Second},
+		{name: "calls still running", active: 2, timeout: 50 * time.Millisecond, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &RPCClient{}
+			pool := &RPCClientPool{clients: []*RPCClient{client}, activeRequests: map[*RPCClient]int{client: tt.active}}
+			if tt.returnAfter > 0 {
+				go func() {
+					time.Sleep(tt.returnAfter)
+					for i := 0; i < tt.active; i++ {
+						pool.ReturnClient(client)
+					}
+				}()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			if got := pool.Drain(ctx); got != tt.want {
+				t.Errorf("Drain returned %d calls running, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package rpc
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -35,6 +36,12 @@ func NewRPCMessage(rpc, who string, args map[string]interface{}, timeout time.Du
 	}
 }
 
+// SetRequestID records the gateway request ID in the stash and trace, so services log the same ID
+func (m *RPCMessage) SetRequestID(id string) {
+	m.Stash["request_id"] = id
+	m.Trace["request_id"] = id
+}
+
 // ToJSON serializes the RPC message to JSON
 func (m *RPCMessage) ToJSON() (string, error) {
 	jsonData, err := json.Marshal(m)
@@ -47,7 +54,7 @@ func (m *RPCMessage) ToJSON() (string, error) {
 // FromJSON deserializes a JSON string into an RPCMessage
 func FromJSON(jsonString string) (*RPCMessage, error) {
 	var msg RPCMessage
-	if err := json.Unmarshal([]byte(jsonString), &msg); err != nil {
+	if err := decodeJSON(jsonString, &msg); err != nil {
 		return nil, fmt.Errorf("failed to deserialize message: %w", err)
 	}
 
@@ -64,7 +71,7 @@ func FromJSON(jsonString string) (*RPCMessage, error) {
 func parseNestedJSON(field interface{}) (map[string]interface{}, error) {
 	if str, ok := field.(string); ok {
 		var nestedMap map[string]interface{}
-		if err := json.Unmarshal([]byte(str), &nestedMap); err != nil {
+		if err := decodeJSON(str, &nestedMap); err != nil {
 			return nil, fmt.Errorf("failed to parse nested JSON: %w", err)
 		}
 		return nestedMap, nil
@@ -106,12 +113,15 @@ func (m *RPCMessage) FromMap(data map[string]interface{}) {
 	if val, ok := data["deadline"].(int64); ok {
 		m.Deadline = val
 	}
+	if val, ok := data["deadline"].(json.Number); ok {
+		m.Deadline, _ = val.Int64()
+	}
 	if args, ok := data["args"].(map[string]interface{}); ok {
 		m.Args = args
 	}
 	if responseStr, ok := data["response"].(string); ok {
 		var response map[string]interface{}
-		if err := json.Unmarshal([]byte(responseStr), &response); err == nil {
+		if err := decodeJSON(responseStr, &response); err == nil {
 			m.Response = response
 		}
 	}
@@ -122,3 +132,11 @@ func (m *RPCMessage) FromMap(data map[string]interface{}) {
 		m.Trace = trace
 	}
 }
+
+// decodeJSON decodes JSON keeping numbers as json.Number, so amounts and IDs in
+// service responses keep their exact precision when passed back to clients
+func decodeJSON(data string, target interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSetRequestID(t *testing.T) {
+	message := NewRPCMessage("payment.get", "gateway", map[string]interface{}{"id": "pay_1"}, time.Second)
+	message.SetRequestID("req-1")
+
+	serialized, err := message.ToJSON()
+	if err != nil {
+		t.Fatalf("ToJSON failed: %v", err)
+	}
+	var decoded struct {
+		Stash map[string]interface{} `json:"stash"`
+		Trace map[string]interface{} `json:"trace"`
+	}
+	if err := json.Unmarshal([]byte(serialized), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Stash["request_id"] != "req-1" || decoded.Trace["request_id"] != "req-1" {
+		t.Errorf("stash %v, trace %v, want request_id req-1 in both", decoded.Stash, decoded.Trace)
+	}
+}
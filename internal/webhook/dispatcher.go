@@ -0,0 +1,620 @@
+package webhook
+
+import (
+	"bytes"
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrNotFound is returned when a dead-lettered delivery does not exist
+var ErrNotFound = errors.New("delivery not found")
+
+// Delivery is a webhook event as stored in the events or dead-letter stream.
+//
+// Producers add events to the configured stream with the fields
+// merchant_id, event, payload (JSON) and optionally event_id and url.
+type Delivery struct {
+	ID         string          `json:"id"`
+	EventID    string          `json:"event_id"`
+	MerchantID string          `json:"merchant_id"`
+	Event      string          `json:"event"`
+	URL        string          `json:"url,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+	Attempts   int             `json:"attempts,omitempty"`
+	LastError  string          `json:"last_error,omitempty"`
+	FailedAt   string          `json:"failed_at,omitempty"`
+	SourceID   string          `json:"source_id,omitempty"`
+}
+
+// Attempt is a single recorded delivery attempt
+type Attempt struct {
+	ID         string `json:"id"`
+	DeliveryID string `json:"delivery_id"`
+	EventID    string `json:"event_id"`
+	MerchantID string `json:"merchant_id"`
+	URL        string `json:"url"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"status_code"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	At         string `json:"at"`
+}
+
+// permanentError marks a failure that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+
+// Fields added to a message when it is moved to the dead-letter stream
+var deadLetterFields = []string{"attempts", "last_error", "failed_at", "source_id"}
+
+// How long a replay is remembered, so replaying the same dead letter again doesn't re-enqueue it
+const replayedTTL = 7 * 24 * time.Hour
+
+// Broker is the part of the Redis broker the dispatcher uses
+type Broker interface {
+	XGroupCreate(ctx context.Context, stream, group, startID string) error
+	XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration, startID string) ([]redis.XStream, error)
+	XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error)
+	XAck(ctx context.Context, stream, group string, messageIDs ...string) (int64, error)
+	XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error)
+	XTrim(ctx context.Context, stream string, maxLen int64) error
+	XRange(ctx context.Context, stream, start, end string, count int64) ([]redis.XMessage, error)
+	XRevRange(ctx context.Context, stream, end, start string, count int64) ([]redis.XMessage, error)
+	XDel(ctx context.Context, stream string, messageIDs ...string) (int64, error)
+	HGet(ctx context.Context, key, field string) (string, error)
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
+	ZAdd(ctx context.Context, key string, score float64, member string) error
+	ZRangeByScore(ctx context.Context, key string, max float64, count int64) ([]string, error)
+	ZRem(ctx context.Context, key, member string) (bool, error)
+}
+
+// Dispatcher consumes webhook events from a Redis stream and delivers them to merchant endpoints
+type Dispatcher struct {
+	broker  Broker
+	cfg     config.WebhookConfig
+	secrets map[string]string // Static secrets by merchant ID
+	client  *http.Client
+	logger  *logging.Logger
+	wg      sync.WaitGroup
+}
+
+// NewDispatcher creates a new webhook dispatcher using the provided broker
+func NewDispatcher(broker Broker, cfg config.WebhookConfig, logger *logging.Logger) *Dispatcher {
+	secrets := make(map[string]string, len(cfg.Secrets))
+	for _, secret := range cfg.Secrets {
+		secrets[secret.MerchantID] = secret.Secret
+	}
+	return &Dispatcher{
+		broker:  broker,
+		cfg:     cfg,
+		secrets: secrets,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		logger:  logger,
+	}
+}
+
+// Start creates the consumer group and launches the delivery workers and the retry scheduler.
+// They stop when ctx is cancelled; use Wait to block until they have exited.
+func (d *Dispatcher) Start(ctx context.Context) error {
+	if err := d.broker.XGroupCreate(ctx, d.cfg.Stream, d.cfg.Group, "0"); err != nil {
+		return err
+	}
+
+	for i := 0; i < d.cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker(ctx, fmt.Sprintf("%s-%d", d.cfg.Consumer, i))
+	}
+	d.wg.Add(1)
+	go d.schedule(ctx)
+
+	d.logger.LogWithStats("info", "Webhook dispatcher started", map[string]string{
+		"metric_name": "webhook_dispatcher_start",
+		"stream":      d.cfg.Stream,
+		"workers":     fmt.Sprintf("%d", d.cfg.Workers),
+	}, nil)
+	return nil
+}
+
+// Wait blocks until all workers and the retry scheduler have exited
+func (d *Dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// worker reads events for a single consumer until the context is cancelled
+func (d *Dispatcher) worker(ctx context.Context, consumer string) {
+	defer d.wg.Done()
+
+	// Pick up messages this consumer read but never acknowledged before a restart,
+	// then switch to new messages only
+	startID := "0"
+	nextClaim := time.Now()
+	for ctx.Err() == nil {
+		if time.Now().After(nextClaim) {
+			d.reclaim(ctx, consumer)
+			nextClaim = time.Now().Add(d.cfg.ClaimIdle / 2)
+		}
+
+		streams, err := d.broker.XReadGroup(ctx, d.cfg.Stream, d.cfg.Group, consumer, 10, 5*time.Second, startID)
+		if err != nil {
+			if errors.Is(err, redis.Nil) || ctx.Err() != nil {
+				continue
+			}
+			d.logger.LogWithStats("error", "Failed to read webhook stream", map[string]string{
+				"metric_name": "webhook_read_error",
+			}, map[string]interface{}{"consumer": consumer, "error": err.Error()})
+			sleep(ctx, time.Second)
+			continue
+		}
+
+		received := 0
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				received++
+				d.process(ctx, consumer, msg)
+			}
+		}
+		if startID == "0" && received == 0 {
+			startID = ">"
+		}
+	}
+}
+
+// reclaim takes over the deliveries other consumers left pending for claim_idle, e.g. those of a
+// replaced instance, and processes them
+func (d *Dispatcher) reclaim(ctx context.Context, consumer string) {
+	start := "0-0"
+	for ctx.Err() == nil {
+		messages, next, err := d.broker.XAutoClaim(ctx, d.cfg.Stream, d.cfg.Group, consumer, d.cfg.ClaimIdle, start, 10)
+		if err != nil {
+			d.logger.LogWithStats("error", "Failed to reclaim pending webhooks", map[string]string{
+				"metric_name": "webhook_claim_error",
+			}, map[string]interface{}{"consumer": consumer, "error": err.Error()})
+			return
+		}
+		for _, msg := range messages {
+			d.logger.LogWithStats("info", "Reclaimed pending webhook", map[string]string{
+				"metric_name": "webhook_reclaimed",
+			}, map[string]interface{}{"delivery_id": msg.ID, "consumer": consumer})
+			d.process(ctx, consumer, msg)
+		}
+		if next == "0-0" || next == "" {
+			return
+		}
+		start = next
+	}
+}
+
+// process makes one delivery attempt and acknowledges the message once it was delivered, scheduled
+// for a retry or dead-lettered, so a failing endpoint never holds up the worker
+func (d *Dispatcher) process(ctx context.Context, consumer string, msg redis.XMessage) {
+	delivery := deliveryFromMessage(msg)
+
+	deliveryErr := d.deliver(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down, leave the message pending so this or another instance reclaims it
+		return
+	}
+
+	var permanent *permanentError
+	switch {
+	case deliveryErr == nil:
+	case !errors.As(deliveryErr, &permanent) && delivery.Attempts < d.cfg.MaxAttempts:
+		if err := d.scheduleRetry(ctx, msg, delivery); err != nil {
+			d.logger.LogWithStats("error", "Failed to schedule webhook retry", map[string]string{
+				"metric_name": "webhook_retry_error",
+			}, map[string]interface{}{"delivery_id": delivery.ID, "error": err.Error()})
+			return
+		}
+	default:
+		if err := d.deadLetter(ctx, msg, delivery, deliveryErr); err != nil {
+			d.logger.LogWithStats("error", "Failed to dead-letter webhook", map[string]string{
+				"metric_name": "webhook_dead_letter_error",
+			}, map[string]interface{}{"delivery_id": delivery.ID, "error": err.Error()})
+			return
+		}
+	}
+
+	if _, err := d.broker.XAck(ctx, d.cfg.Stream, d.cfg.Group, msg.ID); err != nil {
+		d.logger.LogWithStats("error", "Failed to acknowledge webhook", map[string]string{
+			"metric_name": "webhook_ack_error",
+		}, map[string]interface{}{"delivery_id": delivery.ID, "error": err.Error()})
+	}
+}
+
+// deliver makes the next delivery attempt and counts it in delivery.Attempts
+func (d *Dispatcher) deliver(ctx context.Context, delivery *Delivery) error {
+	delivery.Attempts++
+	url, secret, err := d.resolveEndpoint(ctx, delivery)
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	delivery.URL = url
+	return d.attempt(ctx, delivery, secret)
+}
+
+// scheduleRetry stores a failed delivery in the retries sorted set, scored by the time its next
+// attempt is due. The backoff doubles after each attempt up to max_backoff.
+func (d *Dispatcher) scheduleRetry(ctx context.Context, msg redis.XMessage, delivery *Delivery) error {
+	values := make(map[string]string, len(msg.Values)+2)
+	for key := range msg.Values {
+		values[key] = stringValue(msg.Values, key)
+	}
+	values["event_id"] = delivery.EventID
+	values["attempts"] = strconv.Itoa(delivery.Attempts)
+	member, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+
+	backoff := d.cfg.InitialBackoff
+	for i := 1; i < delivery.Attempts && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	due := time.Now().Add(min(backoff, d.cfg.MaxBackoff))
+	return d.broker.ZAdd(ctx, d.cfg.RetriesKey, float64(due.UnixMilli()), string(member))
+}
+
+// schedule moves due retries back onto the events stream every second until ctx is cancelled
+func (d *Dispatcher) schedule(ctx context.Context) {
+	defer d.wg.Done()
+	for sleep(ctx, time.Second) {
+		d.promoteRetries(ctx, time.Now())
+	}
+}
+
+// promoteRetries re-enqueues the retries due at now. Every instance runs it; the one whose ZREM
+// removes a retry re-enqueues it, so it is delivered once.
+func (d *Dispatcher) promoteRetries(ctx context.Context, now time.Time) {
+	const batch = 100
+	for ctx.Err() == nil {
+		members, err := d.broker.ZRangeByScore(ctx, d.cfg.RetriesKey, float64(now.UnixMilli()), batch)
+		if err != nil {
+			d.logger.LogWithStats("error", "Failed to read webhook retries", map[string]string{
+				"metric_name": "webhook_retry_error",
+			}, map[string]interface{}{"error": err.Error()})
+			return
+		}
+
+		for _, member := range members {
+			if removed, err := d.broker.ZRem(ctx, d.cfg.RetriesKey, member); err != nil || !removed {
+				continue
+			}
+			var fields map[string]string
+			if err := json.Unmarshal([]byte(member), &fields); err != nil {
+				d.logger.LogWithStats("error", "Dropped malformed webhook retry", map[string]string{
+					"metric_name": "webhook_retry_error",
+				}, map[string]interface{}{"retry": member, "error": err.Error()})
+				continue
+			}
+			values := make(map[string]interface{}, len(fields))
+			for key, value := range fields {
+				values[key] = value
+			}
+			if _, err := d.broker.XAdd(ctx, d.cfg.Stream, values); err != nil {
+				// Put it back so the next run retries it
+				d.broker.ZAdd(ctx, d.cfg.RetriesKey, float64(now.UnixMilli()), member)
+				d.logger.LogWithStats("error", "Failed to re-enqueue webhook retry", map[string]string{
+					"metric_name": "webhook_retry_error",
+				}, map[string]interface{}{"event_id": fields["event_id"], "error": err.Error()})
+				return
+			}
+		}
+		if len(members) < batch {
+			return
+		}
+	}
+}
+
+// attempt performs a single signed POST and records its outcome
+func (d *Dispatcher) attempt(ctx context.Context, delivery *Delivery, secret string) error {
+	timestamp := time.Now().Unix()
+	body, err := json.Marshal(map[string]interface{}{
+		"id":          delivery.EventID,
+		"type":        delivery.Event,
+		"merchant_id": delivery.MerchantID,
+		"created":     timestamp,
+		"data":        delivery.Payload,
+	})
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("failed to encode payload: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: fmt.Errorf("invalid webhook url: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "CaasPay-Webhooks/1.0")
+	req.Header.Set("X-CaasPay-Event", delivery.Event)
+	req.Header.Set("X-CaasPay-Delivery", delivery.ID)
+	req.Header.Set(d.cfg.SignatureHeader, Sign(secret, timestamp, body))
+
+	start := time.Now()
+	statusCode := 0
+	resp, err := d.client.Do(req)
+	if err == nil {
+		statusCode = resp.StatusCode
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if statusCode < 200 || statusCode >= 300 {
+			err = fmt.Errorf("endpoint responded with status %d", statusCode)
+		}
+	}
+
+	d.recordAttempt(ctx, delivery, statusCode, time.Since(start), err)
+	return err
+}
+
+// resolveEndpoint finds the target URL and signing secret for the delivery's merchant
+func (d *Dispatcher) resolveEndpoint(ctx context.Context, delivery *Delivery) (string, string, error) {
+	if delivery.MerchantID == "" {
+		return "", "", errors.New("event has no merchant_id")
+	}
+
+	url := delivery.URL
+	if url == "" {
+		endpoint, err := d.broker.HGet(ctx, d.cfg.EndpointsKey, delivery.MerchantID)
+		if err != nil {
+			return "", "", fmt.Errorf("no webhook url for merchant %s", delivery.MerchantID)
+		}
+		url = endpoint
+	}
+
+	secret, ok := d.secrets[delivery.MerchantID]
+	if !ok {
+		stored, err := d.broker.HGet(ctx, d.cfg.SecretsKey, delivery.MerchantID)
+		if err != nil || stored == "" {
+			return "", "", fmt.Errorf("no signing secret for merchant %s", delivery.MerchantID)
+		}
+		secret = stored
+	}
+
+	return url, secret, nil
+}
+
+// recordAttempt appends the attempt to the attempts stream and emits a metric
+func (d *Dispatcher) recordAttempt(ctx context.Context, delivery *Delivery, statusCode int, duration time.Duration, err error) {
+	outcome := "success"
+	errMsg := ""
+	if err != nil {
+		outcome = "failure"
+		errMsg = err.Error()
+	}
+
+	record := map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"event_id":    delivery.EventID,
+		"merchant_id": delivery.MerchantID,
+		"url":         delivery.URL,
+		"attempt":     strconv.Itoa(delivery.Attempts),
+		"status_code": strconv.Itoa(statusCode),
+		"duration_ms": strconv.FormatInt(duration.Milliseconds(), 10),
+		"error":       errMsg,
+		"at":          time.Now().UTC().Format(time.RFC3339),
+	}
+	if _, xerr := d.broker.XAdd(ctx, d.cfg.AttemptsStream, record); xerr == nil {
+		d.broker.XTrim(ctx, d.cfg.AttemptsStream, d.cfg.AttemptsMaxLen)
+	}
+
+	d.logger.LogWithStats("info", "Webhook delivery attempt", map[string]string{
+		"metric_name": "webhook_delivery_attempt",
+		"outcome":     outcome,
+		"status_code": strconv.Itoa(statusCode),
+	}, map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"merchant_id": delivery.MerchantID,
+		"attempt":     delivery.Attempts,
+		"error":       errMsg,
+	})
+}
+
+// deadLetter copies the original message to the dead-letter stream with failure details
+func (d *Dispatcher) deadLetter(ctx context.Context, msg redis.XMessage, delivery *Delivery, cause error) error {
+	values := make(map[string]interface{}, len(msg.Values)+len(deadLetterFields))
+	for key, value := range msg.Values {
+		values[key] = value
+	}
+	values["attempts"] = strconv.Itoa(delivery.Attempts)
+	values["last_error"] = cause.Error()
+	values["failed_at"] = time.Now().UTC().Format(time.RFC3339)
+	values["source_id"] = msg.ID
+
+	if _, err := d.broker.XAdd(ctx, d.cfg.DeadLetterStream, values); err != nil {
+		return err
+	}
+
+	d.logger.LogWithStats("warn", "Webhook moved to dead-letter stream", map[string]string{
+		"metric_name": "webhook_dead_lettered",
+	}, map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"merchant_id": delivery.MerchantID,
+		"attempts":    delivery.Attempts,
+		"error":       cause.Error(),
+	})
+	return nil
+}
+
+// ListFailed returns up to count dead-lettered deliveries, most recent first
+func (d *Dispatcher) ListFailed(ctx context.Context, count int64) ([]*Delivery, error) {
+	messages, err := d.broker.XRevRange(ctx, d.cfg.DeadLetterStream, "+", "-", count)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*Delivery, 0, len(messages))
+	for _, msg := range messages {
+		deliveries = append(deliveries, deliveryFromMessage(msg))
+	}
+	return deliveries, nil
+}
+
+// ListAttempts returns up to count recorded delivery attempts, most recent first
+func (d *Dispatcher) ListAttempts(ctx context.Context, count int64) ([]*Attempt, error) {
+	messages, err := d.broker.XRevRange(ctx, d.cfg.AttemptsStream, "+", "-", count)
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := make([]*Attempt, 0, len(messages))
+	for _, msg := range messages {
+		attempt, _ := strconv.Atoi(stringValue(msg.Values, "attempt"))
+		statusCode, _ := strconv.Atoi(stringValue(msg.Values, "status_code"))
+		durationMs, _ := strconv.ParseInt(stringValue(msg.Values, "duration_ms"), 10, 64)
+		attempts = append(attempts, &Attempt{
+			ID:         msg.ID,
+			DeliveryID: stringValue(msg.Values, "delivery_id"),
+			EventID:    stringValue(msg.Values, "event_id"),
+			MerchantID: stringValue(msg.Values, "merchant_id"),
+			URL:        stringValue(msg.Values, "url"),
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			DurationMs: durationMs,
+			Error:      stringValue(msg.Values, "error"),
+			At:         stringValue(msg.Values, "at"),
+		})
+	}
+	return attempts, nil
+}
+
+// Replay moves a dead-lettered delivery back onto the events stream and returns its new message ID.
+// The original event ID is kept so merchants can deduplicate. The two streams may live on different
+// cluster nodes, so the move can't be a transaction. Instead the new message ID is recorded under
+// replayed_key before the dead letter is removed, and replaying a recorded dead letter only retries
+// the removal, so a failed removal can be retried without delivering the event twice.
+func (d *Dispatcher) Replay(ctx context.Context, id string) (string, error) {
+	replayedKey := d.cfg.ReplayedKey + ":" + id
+	if newID, err := d.broker.Get(ctx, replayedKey); err == nil && newID != "" {
+		if _, err := d.broker.XDel(ctx, d.cfg.DeadLetterStream, id); err != nil {
+			return "", fmt.Errorf("failed to remove replayed dead letter: %w", err)
+		}
+		return newID, nil
+	}
+
+	messages, err := d.broker.XRange(ctx, d.cfg.DeadLetterStream, id, id, 1)
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", ErrNotFound
+	}
+	msg := messages[0]
+
+	values := make(map[string]interface{}, len(msg.Values))
+	for key, value := range msg.Values {
+		values[key] = value
+	}
+	if stringValue(values, "event_id") == "" {
+		values["event_id"] = stringValue(values, "source_id")
+	}
+	for _, field := range deadLetterFields {
+		delete(values, field)
+	}
+
+	newID, err := d.broker.XAdd(ctx, d.cfg.Stream, values)
+	if err != nil {
+		return "", err
+	}
+	if err := d.broker.Set(ctx, replayedKey, newID, replayedTTL); err != nil {
+		d.logger.LogWithStats("error", "Failed to record webhook replay", map[string]string{
+			"metric_name": "webhook_replay_error",
+		}, map[string]interface{}{"dead_letter_id": msg.ID, "message_id": newID, "error": err.Error()})
+	}
+	if _, err := d.broker.XDel(ctx, d.cfg.DeadLetterStream, msg.ID); err != nil {
+		return "", fmt.Errorf("replayed as %s but failed to remove the dead letter: %w", newID, err)
+	}
+
+	d.logger.LogWithStats("info", "Webhook replayed", map[string]string{
+		"metric_name": "webhook_replayed",
+	}, map[string]interface{}{"dead_letter_id": msg.ID, "message_id": newID})
+	return newID, nil
+}
+
+// ReplayAll replays up to count dead-lettered deliveries, oldest first, and returns the replayed IDs.
+// On failure it returns the IDs replayed before it along with the error, which counts them.
+func (d *Dispatcher) ReplayAll(ctx context.Context, count int64) ([]string, error) {
+	messages, err := d.broker.XRange(ctx, d.cfg.DeadLetterStream, "-", "+", count)
+	if err != nil {
+		return nil, err
+	}
+
+	replayed := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if _, err := d.Replay(ctx, msg.ID); err != nil {
+			return replayed, fmt.Errorf("replayed %d of %d deliveries, %s failed: %w", len(replayed), len(messages), msg.ID, err)
+		}
+		replayed = append(replayed, msg.ID)
+	}
+	return replayed, nil
+}
+
+// Sign computes the signature header value for a webhook body.
+// Receivers verify it by computing HMAC-SHA256 over "<timestamp>.<body>" with their secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// deliveryFromMessage builds a Delivery from a raw stream message
+func deliveryFromMessage(msg redis.XMessage) *Delivery {
+	delivery := &Delivery{
+		ID:         msg.ID,
+		EventID:    stringValue(msg.Values, "event_id"),
+		MerchantID: stringValue(msg.Values, "merchant_id"),
+		Event:      stringValue(msg.Values, "event"),
+		URL:        stringValue(msg.Values, "url"),
+		LastError:  stringValue(msg.Values, "last_error"),
+		FailedAt:   stringValue(msg.Values, "failed_at"),
+		SourceID:   stringValue(msg.Values, "source_id"),
+	}
+	if delivery.EventID == "" {
+		delivery.EventID = msg.ID
+	}
+	delivery.Attempts, _ = strconv.Atoi(stringValue(msg.Values, "attempts"))
+
+	// Payloads are stored as JSON; anything else is forwarded as a JSON string
+	payload := stringValue(msg.Values, "payload")
+	if json.Valid([]byte(payload)) {
+		delivery.Payload = json.RawMessage(payload)
+	} else if payload != "" {
+		delivery.Payload, _ = json.Marshal(payload)
+	}
+	return delivery
+}
+
+// stringValue reads a field from stream message values
+func stringValue(values map[string]interface{}, key string) string {
+	if value, ok := values[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+// sleep waits for the duration and reports false if the context was cancelled first
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(duration):
+		return true
+	}
+}
@@ -0,0 +1,377 @@
+package webhook
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeBroker keeps streams, hashes and sorted sets in memory
+type fakeBroker struct {
+	nextID  int
+	streams map[string][]redis.XMessage
+	acked   []string
+	hashes  map[string]map[string]string
+	zsets   map[string]map[string]float64
+	values  map[string]string
+	xaddErr error // Returned by XAdd to the events stream once xaddOK adds succeeded
+	xaddOK  int
+	xdelErr error
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		streams: map[string][]redis.XMessage{},
+		hashes:  map[string]map[string]string{},
+		zsets:   map[string]map[string]float64{},
+		values:  map[string]string{},
+	}
+}
+
+func (b *fakeBroker) XGroupCreate(ctx context.Context, stream, group, startID string) error {
+	return nil
+}
+
+func (b *fakeBroker) XReadGroup(ctx context.Context, stream, group, consumer string, count int64, block time.Duration, startID string) ([]redis.XStream, error) {
+	return nil, redis.Nil
+}
+
+func (b *fakeBroker) XAutoClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, start string, count int64) ([]redis.XMessage, string, error) {
+	return nil, "0-0", nil
+}
+
+func (b *fakeBroker) XAck(ctx context.Context, stream, group string, messageIDs ...string) (int64, error) {
+	b.acked = append(b.acked, messageIDs...)
+	return int64(len(messageIDs)), nil
+}
+
+func (b *fakeBroker) XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error) {
+	if b.xaddErr != nil && stream == "webhook.events" {
+		if b.xaddOK == 0 {
+			return "", b.xaddErr
+		}
+		b.xaddOK--
+	}
+	b.nextID++
+	id := fmt.Sprintf("%d-0", b.nextID)
+	b.streams[stream] = append(b.streams[stream], redis.XMessage{ID: id, Values: values})
+	return id, nil
+}
+
+func (b *fakeBroker) XTrim(ctx context.Context, stream string, maxLen int64) error {
+	return nil
+}
+
+func (b *fakeBroker) XRange(ctx context.Context, stream, start, end string, count int64) ([]redis.XMessage, error) {
+	var messages []redis.XMessage
+	for _, msg := range b.streams[stream] {
+		if (start == "-" || msg.ID == start) && int64(len(messages)) < count {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func (b *fakeBroker) XRevRange(ctx context.Context, stream, end, start string, count int64) ([]redis.XMessage, error) {
+	messages, _ := b.XRange(ctx, stream, "-", "+", int64(len(b.streams[stream])))
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages[:min(int64(len(messages)), count)], nil
+}
+
+func (b *fakeBroker) XDel(ctx context.Context, stream string, messageIDs ...string) (int64, error) {
+	if b.xdelErr != nil {
+		return 0, b.xdelErr
+	}
+	var kept []redis.XMessage
+	for _, msg := range b.streams[stream] {
+		if !slices.Contains(messageIDs, msg.ID) {
+			kept = append(kept, msg)
+		}
+	}
+	deleted := len(b.streams[stream]) - len(kept)
+	b.streams[stream] = kept
+	return int64(deleted), nil
+}
+
+func (b *fakeBroker) HGet(ctx context.Context, key, field string) (string, error) {
+	if value, ok := b.hashes[key][field]; ok {
+		return value, nil
+	}
+	return "", redis.Nil
+}
+
+func (b *fakeBroker) Get(ctx context.Context, key string) (string, error) {
+	if value, ok := b.values[key]; ok {
+		return value, nil
+	}
+	return "", redis.Nil
+}
+
+func (b *fakeBroker) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	b.values[key] = fmt.Sprint(value)
+	return nil
+}
+
+func (b *fakeBroker) ZAdd(ctx context.Context, key string, score float64, member string) error {
+	if b.zsets[key] == nil {
+		b.zsets[key] = map[string]float64{}
+	}
+	b.zsets[key][member] = score
+	return nil
+}
+
+func (b *fakeBroker) ZRangeByScore(ctx context.Context, key string, max float64, count int64) ([]string, error) {
+	var members []string
+	for member, score := range b.zsets[key] {
+		if score <= max && int64(len(members)) < count {
+			members = append(members, member)
+		}
+	}
+	return members, nil
+}
+
+func (b *fakeBroker) ZRem(ctx context.Context, key, member string) (bool, error) {
+	if _, ok := b.zsets[key][member]; !ok {
+		return false, nil
+	}
+	delete(b.zsets[key], member)
+	return true, nil
+}
+
+// newTestDispatcher creates a dispatcher with the default webhook settings on a fake broker
+func newTestDispatcher(t *testing.T) (*Dispatcher, *fakeBroker) {
+	t.Helper()
+	cfg := config.WebhookConfig{
+		Stream:           "webhook.events",
+		Group:            "api-webhooks",
+		DeadLetterStream: "webhook.dead_letter",
+		AttemptsStream:   "webhook.attempts",
+		RetriesKey:       "webhook.retries",
+		ReplayedKey:      "webhook.replayed",
+		MaxAttempts:      4,
+		InitialBackoff:   time.Second,
+		MaxBackoff:       4 * time.Second,
+		Timeout:          time.Second,
+		SignatureHeader:  "X-CaasPay-Signature",
+		Secrets:          []config.WebhookSecret{{MerchantID: "MERCHANT-1", Secret: "whsec_test"}},
+	}
+	fake := newFakeBroker()
+	logger := logging.NewLogger("test", "test", "panic", false, nil, context.Background())
+	return NewDispatcher(fake, cfg, logger), fake
+}
+
+func TestSign(t *testing.T) {
+	got := Sign("whsec_test", 1700000000, []byte(`{"id":"evt_1"}`))
+	want := "t=1700000000,v1=c89214b5b5da833daed6f0b8c5bb6bd58cea9022bd80ccc78230f3942d632925"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name           string
+		merchantID     string
+		attempts       string // Attempts made before this one
+		status         int
+		wantCalled     bool
+		wantRetry      time.Duration // Backoff of the scheduled retry, 0 for none
+		wantDeadLetter bool
+	}{
+		{name: "delivered", merchantID: "MERCHANT-1", status: http.StatusOK, wantCalled: true},
+		{name: "transient failure is retried", merchantID: "MERCHANT-1", status: http.StatusServiceUnavailable, wantCalled: true, wantRetry: time.Second},
+		{name: "backoff doubles", merchantID: "MERCHANT-1", attempts: "1", status: http.StatusInternalServerError, wantCalled: true, wantRetry: 2 * time.Second},
+		{name: "backoff is capped", merchantID: "MERCHANT-1", attempts: "2", status: http.StatusInternalServerError, wantCalled: true, wantRetry: 4 * time.Second},
+		{name: "last attempt is dead-lettered", merchantID: "MERCHANT-1", attempts: "3", status: http.StatusInternalServerError, wantCalled: true, wantDeadLetter: true},
+		{name: "missing secret is permanent", merchantID: "MERCHANT-2", wantDeadLetter: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				body, _ := io.ReadAll(r.Body)
+				timestamp, _ := strconv.ParseInt(strings.TrimPrefix(strings.Split(r.Header.Get("X-CaasPay-Signature"), ",")[0], "t="), 10, 64)
+				if want := Sign("whsec_test", timestamp, body); r.Header.Get("X-CaasPay-Signature") != want {
+					t.Errorf("signature %q, want %q", r.Header.Get("X-CaasPay-Signature"), want)
+				}
+				if r.Header.Get("X-CaasPay-Event") != "payment.succeeded" || r.Header.Get("X-CaasPay-Delivery") != "7-0" {
+					t.Errorf("event headers %q and %q", r.Header.Get("X-CaasPay-Event"), r.Header.Get("X-CaasPay-Delivery"))
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			d, fake := newTestDispatcher(t)
+			values := map[string]interface{}{"merchant_id": tt.merchantID, "event": "payment.succeeded", "event_id": "evt_1", "url": server.URL, "payload": `{"amount":"10.00"}`}
+			if tt.attempts != "" {
+				values["attempts"] = tt.attempts
+			}
+			before := time.Now()
+			d.process(context.Background(), "test-0", redis.XMessage{ID: "7-0", Values: values})
+
+			if called != tt.wantCalled {
+				t.Errorf("endpoint called = %v, want %v", called, tt.wantCalled)
+			}
+			if len(fake.acked) != 1 || fake.acked[0] != "7-0" {
+				t.Errorf("acked %v, want the message acknowledged", fake.acked)
+			}
+
+			retries := fake.zsets["webhook.retries"]
+			if tt.wantRetry == 0 && len(retries) != 0 {
+				t.Errorf("scheduled %v, want no retry", retries)
+			}
+			if tt.wantRetry != 0 {
+				if len(retries) != 1 {
+					t.Fatalf("scheduled %v, want one retry", retries)
+				}
+				for member, score := range retries {
+					due := time.UnixMilli(int64(score))
+					if due.Before(before.Add(tt.wantRetry-time.Millisecond)) || due.After(time.Now().Add(tt.wantRetry)) {
+						t.Errorf("retry due in %s, want %s", due.Sub(before), tt.wantRetry)
+					}
+					var fields map[string]string
+					json.Unmarshal([]byte(member), &fields)
+					attempts, _ := strconv.Atoi(tt.attempts)
+					if fields["attempts"] != strconv.Itoa(attempts+1) || fields["event_id"] != "evt_1" || fields["url"] != server.URL {
+						t.Errorf("retry %v, want the event with attempts %d", fields, attempts+1)
+					}
+				}
+			}
+
+			deadLetters := fake.streams["webhook.dead_letter"]
+			if tt.wantDeadLetter != (len(deadLetters) == 1) {
+				t.Fatalf("dead letters %v, want dead-lettered %v", deadLetters, tt.wantDeadLetter)
+			}
+			if tt.wantDeadLetter && (stringValue(deadLetters[0].Values, "source_id") != "7-0" || stringValue(deadLetters[0].Values, "last_error") == "") {
+				t.Errorf("dead letter %v, want the source ID and last error", deadLetters[0].Values)
+			}
+		})
+	}
+}
+
+func TestPromoteRetries(t *testing.T) {
+	d, fake := newTestDispatcher(t)
+	now := time.Now()
+	fake.ZAdd(context.Background(), "webhook.retries", float64(now.Add(-time.Second).UnixMilli()), `{"event_id":"evt_due","attempts":"2"}`)
+	fake.ZAdd(context.Background(), "webhook.retries", float64(now.Add(time.Minute).UnixMilli()), `{"event_id":"evt_later","attempts":"1"}`)
+
+	// A failed re-enqueue keeps the retry scheduled
+	fake.xaddErr = errors.New("connection refused")
+	d.promoteRetries(context.Background(), now)
+	if len(fake.zsets["webhook.retries"]) != 2 || len(fake.streams["webhook.events"]) != 0 {
+		t.Fatalf("retries %v, events %v, want both retries kept", fake.zsets["webhook.retries"], fake.streams["webhook.events"])
+	}
+
+	fake.xaddErr = nil
+	d.promoteRetries(context.Background(), now)
+	events := fake.streams["webhook.events"]
+	if len(events) != 1 || stringValue(events[0].Values, "event_id") != "evt_due" || stringValue(events[0].Values, "attempts") != "2" {
+		t.Fatalf("events %v, want only the due retry re-enqueued", events)
+	}
+	if _, ok := fake.zsets["webhook.retries"][`{"event_id":"evt_later","attempts":"1"}`]; !ok || len(fake.zsets["webhook.retries"]) != 1 {
+		t.Errorf("retries %v, want only the later retry left", fake.zsets["webhook.retries"])
+	}
+}
+
+// addDeadLetter adds a dead letter the way deadLetter stores them and returns its ID
+func addDeadLetter(fake *fakeBroker, eventID, sourceID string) string {
+	values := map[string]interface{}{"merchant_id": "MERCHANT-1", "event": "payment.succeeded", "payload": `{}`,
+		"attempts": "4", "last_error": "endpoint responded with status 500", "failed_at": "2026-01-01T00:00:00Z", "source_id": sourceID}
+	if eventID != "" {
+		values["event_id"] = eventID
+	}
+	id, _ := fake.XAdd(context.Background(), "webhook.dead_letter", values)
+	return id
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	d, fake := newTestDispatcher(t)
+	if _, err := d.Replay(ctx, "404-0"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+
+	id := addDeadLetter(fake, "", "7-0")
+	newID, err := d.Replay(ctx, id)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	events := fake.streams["webhook.events"]
+	if len(events) != 1 || events[0].ID != newID {
+		t.Fatalf("events %v, want the replayed event as %s", events, newID)
+	}
+	if stringValue(events[0].Values, "event_id") != "7-0" {
+		t.Errorf("event_id %q, want the source ID 7-0", stringValue(events[0].Values, "event_id"))
+	}
+	for _, field := range deadLetterFields {
+		if _, ok := events[0].Values[field]; ok {
+			t.Errorf("replayed event still has %s", field)
+		}
+	}
+	if len(fake.streams["webhook.dead_letter"]) != 0 {
+		t.Errorf("dead letters %v, want the replayed one removed", fake.streams["webhook.dead_letter"])
+	}
+}
+
+func TestReplayAfterFailedRemoval(t *testing.T) {
+	ctx := context.Background()
+	d, fake := newTestDispatcher(t)
+	id := addDeadLetter(fake, "evt_1", "7-0")
+
+	fake.xdelErr = errors.New("connection reset")
+	if _, err := d.Replay(ctx, id); err == nil {
+		t.Fatal("Replay succeeded, want the removal error")
+	}
+	if len(fake.streams["webhook.events"]) != 1 || len(fake.streams["webhook.dead_letter"]) != 1 {
+		t.Fatalf("events %v, dead letters %v, want the event enqueued and the dead letter kept", fake.streams["webhook.events"], fake.streams["webhook.dead_letter"])
+	}
+
+	// Replaying again only removes the dead letter
+	fake.xdelErr = nil
+	newID, err := d.Replay(ctx, id)
+	if err != nil {
+		t.Fatalf("second Replay failed: %v", err)
+	}
+	events := fake.streams["webhook.events"]
+	if len(events) != 1 || events[0].ID != newID {
+		t.Errorf("events %v, want the event enqueued once as %s", events, newID)
+	}
+	if len(fake.streams["webhook.dead_letter"]) != 0 {
+		t.Errorf("dead letters %v, want none", fake.streams["webhook.dead_letter"])
+	}
+}
+
+func TestReplayAllReportsPartialFailure(t *testing.T) {
+	d, fake := newTestDispatcher(t)
+	first := addDeadLetter(fake, "evt_1", "1-0")
+	addDeadLetter(fake, "evt_2", "2-0")
+	addDeadLetter(fake, "evt_3", "3-0")
+
+	fake.xaddErr, fake.xaddOK = errors.New("connection reset"), 1
+	replayed, err := d.ReplayAll(context.Background(), 50)
+	if err == nil || !strings.Contains(err.Error(), "replayed 1 of 3") {
+		t.Errorf("got %v, want an error counting the replayed deliveries", err)
+	}
+	if len(replayed) != 1 || replayed[0] != first {
+		t.Errorf("replayed %v, want only %s", replayed, first)
+	}
+	if len(fake.streams["webhook.dead_letter"]) != 2 {
+		t.Errorf("dead letters %v, want the two not replayed kept", fake.streams["webhook.dead_letter"])
+	}
+}
@@ -2,32 +2,56 @@ package main
 
 import (
 	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/handlers"
 	"caaspay-api-go/api/routes"
+	"caaspay-api-go/api/server"
+	"caaspay-api-go/api/validate"
 	"caaspay-api-go/internal/broker"
 	"caaspay-api-go/internal/logging"
 	"caaspay-api-go/internal/metrics"
-	"caaspay-api-go/internal/openapi"
 	"caaspay-api-go/internal/rpc"
+	"caaspay-api-go/internal/webhook"
 	"context"
 	"fmt"
 	"log"
-	"os"
-
-	"github.com/gin-gonic/gin"
-	swaggerFiles "github.com/swaggo/files"
-	"github.com/swaggo/gin-swagger"
-	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 )
 
+// configDir holds api.yaml, credentials.yaml and routes.yaml
+const configDir = "./config"
+
 func main() {
-	ctx := context.Background()
-	cfg, err := config.LoadAPIConfig()
+	// `validate [dir]` checks the config files and exits
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		dir := configDir
+		if len(os.Args) > 2 {
+			dir = os.Args[2]
+		}
+		os.Exit(validateConfig(dir))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Refuse to start with settings that would be ignored or misapplied
+	if problems := validate.Check(configDir); len(problems) > 0 {
+		for _, problem := range problems {
+			log.Println(problem)
+		}
+		log.Fatalf("Invalid configuration: %d problem(s) found", len(problems))
+	}
+
+	cfg, err := config.LoadAPIConfigFrom(configDir)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-	// Load route configurations once
-	routeConfigs, err := routes.LoadRouteConfigs(cfg)
+	// Load route configurations; they are reloaded when the config files change
+	routeConfigs, err := routes.LoadRouteConfigsFrom(cfg, configDir)
 	if err != nil {
 		log.Fatalf("Failed to load route configurations: %v", err)
 	}
@@ -41,56 +65,113 @@ func main() {
 		defer metricsClient.Close()
 	}
 
-	logger := logging.NewLogger(cfg.AppName, cfg.Env, cfg.LogLevel, false, metricsClient, ctx)
+	logger := logging.NewLogger(cfg.AppName, cfg.Env, cfg.LogLevel, cfg.MetricsEnabled, metricsClient, ctx)
+
+	// In mock mode routes are served from their mocks, so Redis isn't needed
+	var redisBroker *broker.RedisBroker
+	var rpcClientPool *rpc.RPCClientPool
+	var dispatcher *webhook.Dispatcher
+	if cfg.MockMode {
+		logger.LogWithStats("warn", "Mock mode enabled, routes are served from their mock responses", map[string]string{"metric_name": "mock_mode_enabled"}, nil)
+	} else {
+		// Initialize Redis broker with options
+		redisOptions := broker.RedisOptions{
+			Addrs:     cfg.Redis.Address,
+			Prefix:    cfg.Redis.Prefix,
+			IsCluster: cfg.Redis.IsCluster, // Set to true if you want to use a Redis cluster
+		}
+		redisBroker = broker.NewRedisBroker(redisOptions)
+
+		// Initialize the RPC client pool using the Redis broker
+		rpcClientPool = rpc.NewRPCClientPool(ctx, cfg.RPCPool.InitialClients, cfg.RPCPool.MaxClients, cfg.RPCPool.MaxRequestsPerClient, redisBroker, cfg.RPCPool.MonitorInterval, cfg.RPCPool.ScaleDown, logger)
 
-	// Set up Gin with logger middleware
-	if cfg.Env == "production" {
-		gin.SetMode(gin.ReleaseMode)
+		// Start the outbound webhook workers
+		if cfg.Webhooks.Enabled {
+			dispatcher = webhook.NewDispatcher(redisBroker, cfg.Webhooks, logger)
+			if err := dispatcher.Start(ctx); err != nil {
+				logger.LogWithStats("error", "Failed to start webhook dispatcher", map[string]string{"metric_name": "webhook_dispatcher_error"}, map[string]interface{}{"error": err.Error()})
+				dispatcher = nil
+			}
+		}
 	}
-	r := gin.Default()
-	r.Use(func(c *gin.Context) {
-		logger.Middleware()(c)
-	})
-	r.Use(otelgin.Middleware(cfg.AppName))
-
-	// Initialize Redis broker with options
-	redisOptions := broker.RedisOptions{
-		Addrs:     cfg.Redis.Address,
-		Prefix:    cfg.Redis.Prefix,
-		IsCluster: cfg.Redis.IsCluster, // Set to true if you want to use a Redis cluster
+
+	// Build the router; it is rebuilt and swapped when the config changes
+	readiness := &handlers.Readiness{}
+	deps := server.Dependencies{RPCClientPool: rpcClientPool, Dispatcher: dispatcher, Logger: logger, Readiness: readiness}
+	engine, err := server.BuildRouter(cfg, routeConfigs, deps)
+	if err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
+	router := &server.Router{}
+	router.Swap(engine)
+
+	// Reload the config on file changes and SIGHUP
+	reloader := server.NewReloader(configDir, router, deps, cfg, routeConfigs)
+	if err := reloader.Watch(ctx); err != nil {
+		logger.LogWithStats("error", "Failed to watch config", map[string]string{"metric_name": "config_watch_error", "error": err.Error()}, nil)
 	}
-	redisBroker := broker.NewRedisBroker(redisOptions)
-	defer redisBroker.Close()
 
-	// Initialize the RPC client pool using the Redis broker
-	rpcClientPool := rpc.NewRPCClientPool(ctx, cfg.RPCPool.InitialClients, cfg.RPCPool.MaxClients, cfg.RPCPool.MaxRequestsPerClient, redisBroker, cfg.RPCPool.MonitorInterval, cfg.RPCPool.ScaleDown, logger)
-	defer rpcClientPool.Close()
+	// Start the API server and serve until SIGTERM or SIGINT
+	srv := &http.Server{Addr: fmt.Sprintf("%v:%v", cfg.Host, cfg.Port), Handler: router}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
 
-	// Initialize the routes with the route configuration
-	if err := routes.SetupRoutes(r, rpcClientPool, cfg, routeConfigs, logger); err != nil {
-		logger.LogWithStats("error", "Failed to set up routes", map[string]string{"metric_name": "setup_routes_error", "error": fmt.Sprintf("err %v", err)}, nil)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serveErr:
+		log.Fatalf("Failed to run server: %v", err)
+	case sig := <-stop:
+		logger.LogWithStats("info", "Shutting down", map[string]string{"metric_name": "server_shutdown", "signal": sig.String()}, nil)
 	}
+	signal.Stop(stop)
 
-	if cfg.EnableOpenapiSwagger {
-		// Generate OpenAPI spec from routeConfigs and additional static routes
-		openAPISpec, err := openapi.GenerateOpenAPISpec(routeConfigs, cfg)
-		if err != nil {
-			logger.LogWithStats("error", "Failed to generate OpenAPI spec", map[string]string{"error": err.Error()}, nil)
-		} else {
-			r.GET("/openapi.json", func(c *gin.Context) {
-				c.JSON(http.StatusOK, openAPISpec)
-			})
-		}
+	shutdown(cfg.Shutdown, srv, readiness, rpcClientPool, redisBroker, dispatcher, cancel, logger)
+}
+
+// shutdown fails readiness, stops accepting connections and waits for the in-flight requests and RPC
+// calls within the grace period, then closes the RPC client pool and the broker, in that order
+func shutdown(settings config.ShutdownConfig, srv *http.Server, readiness *handlers.Readiness, rpcClientPool *rpc.RPCClientPool, redisBroker *broker.RedisBroker, dispatcher *webhook.Dispatcher, cancel context.CancelFunc, logger *logging.Logger) {
+	// Give load balancers time to see the failed readiness before the listener closes
+	readiness.Fail()
+	time.Sleep(settings.Delay)
 
-		r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
+	ctx, cancelGrace := context.WithTimeout(context.Background(), settings.GracePeriod)
+	defer cancelGrace()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.LogWithStats("warn", "In-flight requests did not finish within the grace period", map[string]string{"metric_name": "shutdown_requests_abandoned"}, map[string]interface{}{"error": err.Error()})
+	}
+	if rpcClientPool != nil {
+		if pending := rpcClientPool.Drain(ctx); pending > 0 {
+			logger.LogWithStats("warn", "RPC calls did not finish within the grace period", map[string]string{"metric_name": "shutdown_rpc_abandoned", "metric_value": strconv.Itoa(pending)}, nil)
+		}
+		// Unsubscribes the clients, which needs the broker and the running context
+		rpcClientPool.Close()
 	}
 
-	// Start the API server
-	if err := r.Run(fmt.Sprintf("%v:%v", cfg.Host, cfg.Port)); err != nil {
-		log.Fatalf("Failed to run server: %v", err)
+	// Stop the webhook workers, config watcher and pool monitors before the broker goes away
+	cancel()
+	if dispatcher != nil {
+		dispatcher.Wait()
+	}
+	if redisBroker != nil {
+		redisBroker.Close()
 	}
+	logger.LogWithStats("info", "Server stopped", map[string]string{"metric_name": "server_stopped"}, nil)
+}
 
-	// Close the broker and RPC client pool when the server shuts down
-	defer redisBroker.Close()
-	defer rpcClientPool.Close()
+// validateConfig prints every problem found in the config files and returns the exit code
+func validateConfig(dir string) int {
+	problems := validate.Check(dir)
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		fmt.Fprintf(os.Stderr, "%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("%s: configuration is valid\n", dir)
+	return 0
 }
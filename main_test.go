@@ -0,0 +1,106 @@
+package main
+
+import (
+	"caaspay-api-go/api/config"
+	"caaspay-api-go/api/handlers"
+	"caaspay-api-go/internal/logging"
+	"context"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		release     bool // The in-flight request finishes within the grace period
+		want        []string
+	}{
+		{"drains in-flight requests", 5 * time.Second, true, []string{"readiness failed", "request finished", "cancelled"}},
+		{"grace period exceeded", 100 * time.Millisecond, false, []string{"readiness failed", "cancelled"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var events []string
+			record := func(event string) {
+				mu.Lock()
+				defer mu.Unlock()
+				events = append(events, event)
+			}
+
+			readiness := &handlers.Readiness{}
+			started, release := make(chan struct{}), make(chan struct{})
+			engine := gin.New()
+			engine.GET("/health", func(c *gin.Context) { handlers.HealthHandler(c, nil, readiness) })
+			engine.GET("/slow", func(c *gin.Context) {
+				close(started)
+				<-release
+				record("request finished")
+				c.Status(http.StatusNoContent)
+			})
+
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := &http.Server{Handler: engine}
+			go srv.Serve(listener)
+			base := "http://" + listener.Addr().String()
+
+			slowDone := make(chan struct{})
+			go func() {
+				defer close(slowDone)
+				if resp, err := http.Get(base + "/slow"); err == nil {
+					resp.Body.Close()
+				}
+			}()
+			<-started
+
+			logger := logging.NewLogger("test", "test", "panic", false, nil, context.Background())
+			settings := config.ShutdownConfig{Delay: 200 * time.Millisecond, GracePeriod: tt.gracePeriod}
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				shutdown(settings, srv, readiness, nil, nil, nil, func() { record("cancelled") }, logger)
+			}()
+
+			// During the delay readiness fails while the listener still accepts connections
+			time.Sleep(50 * time.Millisecond)
+			resp, err := http.Get(base + "/health")
+			if err != nil {
+				t.Fatalf("health check during the delay failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("health during the delay returned %d, want 503", resp.StatusCode)
+			}
+			record("readiness failed")
+
+			if tt.release {
+				time.Sleep(settings.Delay)
+				close(release)
+				<-done
+			} else {
+				<-done
+				close(release)
+			}
+			<-slowDone
+
+			if _, err := http.Get(base + "/health"); err == nil {
+				t.Error("the listener still accepts connections after shutdown")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if !reflect.DeepEqual(events[:len(tt.want)], tt.want) {
+				t.Errorf("events %v, want %v", events, tt.want)
+			}
+		})
+	}
+}